@@ -0,0 +1,140 @@
+package nabot
+
+import (
+	"github.com/mymmrac/telego"
+)
+
+// The accessors below read commonly used fields of an update without panicking on nil parts.
+// Each returns false when the update does not carry the requested field.
+
+// MessageText returns the text of update.Message.
+// Returns false if the update has no message or the message has no text.
+func MessageText(update telego.Update) (string, bool) {
+	if update.Message == nil || update.Message.Text == "" {
+		return "", false
+	}
+	return update.Message.Text, true
+}
+
+// MessageCaption returns the caption of update.Message.
+// Returns false if the update has no message or the message has no caption.
+func MessageCaption(update telego.Update) (string, bool) {
+	if update.Message == nil || update.Message.Caption == "" {
+		return "", false
+	}
+	return update.Message.Caption, true
+}
+
+// CallbackData returns the data of update.CallbackQuery.
+// Returns false if the update has no callback query.
+func CallbackData(update telego.Update) (string, bool) {
+	if update.CallbackQuery == nil {
+		return "", false
+	}
+	return update.CallbackQuery.Data, true
+}
+
+// CallbackChatID returns the chat of the message the callback query originated from.
+// Returns false if the update has no callback query or the query was sent from an inline message.
+func CallbackChatID(update telego.Update) (telego.ChatID, bool) {
+	if update.CallbackQuery == nil || update.CallbackQuery.Message == nil {
+		return telego.ChatID{}, false
+	}
+	chatID := update.CallbackQuery.Message.GetChat().ChatID()
+	return chatID, chatID.ID != 0
+}
+
+// InlineQueryText returns the query text of update.InlineQuery.
+// Returns false if the update has no inline query.
+func InlineQueryText(update telego.Update) (string, bool) {
+	if update.InlineQuery == nil {
+		return "", false
+	}
+	return update.InlineQuery.Query, true
+}
+
+// UpdateChat returns the chat the update happened in.
+// Returns false if the update type has no chat, e.g. inline queries, or the callback query was sent
+// from an inline message.
+func UpdateChat(update telego.Update) (telego.Chat, bool) {
+	var chat *telego.Chat
+	switch {
+	case update.Message != nil:
+		chat = &update.Message.Chat
+	case update.EditedMessage != nil:
+		chat = &update.EditedMessage.Chat
+	case update.ChannelPost != nil:
+		chat = &update.ChannelPost.Chat
+	case update.EditedChannelPost != nil:
+		chat = &update.EditedChannelPost.Chat
+	case update.BusinessMessage != nil:
+		chat = &update.BusinessMessage.Chat
+	case update.EditedBusinessMessage != nil:
+		chat = &update.EditedBusinessMessage.Chat
+	case update.DeletedBusinessMessages != nil:
+		chat = &update.DeletedBusinessMessages.Chat
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		c := update.CallbackQuery.Message.GetChat()
+		chat = &c
+	case update.MyChatMember != nil:
+		chat = &update.MyChatMember.Chat
+	case update.ChatMember != nil:
+		chat = &update.ChatMember.Chat
+	case update.ChatJoinRequest != nil:
+		chat = &update.ChatJoinRequest.Chat
+	case update.MessageReaction != nil:
+		chat = &update.MessageReaction.Chat
+	case update.MessageReactionCount != nil:
+		chat = &update.MessageReactionCount.Chat
+	case update.PollAnswer != nil:
+		chat = update.PollAnswer.VoterChat
+	}
+	if chat == nil || chat.ID == 0 {
+		return telego.Chat{}, false
+	}
+	return *chat, true
+}
+
+// UpdateSender returns the user who caused the update.
+// Returns false if the update type has no sender, e.g. channel posts or anonymous poll answers.
+func UpdateSender(update telego.Update) (telego.User, bool) {
+	var user *telego.User
+	switch {
+	case update.Message != nil:
+		user = update.Message.From
+	case update.EditedMessage != nil:
+		user = update.EditedMessage.From
+	case update.BusinessMessage != nil:
+		user = update.BusinessMessage.From
+	case update.EditedBusinessMessage != nil:
+		user = update.EditedBusinessMessage.From
+	case update.BusinessConnection != nil:
+		user = &update.BusinessConnection.User
+	case update.CallbackQuery != nil:
+		user = &update.CallbackQuery.From
+	case update.InlineQuery != nil:
+		user = &update.InlineQuery.From
+	case update.ChosenInlineResult != nil:
+		user = &update.ChosenInlineResult.From
+	case update.ShippingQuery != nil:
+		user = &update.ShippingQuery.From
+	case update.PreCheckoutQuery != nil:
+		user = &update.PreCheckoutQuery.From
+	case update.PurchasedPaidMedia != nil:
+		user = &update.PurchasedPaidMedia.From
+	case update.PollAnswer != nil:
+		user = update.PollAnswer.User
+	case update.MyChatMember != nil:
+		user = &update.MyChatMember.From
+	case update.ChatMember != nil:
+		user = &update.ChatMember.From
+	case update.ChatJoinRequest != nil:
+		user = &update.ChatJoinRequest.From
+	case update.MessageReaction != nil:
+		user = update.MessageReaction.User
+	}
+	if user == nil {
+		return telego.User{}, false
+	}
+	return *user, true
+}
@@ -0,0 +1,78 @@
+package nabot
+
+import (
+	"context"
+)
+
+// Well-known annotation keys.
+const (
+	// IntentAnnotation is the key of the intent detected by an intent classifier.
+	IntentAnnotation = "intent"
+	// LanguageAnnotation is the key of the language detected by a language detector.
+	LanguageAnnotation = "language"
+)
+
+// Label is an annotation attached to an update, such as a detected intent with its confidence.
+type Label struct {
+	Value string
+	Score float64
+}
+
+// Annotator attaches labels to updates before they are routed to handlers.
+// Returned labels are added to the update annotations by key, such as IntentAnnotation.
+type Annotator interface {
+	Annotate(ctx Context) (map[string]Label, error)
+}
+
+// AnnotatorFunc adapts a function to Annotator.
+type AnnotatorFunc func(ctx Context) (map[string]Label, error)
+
+func (f AnnotatorFunc) Annotate(ctx Context) (map[string]Label, error) {
+	return f(ctx)
+}
+
+// WithAnnotators adds annotators run in order on every update before routing.
+// Later annotators see the labels of earlier ones and can override them.
+// An annotator failing is logged and does not stop the update from being handled.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithAnnotators(intentClassifier, languageDetector))
+//	app.Handle(handlers.Intent("book_ticket", func(ctx nabot.Context, label nabot.Label) error {
+//	    // ...
+//	}))
+func WithAnnotators(annotators ...Annotator) AppOption {
+	return func(a *App) {
+		a.annotators = append(a.annotators, annotators...)
+	}
+}
+
+// GetAnnotation returns the label attached to the update under key.
+func GetAnnotation(ctx context.Context, key string) (Label, bool) {
+	values := getUpdateValues(ctx)
+	if values == nil {
+		return Label{}, false
+	}
+	label, ok := values.annotations[key]
+	return label, ok
+}
+
+func (a *App) annotate(ctx Context) {
+	if len(a.annotators) == 0 {
+		return
+	}
+	values := getUpdateValues(ctx)
+	if values.annotations == nil {
+		values.annotations = make(map[string]Label)
+	}
+	for _, annotator := range a.annotators {
+		labels, err := annotator.Annotate(ctx)
+		if err != nil {
+			ctx.Logger().Warn("nabot: annotator failed", "error", err)
+			continue
+		}
+		for k, v := range labels {
+			values.annotations[k] = v
+		}
+	}
+}
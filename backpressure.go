@@ -0,0 +1,199 @@
+package nabot
+
+import (
+	"container/list"
+	"context"
+	"github.com/mymmrac/telego"
+	"log/slog"
+	"sync"
+)
+
+// OverflowPolicy is what the App does with an update received when the limit of WithMaxInFlight is reached.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops reading updates until an update is handled, leaving them queued on the Bale server
+	// or in the update channel.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the received update.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest update not yet being handled, to make room for the received one.
+	// The dropped update is removed from the queues of WithOrderedUpdates and WithFairScheduler and released,
+	// so memory stays bounded under sustained overload. If all updates are being handled, it blocks
+	// like OverflowBlock.
+	OverflowDropOldest
+)
+
+// WithMaxInFlight bounds the updates received but not yet handled, including those queued by WithOrderedUpdates,
+// WithFairScheduler or the Executor, to n. When the limit is reached, overflow decides whether Run blocks or
+// updates are dropped, so a traffic spike does not start unbounded goroutines.
+// Dropped updates are logged and reported to the Metrics of the App.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithMaxInFlight(1000, nabot.OverflowDropOldest))
+func WithMaxInFlight(n int, overflow OverflowPolicy) AppOption {
+	return func(a *App) {
+		f := &inFlight{limit: max(n, 1), policy: overflow}
+		f.hasRoom = sync.NewCond(&f.mu)
+		a.inFlight = f
+	}
+}
+
+// inFlight counts the updates admitted by Run until they are handled.
+type inFlight struct {
+	limit   int
+	policy  OverflowPolicy
+	mu      sync.Mutex
+	hasRoom *sync.Cond
+	count   int
+	// waiting are the admitted updates not yet being handled, oldest first.
+	waiting list.List
+}
+
+// admission is an update admitted by inFlight.
+// Queues keep a handle to it instead of the update (see queuedUpdate), so dropped updates are released.
+type admission struct {
+	update  telego.Update
+	waiting *list.Element
+	dropped bool
+	// remove removes the update from the queue holding it, if the queue supports it. Set by the queue.
+	remove func()
+}
+
+type admissionKey struct{}
+
+func admissionOf(update telego.Update) *admission {
+	a, _ := update.Context().Value(admissionKey{}).(*admission)
+	return a
+}
+
+// queuedUpdate returns the value queued for update until it is handled: a handle to its admission, if any,
+// so that the update is not referenced by the queue after it is dropped.
+func queuedUpdate(update telego.Update) telego.Update {
+	if admissionOf(update) == nil {
+		return update
+	}
+	return telego.Update{UpdateID: update.UpdateID}.WithContext(update.Context())
+}
+
+// admit waits for room for update according to the overflow policy, and returns it with its admission.
+// It returns false if the update is dropped. Dropped updates, including those dropped to make room,
+// are passed to drop.
+func (f *inFlight) admit(update telego.Update, drop func(telego.Update)) (telego.Update, bool) {
+	var dropped []*admission
+	var droppedUpdates []telego.Update
+	f.mu.Lock()
+	for f.count >= f.limit {
+		if f.policy == OverflowDropNewest {
+			f.mu.Unlock()
+			drop(update)
+			return update, false
+		}
+		if f.policy == OverflowDropOldest && f.waiting.Len() > 0 {
+			oldest := f.waiting.Remove(f.waiting.Front()).(*admission)
+			oldest.waiting = nil
+			oldest.dropped = true
+			dropped = append(dropped, oldest)
+			droppedUpdates = append(droppedUpdates, oldest.update)
+			oldest.update = telego.Update{}
+			f.count--
+			continue
+		}
+		f.hasRoom.Wait()
+	}
+	a := &admission{}
+	a.update = update.WithContext(context.WithValue(update.Context(), admissionKey{}, a))
+	a.waiting = f.waiting.PushBack(a)
+	f.count++
+	f.mu.Unlock()
+
+	for i, d := range dropped {
+		// queues without removal keep the handle, which is skipped when its turn comes
+		if d.remove != nil {
+			d.remove()
+		}
+		drop(droppedUpdates[i])
+	}
+	return a.update, true
+}
+
+// start marks the admission of update as being handled and returns it. It returns false if it was dropped.
+func (f *inFlight) start(update telego.Update) (*admission, bool) {
+	a := admissionOf(update)
+	if a == nil {
+		return nil, true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if a.dropped {
+		return nil, false
+	}
+	if a.waiting != nil {
+		f.waiting.Remove(a.waiting)
+		a.waiting = nil
+	}
+	return a, true
+}
+
+// discard releases the room of an update dropped before it was handled, and returns the update.
+func (f *inFlight) discard(update telego.Update) telego.Update {
+	a := admissionOf(update)
+	if a == nil {
+		return update
+	}
+	f.mu.Lock()
+	if a.dropped {
+		f.mu.Unlock()
+		return update
+	}
+	if a.waiting != nil {
+		f.waiting.Remove(a.waiting)
+		a.waiting = nil
+	}
+	a.dropped = true
+	update, a.update = a.update, telego.Update{}
+	f.count--
+	f.mu.Unlock()
+	f.hasRoom.Signal()
+	return update
+}
+
+// done releases the room of an update handled after start.
+func (f *inFlight) done(a *admission) {
+	if a == nil {
+		return
+	}
+	f.mu.Lock()
+	f.count--
+	a.update = telego.Update{}
+	f.mu.Unlock()
+	f.hasRoom.Signal()
+}
+
+// dropUpdate logs and reports an update dropped by the overflow policy. It is acknowledged, as it is dropped
+// on purpose.
+func (a *App) dropUpdate(update telego.Update) {
+	a.logger.Warn("nabot: too many updates in flight; dropping update",
+		slog.String("update_type", GetTypeOfUpdate(update)),
+	)
+	if a.metrics != nil {
+		a.metrics.UpdateDropped(GetTypeOfUpdate(update))
+	}
+	ackUpdate(update)
+}
+
+// dropChatUpdate logs and reports an update dropped because the queue of its chat is full,
+// releasing its room in WithMaxInFlight. It is acknowledged, as it is dropped on purpose.
+func (a *App) dropChatUpdate(update telego.Update) {
+	if a.inFlight != nil {
+		update = a.inFlight.discard(update)
+	}
+	a.logger.Warn("nabot: chat queue is full; dropping update",
+		slog.String("update_type", GetTypeOfUpdate(update)),
+	)
+	if a.metrics != nil {
+		a.metrics.UpdateDropped(GetTypeOfUpdate(update))
+	}
+	ackUpdate(update)
+}
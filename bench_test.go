@@ -0,0 +1,110 @@
+package nabot
+
+import (
+	"fmt"
+	"github.com/mymmrac/telego"
+	"log/slog"
+	"testing"
+)
+
+// benchHandler passes every update, unless it is the target, which handles every update it receives.
+type benchHandler struct {
+	name   string
+	target bool
+}
+
+func (h benchHandler) Name() string {
+	return h.name
+}
+
+func (h benchHandler) Handle(ctx Context) error {
+	if h.target {
+		return nil
+	}
+	return ErrPass
+}
+
+type typedBenchHandler struct {
+	benchHandler
+	types []string
+}
+
+func (h typedBenchHandler) UpdateTypes() []string {
+	return h.types
+}
+
+func benchApp() *App {
+	return NewApp(nil, nil, WithLogger(slog.New(slog.DiscardHandler)))
+}
+
+func benchMessage() telego.Update {
+	return telego.Update{
+		UpdateID: 1,
+		Message: &telego.Message{
+			MessageID: 1,
+			Chat:      telego.Chat{ID: 1, Type: telego.ChatTypePrivate},
+			From:      &telego.User{ID: 1},
+			Text:      "hello",
+		},
+	}
+}
+
+// BenchmarkRouting measures a message handled by the last of many handlers, most of them for callback queries.
+// Untyped handlers are all visited and pass with ErrPass; typed ones are skipped by the routes.
+func BenchmarkRouting(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		for _, typed := range []bool{false, true} {
+			b.Run(fmt.Sprintf("handlers=%d/typed=%t", n, typed), func(b *testing.B) {
+				app := benchApp()
+				for i := range n - 1 {
+					h := benchHandler{name: fmt.Sprintf("callback_%d", i)}
+					if typed {
+						app.Handle(typedBenchHandler{benchHandler: h, types: []string{UpdateTypeCallbackQuery}})
+					} else {
+						app.Handle(h)
+					}
+				}
+				app.Handle(typedBenchHandler{
+					benchHandler: benchHandler{name: "message", target: true},
+					types:        []string{UpdateTypeMessage},
+				})
+				app.Freeze()
+				update := benchMessage()
+				b.ReportAllocs()
+				b.ResetTimer()
+				for range b.N {
+					app.processUpdate(update)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkProcessUpdate measures the hot path of a message routed to six handlers, the last one handling it.
+func BenchmarkProcessUpdate(b *testing.B) {
+	app := benchApp()
+	for i := range 5 {
+		app.Handle(benchHandler{name: fmt.Sprintf("pass_%d", i)})
+	}
+	app.Handle(benchHandler{name: "handle", target: true})
+	app.Freeze()
+	update := benchMessage()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		app.processUpdate(update)
+	}
+}
+
+// BenchmarkNewContext measures the construction of the context of an update.
+func BenchmarkNewContext(b *testing.B) {
+	app := benchApp()
+	update := benchMessage()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if app.newContext(update) == nil {
+			b.Fatal("no context")
+		}
+	}
+}
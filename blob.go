@@ -0,0 +1,187 @@
+package nabot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"strconv"
+)
+
+const (
+	blobChunkSize = 64 << 10
+)
+
+// BlobKey is a key for large values stored in chunks, such as conversation histories or file caches.
+// Use SetBlob and GetBlobReader to access it.
+type BlobKey string
+
+// BlobStorage can be implemented by a DataStorage that stores large values natively.
+// If the chat's DataStorage does not implement it, blobs are split into chunks stored as regular data keys,
+// so no single value exceeds the backend size limits.
+type BlobStorage interface {
+	SetBlob(ctx context.Context, chatKey string, blobKey string, r io.Reader) error
+	// GetBlob returns ErrDataKeyNotFound if the blob does not exist.
+	GetBlob(ctx context.Context, chatKey string, blobKey string) (io.ReadCloser, error)
+	RemoveBlob(ctx context.Context, chatKey string, blobKey string) error
+}
+
+// SetBlob stores everything read from r under key, replacing any existing blob.
+// Without a BlobStorage, the chunks are written under a new generation and the blob is switched to it
+// once they are all written, so readers see either the previous or the new blob, never a mix of both.
+//
+// Example:
+//
+//	const historyKey nabot.BlobKey = "history"
+//
+//	err := nabot.SetBlob(ctx, historyKey, bytes.NewReader(history))
+func SetBlob(c StorageContext, key BlobKey, r io.Reader) error {
+	if bs, ok := c.Store().(BlobStorage); ok {
+		if err := bs.SetBlob(c, c.ChatKey(), string(key), r); err != nil {
+			return fmt.Errorf("failed to set blob: %w", err)
+		}
+		return nil
+	}
+
+	old, err := getBlobHead(c, key)
+	if err != nil && !errors.Is(err, ErrDataKeyNotFound) {
+		return err
+	}
+	head := blobHead{Generation: strconv.FormatUint(rand.Uint64(), 36)}
+	buf := make([]byte, blobChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			if err = c.Store().SetData(c, c.ChatKey(), head.chunkKey(key, head.Count), chunk); err != nil {
+				return errors.Join(fmt.Errorf("failed to set blob chunk: %w", err), removeBlobChunks(c, key, head))
+			}
+			head.Count++
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return errors.Join(fmt.Errorf("failed to read blob: %w", readErr), removeBlobChunks(c, key, head))
+		}
+	}
+	// the head is switched to the new generation once all its chunks are written
+	if err = c.Store().SetData(c, c.ChatKey(), blobHeadKey(key), head); err != nil {
+		return errors.Join(fmt.Errorf("failed to set blob: %w", err), removeBlobChunks(c, key, head))
+	}
+	return removeBlobChunks(c, key, old)
+}
+
+// GetBlobReader returns a reader streaming the blob stored under key.
+// Chunks are fetched lazily as the reader is consumed. If the blob is replaced or removed meanwhile,
+// reading fails with ErrDataKeyNotFound instead of mixing the chunks of both versions.
+// Returns ErrDataKeyNotFound if the blob does not exist.
+func GetBlobReader(c StorageContext, key BlobKey) (io.ReadCloser, error) {
+	if bs, ok := c.Store().(BlobStorage); ok {
+		r, err := bs.GetBlob(c, c.ChatKey(), string(key))
+		if err != nil && !errors.Is(err, ErrDataKeyNotFound) {
+			return nil, fmt.Errorf("failed to get blob: %w", err)
+		}
+		return r, err
+	}
+
+	head, err := getBlobHead(c, key)
+	if err != nil {
+		return nil, err
+	}
+	return &blobReader{c: c, key: key, head: head}, nil
+}
+
+// RemoveBlob deletes the blob stored under key.
+func RemoveBlob(c StorageContext, key BlobKey) error {
+	if bs, ok := c.Store().(BlobStorage); ok {
+		if err := bs.RemoveBlob(c, c.ChatKey(), string(key)); err != nil {
+			return fmt.Errorf("failed to remove blob: %w", err)
+		}
+		return nil
+	}
+
+	head, err := getBlobHead(c, key)
+	if errors.Is(err, ErrDataKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = c.Store().RemoveData(c, c.ChatKey(), blobHeadKey(key)); err != nil {
+		return fmt.Errorf("failed to remove blob: %w", err)
+	}
+	return removeBlobChunks(c, key, head)
+}
+
+// blobPrefix is the prefix of the data keys of chunked blobs, reserved like other internal keys.
+const blobPrefix = "nabot:blob:"
+
+// blobHead is the current generation of a chunked blob and its number of chunks.
+type blobHead struct {
+	Generation string `json:"generation"`
+	Count      int    `json:"count"`
+}
+
+func (h blobHead) chunkKey(key BlobKey, i int) string {
+	return blobPrefix + string(key) + ":" + h.Generation + ":" + strconv.Itoa(i)
+}
+
+func blobHeadKey(key BlobKey) string {
+	return blobPrefix + string(key)
+}
+
+func getBlobHead(c StorageContext, key BlobKey) (blobHead, error) {
+	var head blobHead
+	err := c.Store().GetData(c, c.ChatKey(), blobHeadKey(key), &head)
+	if err != nil {
+		if errors.Is(err, ErrDataKeyNotFound) {
+			return head, err
+		}
+		return head, fmt.Errorf("failed to get blob: %w", err)
+	}
+	return head, nil
+}
+
+// removeBlobChunks removes the chunks of a generation of the blob.
+func removeBlobChunks(c StorageContext, key BlobKey, head blobHead) error {
+	for i := range head.Count {
+		if err := c.Store().RemoveData(c, c.ChatKey(), head.chunkKey(key, i)); err != nil {
+			return fmt.Errorf("failed to remove blob chunk: %w", err)
+		}
+	}
+	return nil
+}
+
+type blobReader struct {
+	c    StorageContext
+	key  BlobKey
+	head blobHead
+	next int
+	buf  []byte
+}
+
+func (b *blobReader) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if b.next >= b.head.Count {
+			return 0, io.EOF
+		}
+		var chunk []byte
+		if err := b.c.Store().GetData(b.c, b.c.ChatKey(), b.head.chunkKey(b.key, b.next), &chunk); err != nil {
+			return 0, fmt.Errorf("failed to get blob chunk: %w", err)
+		}
+		b.buf = chunk
+		b.next++
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+func (b *blobReader) Close() error {
+	b.buf = nil
+	b.next = b.head.Count
+	return nil
+}
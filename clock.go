@@ -0,0 +1,40 @@
+package nabot
+
+import (
+	"context"
+	"time"
+)
+
+// Clock provides the current time and timers to App and its components.
+// TTLs, schedulers, timeouts and idle-expiry read time through the App's Clock,
+// so tests can replace it with a fake clock such as nabottest.FakeClock.
+type Clock interface {
+	Now() time.Time
+	// After waits for the duration to elapse and then sends the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// clockKey is the context key of the Clock of the App handling the update.
+type clockKey struct{}
+
+// ClockOf returns the Clock of the App the context belongs to, such as the Context of a handler
+// or the TransitionContext of a state. Other contexts get SystemClock.
+func ClockOf(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok && clock != nil {
+		return clock
+	}
+	return SystemClock
+}
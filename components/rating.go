@@ -0,0 +1,349 @@
+// Package components provides reusable interactive components for nabot, such as feedback ratings.
+package components
+
+import (
+	"encoding/csv"
+	"errors"
+	"github.com/bale-ir/nabot"
+	"github.com/bale-ir/nabot/handlers"
+	"github.com/mymmrac/telego"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ratingsChatKey is the chat key of the DataStorage namespace holding the ratings of all chats.
+	ratingsChatKey = "nabot:ratings"
+	// maxRatingRow is the number of buttons fitting in a row of an inline keyboard.
+	maxRatingRow = 8
+)
+
+// Feedback is a rating given by a chat.
+type Feedback struct {
+	ChatKey string    `json:"chat_key"`
+	Score   int       `json:"score"`
+	Comment string    `json:"comment,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// RatingStats aggregates the ratings of a feature.
+type RatingStats struct {
+	Count int `json:"count"`
+	Sum   int `json:"sum"`
+	// Distribution counts the ratings of each score; Distribution[0] is the count of 1s.
+	Distribution []int `json:"distribution"`
+}
+
+// Average returns the average score, or zero if there are no ratings.
+func (s RatingStats) Average() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return float64(s.Sum) / float64(s.Count)
+}
+
+// Rating asks users to rate a feature with star buttons, typically at the end of a flow.
+// Ratings are aggregated per feature in a global namespace of DataStorage. If a follow-up prompt is set,
+// the next text message of the user after rating is recorded as a comment.
+// Each prompt is rated once: taps on a prompt already rated, such as double taps, are ignored.
+//
+// Rating is a nabot.Handler; register it by pointer before the StateHandler, so it receives the comments.
+//
+// Example:
+//
+//	checkoutRating := components.NewRating("checkout",
+//	    components.WithFollowUp("Thanks! Anything we could improve?"),
+//	)
+//	app.Handle(checkoutRating)
+//	// at the end of the checkout flow:
+//	err := checkoutRating.Ask(ctx, "How was your purchase?")
+//	// later:
+//	stats, err := checkoutRating.Stats(ctx)
+type Rating struct {
+	feature  string
+	scale    int
+	followUp string
+	thanks   string
+	button   handlers.InlineButton
+
+	// mu serializes updates of the aggregates, which are read and written back.
+	mu sync.Mutex
+}
+
+// NewRating creates a Rating for feature. The feature must be unique among ratings.
+func NewRating(feature string, options ...RatingOption) *Rating {
+	r := &Rating{
+		feature: feature,
+		scale:   5,
+		thanks:  "Thanks for your feedback!",
+	}
+	r.button = handlers.InlineButton{
+		ID:         "rating_" + feature,
+		HandleFunc: r.rate,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+func (r *Rating) Name() string {
+	return "rating_" + r.feature
+}
+
+func (r *Rating) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeCallbackQuery, nabot.UpdateTypeMessage}
+}
+
+func (r *Rating) Handle(ctx nabot.Context) error {
+	if ctx.Update().CallbackQuery != nil {
+		return r.button.Handle(ctx)
+	}
+	text, ok := nabot.MessageText(ctx.Update())
+	if !ok || r.followUp == "" {
+		return nabot.ErrPass
+	}
+	index, err := nabot.Get(ctx, r.pendingKey())
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return nabot.ErrPass
+	}
+	if err != nil {
+		return err
+	}
+	if err = nabot.Remove(ctx, r.pendingKey()); err != nil {
+		return err
+	}
+	if strings.HasPrefix(text, "/") {
+		// the user moved on to a command instead of commenting
+		return nabot.ErrPass
+	}
+	if err = r.comment(ctx, index, text); err != nil {
+		return err
+	}
+	return r.send(ctx, r.thanks, nil)
+}
+
+// Ask sends prompt with star buttons to the current chat. Scales above 8 are split into rows of even length.
+func (r *Rating) Ask(ctx nabot.TransitionContext, prompt string) error {
+	rows := (r.scale + maxRatingRow - 1) / maxRatingRow
+	perRow := (r.scale + rows - 1) / rows
+	var keyboard [][]telego.InlineKeyboardButton
+	for i := range r.scale {
+		if i%perRow == 0 {
+			keyboard = append(keyboard, nil)
+		}
+		score := strconv.Itoa(i + 1)
+		keyboard[len(keyboard)-1] = append(keyboard[len(keyboard)-1], r.button.ButtonWithText(score+"⭐", score))
+	}
+	return r.send(ctx, prompt, &telego.InlineKeyboardMarkup{InlineKeyboard: keyboard})
+}
+
+// Stats returns the aggregated ratings of the feature.
+func (r *Rating) Stats(ctx nabot.StorageContext) (RatingStats, error) {
+	stats, err := nabot.Get(global(ctx), r.statsKey())
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return RatingStats{Distribution: make([]int, r.scale)}, nil
+	}
+	return stats, err
+}
+
+// Export writes all feedback of the feature as CSV, with a header row.
+func (r *Rating) Export(ctx nabot.StorageContext, w io.Writer) error {
+	entries, err := r.entries(ctx)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err = cw.Write([]string{"chat_key", "score", "comment", "time"}); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		err = cw.Write([]string{e.ChatKey, strconv.Itoa(e.Score), e.Comment, e.Time.Format(time.RFC3339)})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (r *Rating) rate(ctx nabot.Context, data string) error {
+	query := ctx.Update().CallbackQuery
+	err := ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{CallbackQueryID: query.ID})
+	if err != nil {
+		ctx.Logger().Warn("nabot: failed to answer callback query", "error", err)
+	}
+	score, err := strconv.Atoi(data)
+	if err != nil || score < 1 || score > r.scale {
+		return nil
+	}
+	messageID := 0
+	if query.Message != nil {
+		messageID = query.Message.GetMessageID()
+	}
+	if msg, ok := query.Message.(*telego.Message); ok {
+		// remove the buttons so the rating is given once
+		_, err = ctx.Bot().EditMessageReplyMarkup(ctx, &telego.EditMessageReplyMarkupParams{
+			ChatID:    ctx.ChatID(),
+			MessageID: msg.MessageID,
+		})
+		if err != nil {
+			ctx.Logger().Warn("nabot: failed to remove rating buttons", "error", err)
+		}
+	}
+
+	feedback := Feedback{ChatKey: ctx.ChatKey(), Score: score, Time: nabot.ClockOf(ctx).Now()}
+	index, recorded, err := r.record(ctx, messageID, feedback)
+	if err != nil || !recorded {
+		return err
+	}
+	if r.followUp == "" {
+		return r.send(ctx, r.thanks, nil)
+	}
+	if err = nabot.Set(ctx, r.pendingKey(), index); err != nil {
+		return err
+	}
+	return r.send(ctx, r.followUp, nil)
+}
+
+// record adds feedback given on the prompt with messageID to the aggregates and returns its index among
+// the entries. It returns false if the prompt was already rated.
+// Each entry is kept under its own key, numbered by the count of ratings, so recording does not rewrite
+// the previous entries.
+func (r *Rating) record(ctx nabot.Context, messageID int, feedback Feedback) (int, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if messageID != 0 {
+		_, err := nabot.Get(ctx, r.ratedKey(messageID))
+		if err == nil {
+			return 0, false, nil
+		}
+		if !errors.Is(err, nabot.ErrDataKeyNotFound) {
+			return 0, false, err
+		}
+	}
+	stats, err := r.Stats(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	index := stats.Count
+	stats.Count++
+	stats.Sum += feedback.Score
+	for len(stats.Distribution) < r.scale {
+		stats.Distribution = append(stats.Distribution, 0)
+	}
+	stats.Distribution[feedback.Score-1]++
+
+	// the entry is written first, so a failure leaves it to be overwritten by the next rating
+	store := global(ctx)
+	if err = nabot.Set(store, r.entryKey(index), feedback); err != nil {
+		return 0, false, err
+	}
+	if err = nabot.Set(store, r.statsKey(), stats); err != nil {
+		return 0, false, err
+	}
+	if messageID != 0 {
+		if err = nabot.Set(ctx, r.ratedKey(messageID), true); err != nil {
+			return 0, false, err
+		}
+	}
+	return index, true, nil
+}
+
+func (r *Rating) comment(ctx nabot.Context, index int, text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	store := global(ctx)
+	entry, err := nabot.Get(store, r.entryKey(index))
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if entry.ChatKey != ctx.ChatKey() {
+		return nil
+	}
+	entry.Comment = text
+	return nabot.Set(store, r.entryKey(index), entry)
+}
+
+// entries returns all feedback of the feature, oldest first.
+func (r *Rating) entries(ctx nabot.StorageContext) ([]Feedback, error) {
+	stats, err := r.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store := global(ctx)
+	entries := make([]Feedback, 0, stats.Count)
+	for i := range stats.Count {
+		entry, err := nabot.Get(store, r.entryKey(i))
+		if errors.Is(err, nabot.ErrDataKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (r *Rating) send(ctx nabot.TransitionContext, text string, markup *telego.InlineKeyboardMarkup) error {
+	params := &telego.SendMessageParams{
+		ChatID: ctx.ChatID(),
+		Text:   text,
+	}
+	if markup != nil {
+		params.ReplyMarkup = markup
+	}
+	return nabot.QueueMessage(ctx, params)
+}
+
+func (r *Rating) statsKey() nabot.DataKey[RatingStats] {
+	return nabot.DataKey[RatingStats]("rating:" + r.feature)
+}
+
+func (r *Rating) entryKey(index int) nabot.DataKey[Feedback] {
+	return nabot.DataKey[Feedback]("rating:" + r.feature + ":entry:" + strconv.Itoa(index))
+}
+
+// ratedKey marks the prompt with messageID as rated in the storage of the chat.
+func (r *Rating) ratedKey(messageID int) nabot.DataKey[bool] {
+	return nabot.DataKey[bool]("rating_rated:" + r.feature + ":" + strconv.Itoa(messageID))
+}
+
+func (r *Rating) pendingKey() nabot.DataKey[int] {
+	return nabot.DataKey[int]("rating_comment:" + r.feature)
+}
+
+func global(ctx nabot.StorageContext) nabot.StorageContext {
+	return nabot.ForChat(ctx, ratingsChatKey)
+}
+
+// RatingOption configures a Rating.
+type RatingOption func(*Rating)
+
+// WithScale sets the number of stars, at least 2. Default is 5.
+func WithScale(scale int) RatingOption {
+	return func(r *Rating) {
+		r.scale = max(scale, 2)
+	}
+}
+
+// WithFollowUp asks the user for a comment with prompt after rating.
+func WithFollowUp(prompt string) RatingOption {
+	return func(r *Rating) {
+		r.followUp = prompt
+	}
+}
+
+// WithThanks sets the message sent once the feedback is complete. Default is "Thanks for your feedback!".
+func WithThanks(text string) RatingOption {
+	return func(r *Rating) {
+		r.thanks = text
+	}
+}
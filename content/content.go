@@ -0,0 +1,393 @@
+// Package content manages content collections, such as question banks, that admins update from chat.
+//
+// An admin uploads a JSON or CSV file with the collection command as its caption. The file is decoded and
+// validated, and the collection is swapped in a global namespace of DataStorage, so every handler reading it
+// sees the new version without a restart. The previous version is kept and can be restored.
+//
+// Commands, sent by admins:
+//
+//	/content <name>             (as the caption of a file) uploads a new version
+//	/content <name>             shows the current version
+//	/content <name> rollback    restores the previous version
+//
+// Example:
+//
+//	questions := content.New[[]Question]("questions", []int64{adminUserID},
+//	    content.WithValidator(func(qs []Question) error {
+//	        if len(qs) == 0 {
+//	            return errors.New("no questions")
+//	        }
+//	        return nil
+//	    }),
+//	)
+//	app.Handle(questions)
+//	// in a handler:
+//	qs, err := questions.Get(ctx)
+package content
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// globalChatKey is the chat key of the DataStorage namespace shared by all chats.
+	globalChatKey = "nabot:content"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for files other than JSON and CSV.
+	ErrUnsupportedFormat = errors.New("unsupported content format")
+)
+
+// Version is a version of a collection.
+type Version[T any] struct {
+	Number     int       `json:"number"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	UploadedBy int64     `json:"uploaded_by"`
+	Data       T         `json:"data"`
+}
+
+// Collection is content of type T that admins can replace from chat.
+// It is a nabot.Handler handling the collection command of admins.
+type Collection[T any] struct {
+	name     string
+	admins   []int64
+	command  string
+	validate func(T) error
+	maxSize  int64
+}
+
+// New creates a collection. The name must be unique among collections and is used in the admin command.
+// Only users with their ID in admins can use the command.
+func New[T any](name string, admins []int64, options ...Option[T]) *Collection[T] {
+	c := &Collection[T]{
+		name:    name,
+		admins:  admins,
+		command: "/content",
+		maxSize: 10 << 20,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Get returns the current data of the collection.
+// Returns nabot.ErrDataKeyNotFound if no version was uploaded.
+func (c *Collection[T]) Get(ctx nabot.StorageContext) (T, error) {
+	v, err := c.Current(ctx)
+	return v.Data, err
+}
+
+// Current returns the current version of the collection.
+// Returns nabot.ErrDataKeyNotFound if no version was uploaded.
+func (c *Collection[T]) Current(ctx nabot.StorageContext) (Version[T], error) {
+	return nabot.Get(global(ctx), c.currentKey())
+}
+
+// Swap validates data and makes it the current version, keeping the replaced version for Rollback.
+func (c *Collection[T]) Swap(ctx nabot.TransitionContext, data T, uploadedBy int64) (Version[T], error) {
+	if c.validate != nil {
+		if err := c.validate(data); err != nil {
+			return Version[T]{}, err
+		}
+	}
+	store := global(ctx)
+	current, err := nabot.Get(store, c.currentKey())
+	if err != nil && !errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return Version[T]{}, err
+	}
+	next := Version[T]{
+		Number:     current.Number + 1,
+		UploadedAt: nabot.ClockOf(ctx).Now(),
+		UploadedBy: uploadedBy,
+		Data:       data,
+	}
+	if err == nil {
+		if err = nabot.Set(store, c.previousKey(), current); err != nil {
+			return Version[T]{}, err
+		}
+	}
+	if err = nabot.Set(store, c.currentKey(), next); err != nil {
+		return Version[T]{}, err
+	}
+	return next, nil
+}
+
+// Rollback restores the previous version of the collection. The replaced version becomes the previous one,
+// so calling Rollback again undoes it.
+// Returns nabot.ErrDataKeyNotFound if there is no previous version.
+func (c *Collection[T]) Rollback(ctx nabot.StorageContext) (Version[T], error) {
+	store := global(ctx)
+	previous, err := nabot.Get(store, c.previousKey())
+	if err != nil {
+		return Version[T]{}, err
+	}
+	current, err := nabot.Get(store, c.currentKey())
+	if err != nil {
+		return Version[T]{}, err
+	}
+	if err = nabot.Set(store, c.currentKey(), previous); err != nil {
+		return Version[T]{}, err
+	}
+	if err = nabot.Set(store, c.previousKey(), current); err != nil {
+		return Version[T]{}, err
+	}
+	return previous, nil
+}
+
+func (c *Collection[T]) Name() string {
+	return "content_" + c.name
+}
+
+func (c *Collection[T]) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeMessage}
+}
+
+func (c *Collection[T]) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.From == nil {
+		return nabot.ErrPass
+	}
+	text := msg.Text
+	if msg.Document != nil {
+		text = msg.Caption
+	}
+	fields := strings.Fields(text)
+	if len(fields) < 2 || fields[0] != c.command || fields[1] != c.name {
+		return nabot.ErrPass
+	}
+	if !slices.Contains(c.admins, msg.From.ID) {
+		return nabot.ErrPass
+	}
+
+	switch {
+	case msg.Document != nil:
+		return c.upload(ctx, msg)
+	case len(fields) > 2 && fields[2] == "rollback":
+		v, err := c.Rollback(ctx)
+		if errors.Is(err, nabot.ErrDataKeyNotFound) {
+			return c.reply(ctx, "There is no previous version of %s.", c.name)
+		}
+		if err != nil {
+			return err
+		}
+		return c.reply(ctx, "Rolled %s back to version %d.", c.name, v.Number)
+	default:
+		v, err := c.Current(ctx)
+		if errors.Is(err, nabot.ErrDataKeyNotFound) {
+			return c.reply(ctx, "No version of %s was uploaded yet.", c.name)
+		}
+		if err != nil {
+			return err
+		}
+		return c.reply(ctx, "%s is at version %d, uploaded at %s.", c.name, v.Number, v.UploadedAt.Format(time.DateTime))
+	}
+}
+
+func (c *Collection[T]) upload(ctx nabot.Context, msg *telego.Message) error {
+	if msg.Document.FileSize > c.maxSize {
+		return c.reply(ctx, "The file is too large.")
+	}
+	b, err := c.download(ctx, msg.Document.FileID)
+	if err != nil {
+		return err
+	}
+	data, err := Decode[T](msg.Document.FileName, b)
+	if err != nil {
+		return c.reply(ctx, "Could not read the file: %v", err)
+	}
+	v, err := c.Swap(ctx, data, msg.From.ID)
+	if err != nil {
+		return c.reply(ctx, "The content is invalid: %v", err)
+	}
+	return c.reply(ctx, "%s is now at version %d.", c.name, v.Number)
+}
+
+func (c *Collection[T]) download(ctx nabot.Context, fileID string) ([]byte, error) {
+	file, err := ctx.Bot().GetFile(ctx, &telego.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ctx.Bot().FileDownloadURL(file.FilePath), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download content: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download content: status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, c.maxSize))
+}
+
+func (c *Collection[T]) reply(ctx nabot.Context, format string, args ...any) error {
+	_, err := ctx.Bot().SendMessage(ctx, &telego.SendMessageParams{
+		ChatID: ctx.ChatID(),
+		Text:   fmt.Sprintf(format, args...),
+	})
+	return err
+}
+
+func (c *Collection[T]) currentKey() nabot.DataKey[Version[T]] {
+	return nabot.DataKey[Version[T]]("content:" + c.name)
+}
+
+func (c *Collection[T]) previousKey() nabot.DataKey[Version[T]] {
+	return nabot.DataKey[Version[T]]("content:" + c.name + ":previous")
+}
+
+func global(ctx nabot.StorageContext) nabot.StorageContext {
+	return nabot.ForChat(ctx, globalChatKey)
+}
+
+// Decode decodes the content of a file by its extension.
+// JSON files are decoded with encoding/json. CSV files require T to be a slice of structs:
+// the first row names the columns, which are matched to the fields by their `csv` tag or,
+// case-insensitively, by their name. Fields can be strings, bools, integers and floats.
+func Decode[T any](fileName string, b []byte) (T, error) {
+	var data T
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".json":
+		err := json.Unmarshal(b, &data)
+		return data, err
+	case ".csv":
+		err := decodeCSV(b, &data)
+		return data, err
+	default:
+		return data, fmt.Errorf("%w: %q", ErrUnsupportedFormat, path.Ext(fileName))
+	}
+}
+
+func decodeCSV(b []byte, pointer any) error {
+	slice := reflect.ValueOf(pointer).Elem()
+	if slice.Kind() != reflect.Slice || slice.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: CSV requires a slice of structs, not %v", ErrUnsupportedFormat, slice.Type())
+	}
+	elem := slice.Type().Elem()
+
+	records, err := csv.NewReader(bytes.NewReader(b)).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	fields := make([]int, len(records[0]))
+	for i, column := range records[0] {
+		fields[i] = csvField(elem, strings.TrimSpace(column))
+	}
+	for line, record := range records[1:] {
+		item := reflect.New(elem).Elem()
+		for i, value := range record {
+			if i >= len(fields) || fields[i] < 0 {
+				continue
+			}
+			if err = setField(item.Field(fields[i]), value); err != nil {
+				return fmt.Errorf("line %d, column %q: %w", line+2, records[0][i], err)
+			}
+		}
+		slice.Set(reflect.Append(slice, item))
+	}
+	return nil
+}
+
+// csvField returns the index of the exported field for column, or -1.
+func csvField(t reflect.Type, column string) int {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if tag := f.Tag.Get("csv"); tag != "" {
+			if tag == column {
+				return i
+			}
+			continue
+		}
+		if strings.EqualFold(f.Name, column) {
+			return i
+		}
+	}
+	return -1
+}
+
+func setField(f reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(value, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(value, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(v)
+	default:
+		return fmt.Errorf("unsupported field type %v", f.Type())
+	}
+	return nil
+}
+
+// Option configures a Collection.
+type Option[T any] func(*Collection[T])
+
+// WithValidator sets a function validating uploaded content before it is swapped in.
+// Its error is shown to the admin.
+func WithValidator[T any](validate func(T) error) Option[T] {
+	return func(c *Collection[T]) {
+		c.validate = validate
+	}
+}
+
+// WithCommand sets the admin command. Default is "/content".
+func WithCommand[T any](command string) Option[T] {
+	return func(c *Collection[T]) {
+		if !strings.HasPrefix(command, "/") {
+			command = "/" + command
+		}
+		c.command = command
+	}
+}
+
+// WithMaxSize sets the maximum size of uploaded files in bytes. Default is 10 MiB.
+func WithMaxSize[T any](size int64) Option[T] {
+	return func(c *Collection[T]) {
+		c.maxSize = size
+	}
+}
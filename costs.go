@@ -0,0 +1,248 @@
+package nabot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mymmrac/telego/telegoapi"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// CostTracker attributes outgoing API calls to the chats and features making them
+// and aggregates their counts, configured per-method costs and stars spent on paid media.
+// It wraps the telegoapi.Caller of the bot, so every call is counted, including calls made outside handlers.
+//
+// The feature of a call is the name of the handler handling the update, or the name of the state
+// for calls made by states; see WithFeature to set it explicitly.
+//
+// CostTracker also implements http.Handler to be mounted on an admin server: GET returns the counters as JSON.
+// The "group" query parameter aggregates them by "feature", "chat" or "method",
+// and the "feature" and "chat" parameters filter them.
+//
+// The counters are kept in memory, up to MaxEntries combinations of feature, chat and method; see
+// WithMaxCostEntries. Once it is reached, calls of new combinations are counted under the chat key
+// OtherChats, so the totals per feature and method stay exact.
+//
+// Example:
+//
+//	costs := nabot.NewCostTracker(telegoapi.DefaultFastHTTPCaller, nabot.WithMethodCost("sendMessage", 1))
+//	bot, err := telego.NewBot(token, telego.WithAPICaller(costs))
+//	// ...
+//	adminMux.Handle("/costs", costs)
+type CostTracker struct {
+	caller     telegoapi.Caller
+	prices     map[string]int64
+	maxEntries int
+	mu         sync.Mutex
+	entries    map[costKey]*CostEntry
+}
+
+// OtherChats is the chat key CostTracker counts calls under once it holds its maximum number of entries.
+const OtherChats = "other"
+
+const defaultMaxCostEntries = 100000
+
+type costKey struct {
+	feature string
+	chatKey string
+	method  string
+}
+
+// CostEntry is the spending of a feature in a chat on an API method.
+type CostEntry struct {
+	Feature string `json:"feature,omitempty"`
+	ChatKey string `json:"chat_key,omitempty"`
+	Method  string `json:"method,omitempty"`
+	Calls   int64  `json:"calls"`
+	// Cost is the sum of the configured costs of the calls.
+	Cost int64 `json:"cost"`
+	// Stars is the number of stars of paid media sent.
+	Stars int64 `json:"stars"`
+}
+
+// NewCostTracker creates a CostTracker making calls with caller.
+func NewCostTracker(caller telegoapi.Caller, options ...CostOption) *CostTracker {
+	c := &CostTracker{
+		caller:     caller,
+		prices:     make(map[string]int64),
+		maxEntries: defaultMaxCostEntries,
+		entries:    make(map[costKey]*CostEntry),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+func (c *CostTracker) Call(ctx context.Context, url string, data *telegoapi.RequestData) (*telegoapi.Response, error) {
+	key := costKey{
+		feature: Feature(ctx),
+		method:  path.Base(url),
+	}
+	// read the request before making the call, as callers may drain its buffer
+	var stars int64
+	if key.method == "sendPaidMedia" {
+		stars, _ = strconv.ParseInt(requestField(data, "star_count"), 10, 64)
+	}
+	resp, err := c.caller.Call(ctx, url, data)
+	if err != nil || !resp.Ok {
+		return resp, err
+	}
+	if sc, ok := ctx.(interface{ ChatKey() string }); ok {
+		key.chatKey = sc.ChatKey()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok && len(c.entries) >= c.maxEntries {
+		key.chatKey = OtherChats
+		e, ok = c.entries[key]
+	}
+	if !ok {
+		e = &CostEntry{Feature: key.feature, ChatKey: key.chatKey, Method: key.method}
+		c.entries[key] = e
+	}
+	e.Calls++
+	e.Cost += c.prices[key.method]
+	e.Stars += stars
+	return resp, nil
+}
+
+// Entries returns the counters aggregated by the given dimensions, any of "feature", "chat" and "method".
+// Dimensions not given are left empty in the returned entries. With no dimensions, all counters are returned.
+func (c *CostTracker) Entries(group ...string) []CostEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	aggregated := make(map[costKey]*CostEntry)
+	var keys []costKey
+	for k, e := range c.entries {
+		if len(group) > 0 {
+			if !slices.Contains(group, "feature") {
+				k.feature = ""
+			}
+			if !slices.Contains(group, "chat") {
+				k.chatKey = ""
+			}
+			if !slices.Contains(group, "method") {
+				k.method = ""
+			}
+		}
+		a, ok := aggregated[k]
+		if !ok {
+			a = &CostEntry{Feature: k.feature, ChatKey: k.chatKey, Method: k.method}
+			aggregated[k] = a
+			keys = append(keys, k)
+		}
+		a.Calls += e.Calls
+		a.Cost += e.Cost
+		a.Stars += e.Stars
+	}
+	result := make([]CostEntry, len(keys))
+	for i, k := range keys {
+		result[i] = *aggregated[k]
+	}
+	return result
+}
+
+// Reset clears all counters, such as at the start of a billing period.
+func (c *CostTracker) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[costKey]*CostEntry)
+}
+
+func (c *CostTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	entries := c.Entries(query["group"]...)
+	feature, chat := query.Get("feature"), query.Get("chat")
+	entries = slices.DeleteFunc(entries, func(e CostEntry) bool {
+		return (feature != "" && e.Feature != feature) || (chat != "" && e.ChatKey != chat)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+// requestField returns a parameter of a JSON or multipart request, or an empty string.
+func requestField(data *telegoapi.RequestData, name string) string {
+	if data == nil || data.Buffer == nil {
+		return ""
+	}
+	mediaType, params, err := mime.ParseMediaType(data.ContentType)
+	if err != nil {
+		return ""
+	}
+	if mediaType != "multipart/form-data" {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data.Buffer.Bytes(), &fields) != nil {
+			return ""
+		}
+		return string(fields[name])
+	}
+	reader := multipart.NewReader(bytes.NewReader(data.Buffer.Bytes()), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return ""
+		}
+		if part.FormName() == name {
+			b, _ := io.ReadAll(part)
+			return string(b)
+		}
+	}
+}
+
+// CostOption configures a CostTracker.
+type CostOption func(*CostTracker)
+
+// WithMaxCostEntries sets the number of combinations of feature, chat and method counted separately.
+// Default is 100000.
+func WithMaxCostEntries(n int) CostOption {
+	return func(c *CostTracker) {
+		c.maxEntries = max(n, 1)
+	}
+}
+
+// WithMethodCost sets the cost counted for each successful call of an API method, such as "sendMessage".
+// The unit is up to the operator.
+func WithMethodCost(method string, cost int64) CostOption {
+	return func(c *CostTracker) {
+		c.prices[method] = cost
+	}
+}
+
+type featureKey struct{}
+
+type featureContext struct {
+	Context
+	feature string
+}
+
+func (f featureContext) Value(key any) any {
+	if key == (featureKey{}) {
+		return f.feature
+	}
+	return f.Context.Value(key)
+}
+
+// WithFeature returns a Context attributing API calls made with it to feature, for CostTracker.
+func WithFeature(ctx Context, feature string) Context {
+	return featureContext{Context: ctx, feature: feature}
+}
+
+// Feature returns the feature API calls made with ctx are attributed to.
+func Feature(ctx context.Context) string {
+	feature, _ := ctx.Value(featureKey{}).(string)
+	return feature
+}
@@ -0,0 +1,183 @@
+package nabot
+
+import (
+	"context"
+	"fmt"
+	"github.com/mymmrac/telego"
+	"sync"
+	"time"
+)
+
+// Countdown sends time-boxed questions, such as quiz questions or game turns.
+// The message is edited every Tick to show the remaining time. When the time is up, answers are locked,
+// the inline keyboard of the message is removed and OnTimeout is called, in turn with the updates of the chat
+// when they are handled one at a time with WithOrderedUpdates or WithFairScheduler.
+// Answer handlers call Answer to stop the countdown and check that the answer arrived in time.
+// Each chat has at most one running countdown; starting another one cancels the previous.
+// Register it by pointer so the running countdowns are shared.
+//
+// Example:
+//
+//	countdown := &nabot.Countdown{
+//	    Duration: 30 * time.Second,
+//	    Tick:     5 * time.Second,
+//	    OnTimeout: func(ctx nabot.TransitionContext) error {
+//	        _, err := ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Time is up!"))
+//	        return err
+//	    },
+//	}
+//	// in Render
+//	err := countdown.Start(ctx, tu.Message(ctx.ChatID(), question.Text).WithReplyMarkup(options))
+//	// in the answer handler
+//	if !countdown.Answer(ctx) {
+//	    return nil // too late
+//	}
+type Countdown struct {
+	Duration time.Duration
+	// Tick is the interval between edits of the message. Zero disables edits.
+	Tick time.Duration
+	// Format renders the message text with the remaining time.
+	// Defaults to appending the remaining seconds to the text.
+	Format    func(text string, remaining time.Duration) string
+	OnTimeout func(ctx TransitionContext) error
+
+	mu     sync.Mutex
+	active map[string]*countdownRun
+}
+
+type countdownRun struct {
+	stop chan struct{}
+}
+
+// Start sends the message and starts its countdown. The countdown stops when the context of App.RunContext is done.
+// Outside the updates of an App, such as in the candidate handlers of a Shadow, the message is sent without a countdown.
+// During a transition of a StateHandler using an OutboxStateStorage, the message is committed to the outbox
+// like with QueueMessage, so it is neither edited nor locked, but answers still time out.
+func (c *Countdown) Start(ctx TransitionContext, params *telego.SendMessageParams) error {
+	text := params.Text
+	params.Text = c.format(text, c.Duration)
+	// messageID stays 0 while the message waits in the outbox
+	var messageID int
+	if _, queued := ctx.Value(outboxKey{}).(*outboxBuffer); queued {
+		if err := QueueMessage(ctx, params); err != nil {
+			return err
+		}
+	} else {
+		msg, err := ctx.Bot().SendMessage(ctx, params)
+		if err != nil {
+			return err
+		}
+		messageID = msg.MessageID
+	}
+	values := getUpdateValues(ctx)
+	if values == nil || values.app == nil {
+		return nil
+	}
+	markup, _ := params.ReplyMarkup.(*telego.InlineKeyboardMarkup)
+
+	run := &countdownRun{stop: make(chan struct{})}
+	c.mu.Lock()
+	if c.active == nil {
+		c.active = make(map[string]*countdownRun)
+	}
+	if prev, ok := c.active[ctx.ChatKey()]; ok {
+		close(prev.stop)
+	}
+	c.active[ctx.ChatKey()] = run
+	c.mu.Unlock()
+
+	app := values.app
+	runCtx := app.runCtx
+	if runCtx == nil {
+		runCtx = context.Background()
+	}
+	go c.run(app, app.chatContext(runCtx, ctx.ChatKey(), ctx.ChatID()), run, messageID, text, markup)
+	return nil
+}
+
+// Answer stops the countdown of the current chat.
+// Returns false if no countdown is running, because the time is up or it was already answered.
+func (c *Countdown) Answer(ctx StorageContext) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	run, ok := c.active[ctx.ChatKey()]
+	if !ok {
+		return false
+	}
+	close(run.stop)
+	delete(c.active, ctx.ChatKey())
+	return true
+}
+
+func (c *Countdown) run(app *App, ctx Context, run *countdownRun, messageID int, text string, markup *telego.InlineKeyboardMarkup) {
+	clock := ClockOf(ctx)
+	deadline := clock.Now().Add(c.Duration)
+	for {
+		remaining := deadline.Sub(clock.Now())
+		wait := remaining
+		if c.Tick > 0 && messageID != 0 {
+			wait = min(wait, c.Tick)
+		}
+		select {
+		case <-run.stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-clock.After(wait):
+		}
+		remaining = deadline.Sub(clock.Now())
+		if remaining <= 0 {
+			break
+		}
+		if messageID == 0 {
+			continue
+		}
+		_, err := ctx.Bot().EditMessageText(ctx, &telego.EditMessageTextParams{
+			ChatID:      ctx.ChatID(),
+			MessageID:   messageID,
+			Text:        c.format(text, remaining),
+			ReplyMarkup: markup,
+		})
+		if err != nil {
+			LoggerOf(ctx).Warn("nabot: failed to update countdown", "error", err)
+		}
+	}
+	// the timeout runs in turn with the updates of the chat, so answers queued before it still count
+	app.runInChat(ctx.ChatKey(), func() {
+		c.timeOut(ctx, run, messageID, text)
+	})
+}
+
+func (c *Countdown) timeOut(ctx Context, run *countdownRun, messageID int, text string) {
+	c.mu.Lock()
+	if c.active[ctx.ChatKey()] != run {
+		// answered or replaced before the timeout ran
+		c.mu.Unlock()
+		return
+	}
+	delete(c.active, ctx.ChatKey())
+	c.mu.Unlock()
+
+	if messageID != 0 {
+		_, err := ctx.Bot().EditMessageText(ctx, &telego.EditMessageTextParams{
+			ChatID:    ctx.ChatID(),
+			MessageID: messageID,
+			Text:      c.format(text, 0),
+		})
+		if err != nil {
+			LoggerOf(ctx).Warn("nabot: failed to lock countdown message", "error", err)
+		}
+	}
+	if c.OnTimeout != nil {
+		if err := c.OnTimeout(ctx); err != nil {
+			LoggerOf(ctx).Error("nabot: countdown timeout callback failed", "error", err)
+		}
+	}
+}
+
+func (c *Countdown) format(text string, remaining time.Duration) string {
+	if c.Format != nil {
+		return c.Format(text, remaining)
+	}
+	return fmt.Sprintf("%s\n\n⏳ %d", text, int(remaining.Round(time.Second).Seconds()))
+}
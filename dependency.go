@@ -0,0 +1,74 @@
+package nabot
+
+import (
+	"context"
+	"fmt"
+)
+
+// DependencyKey is a type-safe key for a service provided to handlers with App.Provide,
+// such as a database pool or an API client, instead of package-level globals or closures.
+//
+// Example:
+//
+//	const dbKey nabot.DependencyKey[*sql.DB] = "db"
+//
+//	app.Provide(dbKey, db)
+//
+//	func myHandler(ctx nabot.Context) error {
+//	    db := nabot.Dependency(ctx, dbKey)
+//	    // ...
+//	}
+type DependencyKey[T any] string
+
+func (k DependencyKey[T]) dependencyName() string {
+	return string(k)
+}
+
+func (k DependencyKey[T]) check(value any) bool {
+	_, ok := value.(T)
+	return ok
+}
+
+// dependencyKey is implemented by every DependencyKey.
+type dependencyKey interface {
+	dependencyName() string
+	check(value any) bool
+}
+
+// Provide makes value available to handlers under key, with Dependency and LookupDependency.
+// It panics if value is not of the type of key, or if the App is frozen; see Freeze.
+func (a *App) Provide(key dependencyKey, value any) {
+	if !key.check(value) {
+		panic(fmt.Sprintf("nabot: dependency %q provided with a value of the wrong type %T", key.dependencyName(), value))
+	}
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
+	if a.frozen.Load() {
+		panic("nabot: cannot provide a dependency after the app is frozen")
+	}
+	if a.dependencies == nil {
+		a.dependencies = make(map[string]any)
+	}
+	a.dependencies[key.dependencyName()] = value
+}
+
+// Dependency returns the value provided for key with App.Provide.
+// It panics if none was provided, as that is a configuration error; use LookupDependency for optional ones.
+func Dependency[T any](ctx context.Context, key DependencyKey[T]) T {
+	value, ok := LookupDependency(ctx, key)
+	if !ok {
+		panic(fmt.Sprintf("nabot: dependency %q was not provided", string(key)))
+	}
+	return value
+}
+
+// LookupDependency returns the value provided for key with App.Provide. Returns false if none was provided.
+func LookupDependency[T any](ctx context.Context, key DependencyKey[T]) (T, bool) {
+	var zero T
+	values := getUpdateValues(ctx)
+	if values == nil {
+		return zero, false
+	}
+	value, ok := values.dependencies[string(key)].(T)
+	return value, ok
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"github.com/bale-ir/nabot"
@@ -11,8 +10,6 @@ import (
 	"log"
 	"math/rand"
 	"os"
-	"os/signal"
-	"syscall"
 )
 
 func main() {
@@ -25,26 +22,13 @@ func main() {
 		log.Fatal(err)
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Kill, syscall.SIGTERM, syscall.SIGINT)
-	defer cancel()
-
-	updates, err := bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
-		Timeout: 60,
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	app := nabot.NewApp(bot, updates)
+	app := nabot.NewApp(bot, nil)
 
 	registerHandlers(app)
 
-	go func() {
-		app.Run()
-	}()
-
-	<-ctx.Done()
-	app.Stop()
+	if err = app.RunUntilSignal(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func registerHandlers(app *nabot.App) {
@@ -96,10 +80,10 @@ const (
 میخوای بازم ازت سؤال بپرسم؟ 😃`
 )
 
-const (
-	categoryDataKey    nabot.DataKey[string]   = "category"
-	currentQuestionKey nabot.DataKey[Question] = "currentQuestion"
-)
+const categoryDataKey nabot.DataKey[string] = "category"
+
+// currentQuestionKey is removed when going back from the quiz state
+var currentQuestionKey = nabot.StateData[Question]{State: "quiz", Key: "currentQuestion"}
 
 type mainState struct {
 	nabot.BaseState
@@ -124,14 +108,7 @@ func newMainState() nabot.ChainableState {
 
 func (s *mainState) Render(ctx nabot.TransitionContext) error {
 	text := welcomeMessage
-	// remove keyboard if coming from quiz state
-	if categoryId, err := nabot.Get(ctx, categoryDataKey); err == nil {
-		_, err = ctx.Bot().SendMessage(
-			ctx, tu.Message(ctx.ChatID(), fmt.Sprintf(categoryExitMessage, questions[categoryId].Name)).
-				WithReplyMarkup(tu.ReplyKeyboardRemove()))
-		if err != nil {
-			return err
-		}
+	if _, err := nabot.Get(ctx, categoryDataKey); err == nil {
 		text = changeCategoryMessage
 	} else if !errors.Is(err, nabot.ErrDataKeyNotFound) {
 		return err
@@ -171,8 +148,9 @@ func newQuizState(ToBack nabot.Transition) nabot.ChainableState {
 		HandleFunc: s.handleBack,
 	}
 	s.BaseState = nabot.BaseState{
-		ID:       "quiz",
-		Renderer: s.Render,
+		ID:         "quiz",
+		Renderer:   s.Render,
+		OnExitFunc: s.exit,
 		Handlers: []nabot.Handler{
 			s.againButton,
 			s.backButton,
@@ -193,7 +171,7 @@ func (s *quizState) Render(ctx nabot.TransitionContext) error {
 	}
 	category := questions[categoryId]
 	question := category.Questions[rand.Intn(len(category.Questions))]
-	err = nabot.Set(ctx, currentQuestionKey, question)
+	err = currentQuestionKey.Set(ctx, question)
 	if err != nil {
 		return err
 	}
@@ -213,6 +191,17 @@ func (s *quizState) Render(ctx nabot.TransitionContext) error {
 	return err
 }
 
+// exit removes the keyboard of the quiz when going back to the main state.
+func (s *quizState) exit(ctx nabot.TransitionContext) error {
+	categoryId, err := nabot.Get(ctx, categoryDataKey)
+	if err != nil {
+		return err
+	}
+	return nabot.QueueMessage(
+		ctx, tu.Message(ctx.ChatID(), fmt.Sprintf(categoryExitMessage, questions[categoryId].Name)).
+			WithReplyMarkup(tu.ReplyKeyboardRemove()))
+}
+
 func (s *quizState) handleAgain(ctx nabot.Context) error {
 	return s.Render(ctx) // stay in this state and rerender
 }
@@ -222,7 +211,7 @@ func (s *quizState) handleBack(ctx nabot.Context) error {
 }
 
 func (s *quizState) handleOption(ctx nabot.Context, chosenOption string) error {
-	currentQuestion, err := nabot.Get(ctx, currentQuestionKey)
+	currentQuestion, err := currentQuestionKey.Get(ctx)
 	if err != nil {
 		return err
 	}
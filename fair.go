@@ -0,0 +1,174 @@
+package nabot
+
+import (
+	"github.com/mymmrac/telego"
+	"slices"
+	"sync"
+)
+
+// WithFairScheduler handles updates on a fixed number of workers shared fairly among chats,
+// so a single hyperactive chat cannot monopolize them.
+// Each chat has at most one update being handled at a time and chats with pending updates take turns:
+// a worker handles one update of a chat, then moves on to the next chat in round-robin order.
+// Updates of each chat are handled in the order received and up to bufferPerChat are queued per chat.
+// Updates received while the queue of their chat is full are dropped, logged and reported to the Metrics
+// of the App, so a busy chat never holds up the updates of other chats.
+//
+// The scheduler replaces the Executor and WithOrderedUpdates. Updates without a chat are handed to the Executor.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithFairScheduler(16, 32))
+func WithFairScheduler(workers int, bufferPerChat int) AppOption {
+	return func(a *App) {
+		a.fair = newFairScheduler(max(workers, 1), max(bufferPerChat, 1))
+	}
+}
+
+type fairScheduler struct {
+	workers int
+	buffer  int
+
+	mu      sync.Mutex
+	hasWork *sync.Cond
+	chats   map[string]*fairChat
+	// ready holds the keys of chats with pending updates and no update being handled, in turn order.
+	ready  []string
+	closed bool
+}
+
+type fairChat struct {
+	updates []telego.Update
+	running bool
+}
+
+func newFairScheduler(workers int, buffer int) *fairScheduler {
+	f := &fairScheduler{
+		workers: workers,
+		buffer:  buffer,
+		chats:   make(map[string]*fairChat),
+	}
+	f.hasWork = sync.NewCond(&f.mu)
+	return f
+}
+
+func (a *App) startFair() {
+	f := a.fair
+	f.mu.Lock()
+	f.closed = false
+	f.mu.Unlock()
+	for i := 0; i < f.workers; i++ {
+		go a.fairWorker()
+	}
+}
+
+// stopFair lets the workers exit once the queued updates are handled.
+func (a *App) stopFair() {
+	f := a.fair
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.hasWork.Broadcast()
+}
+
+// dispatchFair queues the update of its chat, dropping it if the chat queue is full.
+func (a *App) dispatchFair(update telego.Update) {
+	chatKey, _, ok := a.extractChatInfo(update)
+	if !ok {
+		a.dispatch(update)
+		return
+	}
+	a.enqueueFair(chatKey, update, true)
+}
+
+// enqueueFair queues the update of the chat. If bounded, the update is dropped if the chat queue is full.
+// It returns false if the update is not queued, because it is dropped or the scheduler is stopped.
+func (a *App) enqueueFair(chatKey string, update telego.Update, bounded bool) bool {
+	f := a.fair
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return false
+	}
+	c, exists := f.chats[chatKey]
+	if bounded && exists && len(c.updates) >= f.buffer {
+		f.mu.Unlock()
+		a.dropChatUpdate(update)
+		return false
+	}
+	defer f.mu.Unlock()
+	if !exists {
+		c = &fairChat{}
+		f.chats[chatKey] = c
+	}
+	a.wg.Add(1)
+	queued := queuedUpdate(update)
+	c.updates = append(c.updates, queued)
+	if adm := admissionOf(update); adm != nil {
+		adm.remove = func() {
+			a.removeFair(chatKey, queued)
+		}
+	}
+	if !c.running && len(c.updates) == 1 {
+		f.ready = append(f.ready, chatKey)
+		f.hasWork.Signal()
+	}
+	return true
+}
+
+func (a *App) fairWorker() {
+	f := a.fair
+	for {
+		f.mu.Lock()
+		for len(f.ready) == 0 && !f.closed {
+			f.hasWork.Wait()
+		}
+		if len(f.ready) == 0 {
+			f.mu.Unlock()
+			return
+		}
+		chatKey := f.ready[0]
+		f.ready = f.ready[1:]
+		c := f.chats[chatKey]
+		update := c.updates[0]
+		c.updates = c.updates[1:]
+		c.running = true
+		f.mu.Unlock()
+
+		a.processUpdate(update)
+		a.wg.Done()
+
+		f.mu.Lock()
+		c.running = false
+		if len(c.updates) > 0 {
+			f.ready = append(f.ready, chatKey)
+			f.hasWork.Signal()
+		} else {
+			delete(f.chats, chatKey)
+		}
+		f.mu.Unlock()
+	}
+}
+
+// removeFair removes a dropped update from the queue of its chat, if it is still queued.
+func (a *App) removeFair(chatKey string, update telego.Update) {
+	f := a.fair
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.chats[chatKey]
+	if !ok {
+		return
+	}
+	i := indexOfAdmission(c.updates, admissionOf(update))
+	if i < 0 {
+		return
+	}
+	c.updates = slices.Delete(c.updates, i, i+1)
+	a.wg.Done()
+	if len(c.updates) == 0 && !c.running {
+		delete(f.chats, chatKey)
+		f.ready = slices.DeleteFunc(f.ready, func(key string) bool {
+			return key == chatKey
+		})
+	}
+}
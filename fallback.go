@@ -0,0 +1,299 @@
+package nabot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FallbackDataStore wraps a DataStorage and keeps handlers working while it is unavailable.
+// When the primary storage fails, reads and writes are served by an in-memory shadow store
+// and writes are queued. Once the primary storage recovers, queued writes are replayed in order
+// and the shadow store is dropped. Only the last write of each key is queued, and up to 10000 writes
+// are queued in total; beyond that the oldest ones are dropped and logged, see WithFallbackMaxPending.
+// If the primary storage implements DataTimestamps, writes older than the stored value,
+// such as one written meanwhile by another instance, are not replayed.
+//
+// While unavailable, keys that were never written to the shadow store are read from the primary storage;
+// if that fails too, ErrDataKeyNotFound is returned so handlers can continue with defaults.
+//
+// Example:
+//
+//	store := nabot.NewFallbackDataStore(redisStore)
+//	app := nabot.NewApp(bot, updates, nabot.WithDataStore(store))
+//	// ...
+//	app.StorageHealthy() // false while redis is down
+type FallbackDataStore struct {
+	primary       DataStorage
+	logger        *slog.Logger
+	clock         Clock
+	retryInterval time.Duration
+	maxPending    int
+
+	mu        sync.Mutex
+	healthy   bool
+	nextRetry time.Time
+	// recovering is set while a caller replays the pending writes.
+	recovering bool
+	// replaying is the number of pending writes being replayed, which stay queued until they are applied.
+	replaying int
+	shadow    map[string]*shadowChat
+	pending   []storageOp
+}
+
+// DataTimestamps is implemented by a DataStorage recording when each value was last written,
+// such as in an updated_at column. FallbackDataStore uses it to skip replaying writes older than the stored value.
+type DataTimestamps interface {
+	// DataWrittenAt returns when the value was last written. Returns ErrDataKeyNotFound if it is not set.
+	DataWrittenAt(ctx context.Context, chatKey string, dataKey string) (time.Time, error)
+}
+
+type shadowChat struct {
+	data    map[string]any
+	removed map[string]bool
+	cleared bool
+}
+
+type storageOp struct {
+	chatKey string
+	dataKey string
+	value   any
+	remove  bool
+	clear   bool
+	// at is when the write was made.
+	at time.Time
+}
+
+// NewFallbackDataStore creates a FallbackDataStore wrapping primary.
+func NewFallbackDataStore(primary DataStorage, options ...FallbackOption) *FallbackDataStore {
+	f := &FallbackDataStore{
+		primary:       primary,
+		logger:        slog.Default(),
+		clock:         SystemClock,
+		retryInterval: 5 * time.Second,
+		maxPending:    10000,
+		healthy:       true,
+		shadow:        make(map[string]*shadowChat),
+	}
+	for _, option := range options {
+		option(f)
+	}
+	return f
+}
+
+// Healthy reports whether the primary storage is in use.
+func (f *FallbackDataStore) Healthy() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.healthy
+}
+
+func (f *FallbackDataStore) SetData(ctx context.Context, chatKey string, dataKey string, value any) error {
+	return f.write(ctx, storageOp{chatKey: chatKey, dataKey: dataKey, value: value})
+}
+
+func (f *FallbackDataStore) RemoveData(ctx context.Context, chatKey string, dataKey string) error {
+	return f.write(ctx, storageOp{chatKey: chatKey, dataKey: dataKey, remove: true})
+}
+
+func (f *FallbackDataStore) ClearData(ctx context.Context, chatKey string) error {
+	return f.write(ctx, storageOp{chatKey: chatKey, clear: true})
+}
+
+func (f *FallbackDataStore) GetData(ctx context.Context, chatKey string, dataKey string, pointer any) error {
+	f.recover(ctx)
+	f.mu.Lock()
+	var v any
+	var found, gone bool
+	if c, ok := f.shadow[chatKey]; ok && !f.healthy {
+		v, found = c.data[dataKey]
+		gone = c.cleared || c.removed[dataKey]
+	}
+	f.mu.Unlock()
+	if found {
+		return assignValue(v, pointer, nil)
+	}
+	if gone {
+		return ErrDataKeyNotFound
+	}
+
+	err := f.primary.GetData(ctx, chatKey, dataKey, pointer)
+	if err == nil || errors.Is(err, ErrDataKeyNotFound) {
+		return err
+	}
+	f.mu.Lock()
+	f.markUnhealthy(err)
+	f.mu.Unlock()
+	return ErrDataKeyNotFound
+}
+
+func (f *FallbackDataStore) write(ctx context.Context, op storageOp) error {
+	op.at = f.clock.Now()
+	f.recover(ctx)
+	f.mu.Lock()
+	healthy := f.healthy
+	f.mu.Unlock()
+
+	if healthy {
+		err := op.apply(ctx, f.primary)
+		if err == nil {
+			return nil
+		}
+		f.mu.Lock()
+		f.markUnhealthy(err)
+		f.mu.Unlock()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.applyShadow(op)
+	f.enqueue(op)
+	return nil
+}
+
+// enqueue queues op for replay, dropping the queued writes it supersedes and, if the queue is full,
+// the oldest write not being replayed. Must be called with f.mu held.
+func (f *FallbackDataStore) enqueue(op storageOp) {
+	queued := slices.DeleteFunc(f.pending[f.replaying:], func(p storageOp) bool {
+		return p.chatKey == op.chatKey && !p.clear && (op.clear || p.dataKey == op.dataKey)
+	})
+	f.pending = f.pending[:f.replaying+len(queued)]
+	if len(f.pending) >= f.maxPending && len(f.pending) > f.replaying {
+		dropped := f.pending[f.replaying]
+		f.pending = slices.Delete(f.pending, f.replaying, f.replaying+1)
+		f.logger.Error("nabot: too many writes waiting for the data storage; dropping the oldest",
+			slog.String("chat", dropped.chatKey),
+			slog.String("key", dropped.dataKey),
+		)
+	}
+	f.pending = append(f.pending, op)
+}
+
+// recover replays pending writes if the retry interval has passed. The writes are replayed without holding f.mu,
+// so other calls keep being served by the shadow store meanwhile; writes queued during the replay are replayed
+// too before switching back to the primary storage. Only one caller replays at a time.
+func (f *FallbackDataStore) recover(ctx context.Context) {
+	f.mu.Lock()
+	if f.healthy || f.recovering || f.clock.Now().Before(f.nextRetry) {
+		f.mu.Unlock()
+		return
+	}
+	f.recovering = true
+	for len(f.pending) > 0 {
+		batch := slices.Clone(f.pending)
+		f.replaying = len(batch)
+		f.mu.Unlock()
+		replayed, err := replay(ctx, f.primary, batch)
+		f.mu.Lock()
+		f.replaying = 0
+		f.pending = f.pending[replayed:]
+		if err != nil {
+			f.nextRetry = f.clock.Now().Add(f.retryInterval)
+			f.recovering = false
+			f.mu.Unlock()
+			return
+		}
+	}
+	f.healthy = true
+	f.recovering = false
+	f.pending = nil
+	f.shadow = make(map[string]*shadowChat)
+	f.mu.Unlock()
+	f.logger.Info("nabot: data storage recovered")
+}
+
+// replay applies ops to store in order and returns how many were applied before the first error.
+// Writes older than the value in store are skipped, if it implements DataTimestamps.
+func replay(ctx context.Context, store DataStorage, ops []storageOp) (int, error) {
+	times, _ := store.(DataTimestamps)
+	for i, op := range ops {
+		if times != nil && !op.clear {
+			at, err := times.DataWrittenAt(ctx, op.chatKey, op.dataKey)
+			if err == nil && at.After(op.at) {
+				continue
+			}
+			if err != nil && !errors.Is(err, ErrDataKeyNotFound) {
+				return i, err
+			}
+		}
+		if err := op.apply(ctx, store); err != nil {
+			return i, err
+		}
+	}
+	return len(ops), nil
+}
+
+// markUnhealthy switches to the shadow store. Must be called with f.mu held.
+func (f *FallbackDataStore) markUnhealthy(err error) {
+	if f.healthy {
+		f.logger.Error("nabot: data storage unavailable; falling back to memory", "error", err)
+	}
+	f.healthy = false
+	f.nextRetry = f.clock.Now().Add(f.retryInterval)
+}
+
+func (f *FallbackDataStore) applyShadow(op storageOp) {
+	c, ok := f.shadow[op.chatKey]
+	if !ok || op.clear {
+		c = &shadowChat{data: make(map[string]any), removed: make(map[string]bool)}
+		f.shadow[op.chatKey] = c
+	}
+	switch {
+	case op.clear:
+		c.cleared = true
+	case op.remove:
+		delete(c.data, op.dataKey)
+		c.removed[op.dataKey] = true
+	default:
+		c.data[op.dataKey] = op.value
+		delete(c.removed, op.dataKey)
+	}
+}
+
+func (o storageOp) apply(ctx context.Context, store DataStorage) error {
+	switch {
+	case o.clear:
+		return store.ClearData(ctx, o.chatKey)
+	case o.remove:
+		return store.RemoveData(ctx, o.chatKey, o.dataKey)
+	default:
+		return store.SetData(ctx, o.chatKey, o.dataKey, o.value)
+	}
+}
+
+// FallbackOption configures a FallbackDataStore.
+type FallbackOption func(*FallbackDataStore)
+
+// WithFallbackRetryInterval sets how long to wait before retrying the primary storage after a failure.
+// Default is 5 seconds.
+func WithFallbackRetryInterval(interval time.Duration) FallbackOption {
+	return func(f *FallbackDataStore) {
+		f.retryInterval = interval
+	}
+}
+
+// WithFallbackMaxPending sets how many writes are queued while the primary storage is unavailable.
+// Default is 10000.
+func WithFallbackMaxPending(n int) FallbackOption {
+	return func(f *FallbackDataStore) {
+		f.maxPending = max(n, 1)
+	}
+}
+
+// WithFallbackLogger sets the logger reporting storage failures and recoveries.
+func WithFallbackLogger(logger *slog.Logger) FallbackOption {
+	return func(f *FallbackDataStore) {
+		f.logger = logger
+	}
+}
+
+// WithFallbackClock sets the clock used for retry scheduling.
+// Default is SystemClock.
+func WithFallbackClock(clock Clock) FallbackOption {
+	return func(f *FallbackDataStore) {
+		f.clock = clock
+	}
+}
@@ -0,0 +1,25 @@
+package nabot
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInjectedFault is returned by storage calls failed by fault injection.
+	ErrInjectedFault = errors.New("injected fault")
+)
+
+// FaultConfig configures fault injection for resilience testing; see WithFaultInjection.
+// Rates are probabilities between 0 and 1.
+type FaultConfig struct {
+	// DelayRate is the rate of updates delayed before being handled, by up to MaxDelay.
+	DelayRate float64
+	MaxDelay  time.Duration
+	// StorageFailureRate is the rate of DataStorage calls failing with ErrInjectedFault.
+	StorageFailureRate float64
+	// APIFailureRate is the rate of API calls answered with a simulated error
+	// by a caller created with FaultInjectingCaller. Half of them are 429 Too Many Requests
+	// and half are 500 Internal Server Error.
+	APIFailureRate float64
+}
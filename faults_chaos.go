@@ -0,0 +1,182 @@
+//go:build !production
+
+package nabot
+
+import (
+	"context"
+	"github.com/mymmrac/telego/telegoapi"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+)
+
+// WithFaultInjection injects faults to verify that retry and error paths work:
+// updates are randomly delayed and DataStorage calls randomly fail.
+// Use FaultInjectingCaller to also simulate API errors.
+//
+// Fault injection is compiled out of builds with the production build tag, where this option does nothing.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithFaultInjection(nabot.FaultConfig{
+//	    DelayRate:          0.1,
+//	    MaxDelay:           2 * time.Second,
+//	    StorageFailureRate: 0.05,
+//	}))
+func WithFaultInjection(config FaultConfig) AppOption {
+	return func(a *App) {
+		a.faults = &config
+	}
+}
+
+// FaultInjectingCaller wraps caller to answer a rate of API calls with simulated errors,
+// as configured by config.APIFailureRate. Pass it to the bot with telego.WithAPICaller.
+// In builds with the production build tag, caller is returned unchanged.
+func FaultInjectingCaller(caller telegoapi.Caller, config FaultConfig) telegoapi.Caller {
+	return faultyCaller{caller: caller, rate: config.APIFailureRate}
+}
+
+// applyFaults wraps the dependencies of the App configured to fail. Called once all options are applied.
+func (a *App) applyFaults() {
+	if a.faults == nil {
+		return
+	}
+	a.logger.Warn("nabot: fault injection is enabled")
+	if a.faults.StorageFailureRate > 0 {
+		a.dataStore = faultyDataStore(a.dataStore, a.faults.StorageFailureRate)
+	}
+}
+
+// injectDelay randomly delays handling of the update.
+func (a *App) injectDelay(ctx Context) {
+	if a.faults == nil || a.faults.MaxDelay <= 0 || rand.Float64() >= a.faults.DelayRate {
+		return
+	}
+	delay := rand.N(a.faults.MaxDelay)
+	ctx.Logger().Debug("nabot: injecting delay", slog.Duration("delay", delay))
+	select {
+	case <-a.clock.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+type faultyStore struct {
+	DataStorage
+	rate float64
+}
+
+func (f faultyStore) fail() bool {
+	return rand.Float64() < f.rate
+}
+
+func (f faultyStore) SetData(ctx context.Context, chatKey string, dataKey string, value any) error {
+	if f.fail() {
+		return ErrInjectedFault
+	}
+	return f.DataStorage.SetData(ctx, chatKey, dataKey, value)
+}
+
+func (f faultyStore) GetData(ctx context.Context, chatKey string, dataKey string, pointer any) error {
+	if f.fail() {
+		return ErrInjectedFault
+	}
+	return f.DataStorage.GetData(ctx, chatKey, dataKey, pointer)
+}
+
+func (f faultyStore) RemoveData(ctx context.Context, chatKey string, dataKey string) error {
+	if f.fail() {
+		return ErrInjectedFault
+	}
+	return f.DataStorage.RemoveData(ctx, chatKey, dataKey)
+}
+
+func (f faultyStore) ClearData(ctx context.Context, chatKey string) error {
+	if f.fail() {
+		return ErrInjectedFault
+	}
+	return f.DataStorage.ClearData(ctx, chatKey)
+}
+
+// Healthy reports the health of the wrapped store, as returned by App.StorageHealthy.
+func (f faultyStore) Healthy() bool {
+	if h, ok := f.DataStorage.(interface{ Healthy() bool }); ok {
+		return h.Healthy()
+	}
+	return true
+}
+
+// Close closes the wrapped store if it implements io.Closer.
+func (f faultyStore) Close() error {
+	if c, ok := f.DataStorage.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// faultyDataStore wraps store to fail a rate of calls, keeping the BlobStorage and WatchableStorage
+// implementations of store, so blobs and watches keep working with fault injection.
+func faultyDataStore(store DataStorage, rate float64) DataStorage {
+	s := faultyStore{DataStorage: store, rate: rate}
+	blob, isBlob := store.(BlobStorage)
+	watch, isWatch := store.(WatchableStorage)
+	switch {
+	case isBlob && isWatch:
+		return struct {
+			faultyStore
+			BlobStorage
+			dataWatcher
+		}{s, blob, faultyWatcher{watch: watch, rate: rate}}
+	case isBlob:
+		return struct {
+			faultyStore
+			BlobStorage
+		}{s, blob}
+	case isWatch:
+		return struct {
+			faultyStore
+			dataWatcher
+		}{s, faultyWatcher{watch: watch, rate: rate}}
+	}
+	return s
+}
+
+// faultyWatcher fails a rate of the watches of a WatchableStorage.
+type faultyWatcher struct {
+	watch dataWatcher
+	rate  float64
+}
+
+func (f faultyWatcher) WatchData(ctx context.Context, chatKey string, dataKey string, notify func()) error {
+	if rand.Float64() < f.rate {
+		return ErrInjectedFault
+	}
+	return f.watch.WatchData(ctx, chatKey, dataKey, notify)
+}
+
+type faultyCaller struct {
+	caller telegoapi.Caller
+	rate   float64
+}
+
+func (f faultyCaller) Call(ctx context.Context, url string, data *telegoapi.RequestData) (*telegoapi.Response, error) {
+	if rand.Float64() >= f.rate {
+		return f.caller.Call(ctx, url, data)
+	}
+	if rand.IntN(2) == 0 {
+		return &telegoapi.Response{
+			Ok: false,
+			Error: &telegoapi.Error{
+				ErrorCode:   429,
+				Description: "Too Many Requests: retry after 1 (injected)",
+				Parameters:  &telegoapi.ResponseParameters{RetryAfter: 1},
+			},
+		}, nil
+	}
+	return &telegoapi.Response{
+		Ok: false,
+		Error: &telegoapi.Error{
+			ErrorCode:   500,
+			Description: "Internal Server Error (injected)",
+		},
+	}, nil
+}
@@ -0,0 +1,21 @@
+//go:build production
+
+package nabot
+
+import (
+	"github.com/mymmrac/telego/telegoapi"
+)
+
+// WithFaultInjection does nothing in builds with the production build tag.
+func WithFaultInjection(FaultConfig) AppOption {
+	return func(*App) {}
+}
+
+// FaultInjectingCaller returns caller unchanged in builds with the production build tag.
+func FaultInjectingCaller(caller telegoapi.Caller, _ FaultConfig) telegoapi.Caller {
+	return caller
+}
+
+func (a *App) applyFaults() {}
+
+func (a *App) injectDelay(Context) {}
@@ -0,0 +1,170 @@
+// Package format formats numbers, prices and percentages for Persian-speaking users.
+//
+// Numbers are written with Persian digits, the Persian thousands separator and decimal separator.
+// Prices are stored in rials, the official currency unit, and can be displayed in rials or tomans
+// (1 toman = 10 rials), as most users expect.
+//
+// Example:
+//
+//	format.Number(1250000)                 // "۱٬۲۵۰٬۰۰۰"
+//	format.Price(1250000, format.Toman)    // "۱۲۵٬۰۰۰ تومان"
+//	format.Percent(0.125, 1)               // "۱۲٫۵٪"
+//
+// FuncMap makes the helpers available in text/template and html/template.
+package format
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	thousandsSeparator = '٬'
+	decimalSeparator   = '٫'
+	percentSign        = '٪'
+)
+
+var (
+	// ErrInvalidNumber is returned by ParseNumber for text that is not a number.
+	ErrInvalidNumber = errors.New("invalid number")
+)
+
+// Currency is a unit prices are displayed in.
+type Currency int
+
+const (
+	Rial Currency = iota
+	Toman
+)
+
+// String returns the Persian name of the currency.
+func (c Currency) String() string {
+	if c == Toman {
+		return "تومان"
+	}
+	return "ریال"
+}
+
+// digitsReplacer maps ASCII digits to Persian digits.
+var digitsReplacer = strings.NewReplacer(
+	"0", "۰", "1", "۱", "2", "۲", "3", "۳", "4", "۴",
+	"5", "۵", "6", "۶", "7", "۷", "8", "۸", "9", "۹",
+)
+
+// Digits replaces the ASCII digits of s with Persian digits.
+func Digits(s string) string {
+	return digitsReplacer.Replace(s)
+}
+
+// Number formats n with Persian digits and thousands separators.
+func Number(n int64) string {
+	return Digits(group(strconv.FormatInt(n, 10)))
+}
+
+// Decimal formats f with precision digits after the decimal separator.
+func Decimal(f float64, precision int) string {
+	s := strconv.FormatFloat(f, 'f', precision, 64)
+	integer, fraction, hasFraction := strings.Cut(s, ".")
+	s = group(integer)
+	if hasFraction {
+		s += string(decimalSeparator) + fraction
+	}
+	return Digits(s)
+}
+
+// Percent formats the ratio f as a percentage with precision digits after the decimal separator;
+// 0.5 is formatted as "۵۰٪".
+func Percent(f float64, precision int) string {
+	return Decimal(f*100, precision) + string(percentSign)
+}
+
+// Price formats a price given in rials in the currency c, followed by the currency name.
+// Tomans are rounded down.
+func Price(rials int64, c Currency) string {
+	amount := rials
+	if c == Toman {
+		amount = RialToToman(rials)
+	}
+	return Number(amount) + " " + c.String()
+}
+
+// RialToToman converts rials to tomans, rounding down.
+func RialToToman(rials int64) int64 {
+	return rials / 10
+}
+
+// TomanToRial converts tomans to rials.
+func TomanToRial(tomans int64) int64 {
+	return tomans * 10
+}
+
+// ParseNumber parses a whole number typed by a user. Persian, Arabic and ASCII digits are accepted,
+// as are thousands separators, commas and spaces between digits.
+func ParseNumber(s string) (int64, error) {
+	var sb strings.Builder
+	for i, r := range strings.TrimSpace(s) {
+		switch {
+		case r >= '0' && r <= '9':
+			sb.WriteRune(r)
+		case r >= '۰' && r <= '۹':
+			sb.WriteRune('0' + r - '۰')
+		case r >= '٠' && r <= '٩':
+			sb.WriteRune('0' + r - '٠')
+		case r == thousandsSeparator || r == ',' || r == '،' || r == ' ':
+		case (r == '-' || r == '+') && i == 0:
+			sb.WriteRune(r)
+		default:
+			return 0, ErrInvalidNumber
+		}
+	}
+	n, err := strconv.ParseInt(sb.String(), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidNumber
+	}
+	return n, nil
+}
+
+// FuncMap returns the helpers as template functions:
+// digits, number, decimal, percent, rials and tomans, the last two formatting a price in rials.
+//
+// Example:
+//
+//	tmpl := template.Must(template.New("invoice").Funcs(format.FuncMap()).Parse(
+//	    "Total: {{tomans .TotalRials}}",
+//	))
+func FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"digits":  Digits,
+		"number":  Number,
+		"decimal": Decimal,
+		"percent": Percent,
+		"rials": func(rials int64) string {
+			return Price(rials, Rial)
+		},
+		"tomans": func(rials int64) string {
+			return Price(rials, Toman)
+		},
+	}
+}
+
+// group inserts thousands separators into a decimal integer.
+func group(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= 3 {
+		return sign + s
+	}
+	var sb strings.Builder
+	sb.WriteString(sign)
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			sb.WriteRune(thousandsSeparator)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -2,7 +2,10 @@ module github.com/bale-ir/nabot
 
 go 1.24.7
 
-require github.com/mymmrac/telego v1.3.0
+require (
+	github.com/mymmrac/telego v1.3.0
+	golang.org/x/text v0.28.0
+)
 
 require (
 	github.com/andybalholm/brotli v1.2.0 // indirect
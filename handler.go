@@ -5,6 +5,9 @@ import (
 	"errors"
 	"github.com/mymmrac/telego"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
 )
 
 var (
@@ -23,6 +26,99 @@ type Handler interface {
 	Handle(ctx Context) error
 }
 
+// TypedHandler is a Handler that only handles some update types.
+// App routes an update only to the handlers that can handle its type,
+// instead of calling every handler in turn, which matters for bots with many handlers.
+// Handlers not implementing TypedHandler receive all updates.
+type TypedHandler interface {
+	Handler
+	// UpdateTypes returns the handled update types, as returned by GetTypeOfUpdate.
+	UpdateTypes() []string
+}
+
+// Chain composes handlers into a single Handler.
+// The handlers are called in order until one returns an error other than ErrPass,
+// exactly as if they were registered one by one with App.Handle.
+// If all handlers pass, the chain returns ErrPass.
+// Useful for shipping pre-composed feature bundles that can be added to any App with one Handle call.
+// The chain is named after its handlers, like chain(ban,stats); use NamedChain to name it.
+//
+// Example:
+//
+//	adminFeatures := nabot.Chain(
+//	    handlers.Filter(isAdmin),
+//	    banCommand,
+//	    statsCommand,
+//	)
+//	app.Handle(adminFeatures)
+func Chain(handlers ...Handler) Handler {
+	names := make([]string, len(handlers))
+	for i, h := range handlers {
+		names[i] = h.Name()
+	}
+	return NamedChain("chain("+strings.Join(names, ",")+")", handlers...)
+}
+
+// NamedChain composes handlers into a single Handler like Chain, named name in logs and metrics.
+//
+// Example:
+//
+//	app.Handle(nabot.NamedChain("admin", handlers.Filter(isAdmin), banCommand, statsCommand))
+func NamedChain(name string, handlers ...Handler) Handler {
+	return chain{name: name, handlers: handlers}
+}
+
+type chain struct {
+	name     string
+	handlers []Handler
+}
+
+func (c chain) Name() string {
+	return c.name
+}
+
+// UpdateTypes returns the union of the update types of the handlers in the chain.
+func (c chain) UpdateTypes() []string {
+	var types []string
+	for _, h := range c.handlers {
+		th, ok := h.(TypedHandler)
+		if !ok {
+			return updateTypes
+		}
+		for _, t := range th.UpdateTypes() {
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+func (c chain) Handle(ctx Context) error {
+	_, err := runChain(ctx, c.handlers, nil)
+	return err
+}
+
+// runChain calls handlers in order until one returns an error other than ErrPass.
+// It returns the last called handler and its error. If wrap is not nil, it is applied to ctx for each handler.
+func runChain(ctx Context, handlers []Handler, wrap func(ctx Context, h Handler) Context) (Handler, error) {
+	var err error
+	var handler Handler
+	for _, h := range handlers {
+		handler = h
+		hctx := ctx
+		if wrap != nil {
+			hctx = wrap(ctx, h)
+		}
+		err = h.Handle(hctx)
+		if errors.Is(err, ErrPass) {
+			continue
+		}
+		break
+	}
+	return handler, err
+}
+
 // Context wraps a bot update and provides access to Bot, DataStorage, and other utilities.
 // It also implements context.Context for standard context operations.
 //
@@ -50,6 +146,45 @@ type nativeContext struct {
 	chatKey   string
 	chatID    telego.ChatID
 	logger    *slog.Logger
+	clock     Clock
+	values    updateValues
+	// chatLogger is logger with the chat field, created on first use.
+	chatLogger atomic.Pointer[slog.Logger]
+}
+
+// updateValuesKey is the context key of the updateValues of the update.
+type updateValuesKey struct{}
+
+// updateValues are the values of the App used by helpers during an update.
+// They are stored in nativeContext instead of context.WithValue to save allocations.
+type updateValues struct {
+	annotations map[string]Label
+	replies     *replyRegistry
+	// shadow records the API calls of the update when it is mirrored; see Shadow.
+	shadow *callRecording
+	// stacks keeps the stack writes of the update when it is mirrored; see Shadow.
+	stacks *stateOverlay
+	// dependencies are the values provided with App.Provide.
+	dependencies map[string]any
+	// app is the App handling the update, nil for the candidate handlers of a Shadow.
+	app *App
+}
+
+func (n *nativeContext) Value(key any) any {
+	switch key {
+	case updateValuesKey{}:
+		return &n.values
+	case clockKey{}:
+		return n.clock
+	case loggerKey{}:
+		return n.Logger()
+	}
+	return n.Context.Value(key)
+}
+
+func getUpdateValues(ctx context.Context) *updateValues {
+	v, _ := ctx.Value(updateValuesKey{}).(*updateValues)
+	return v
 }
 
 func (n *nativeContext) Bot() *telego.Bot {
@@ -73,7 +208,24 @@ func (n *nativeContext) Store() DataStorage {
 }
 
 func (n *nativeContext) Logger() *slog.Logger {
-	return n.logger
+	if l := n.chatLogger.Load(); l != nil {
+		return l
+	}
+	l := n.logger.With(slog.String("chat", n.chatID.String()))
+	n.chatLogger.Store(l)
+	return l
+}
+
+// loggerKey is the context key of the logger of the chat of the update.
+type loggerKey struct{}
+
+// loggerOf returns the logger of the chat the context belongs to, such as for a TransitionContext,
+// which has no Logger method. Other contexts get slog.Default().
+func LoggerOf(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
 }
 
 type wrappedLogger struct {
@@ -93,3 +245,23 @@ func ContextWithLogger(ctx Context, logger *slog.Logger) Context {
 		logger:  logger,
 	}
 }
+
+// labeledContext runs a handler or state: API calls made with it are attributed to name as their feature,
+// and its logger has name as the field key. The logger is only created if used,
+// as most handlers of the chain pass without logging.
+type labeledContext struct {
+	Context
+	key  string
+	name string
+}
+
+func (l *labeledContext) Logger() *slog.Logger {
+	return l.Context.Logger().With(slog.String(l.key, l.name))
+}
+
+func (l *labeledContext) Value(key any) any {
+	if key == (featureKey{}) {
+		return l.name
+	}
+	return l.Context.Value(key)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Role is a named permission granted to a user, such as "admin".
+type Role string
+
+// RoleProvider returns the roles of the sender of the current update, or of the current chat
+// if there is no update, such as when rendering a state.
+// ctx is a nabot.Context when called while handling an update,
+// so implementations can type assert it to inspect the sender.
+type RoleProvider interface {
+	Roles(ctx nabot.TransitionContext) ([]Role, error)
+}
+
+// RoleFunc adapts a function to RoleProvider.
+type RoleFunc func(ctx nabot.TransitionContext) ([]Role, error)
+
+func (f RoleFunc) Roles(ctx nabot.TransitionContext) ([]Role, error) {
+	return f(ctx)
+}
+
+// hasAnyRole reports whether the chat has at least one of the required roles.
+// Always true if nothing is required.
+func hasAnyRole(ctx nabot.TransitionContext, provider RoleProvider, require []Role) (bool, error) {
+	if len(require) == 0 {
+		return true, nil
+	}
+	if provider == nil {
+		return false, nil
+	}
+	roles, err := provider.Roles(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range require {
+		if slices.Contains(roles, r) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// KeyboardItem is an InlineButton together with the text and data of one rendered button.
+// Create it with InlineButton.Item.
+type KeyboardItem struct {
+	Button InlineButton
+	Text   string
+	Data   string
+}
+
+// InlineKeyboard builds an inline keyboard, omitting buttons the current chat is not allowed to use.
+// Rows left empty are dropped.
+//
+// Example:
+//
+//	markup, err := handlers.InlineKeyboard(ctx,
+//	    []handlers.KeyboardItem{viewButton.Item("View", id)},
+//	    []handlers.KeyboardItem{deleteButton.Item("Delete", id)}, // only shown to admins
+//	)
+func InlineKeyboard(ctx nabot.TransitionContext, rows ...[]KeyboardItem) (*telego.InlineKeyboardMarkup, error) {
+	markup := &telego.InlineKeyboardMarkup{}
+	for _, row := range rows {
+		var buttons []telego.InlineKeyboardButton
+		for _, item := range row {
+			ok, err := item.Button.Allowed(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if item.Button.PayloadTTL > 0 {
+				button, err := item.Button.StoredButton(ctx, item.Text, item.Data)
+				if err != nil {
+					return nil, err
+				}
+				buttons = append(buttons, button)
+			} else {
+				buttons = append(buttons, item.Button.ButtonWithText(item.Text, item.Data))
+			}
+		}
+		if len(buttons) > 0 {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+		}
+	}
+	return markup, nil
+}
+
+// Access wraps inner to handle only updates whose sender has at least one of the require roles,
+// as returned by roles, such as for admin-only commands. Roles belong to users, not chats: in a group,
+// each member is checked on their own. Other updates are passed on with nabot.ErrPass.
+// The wrapped handler keeps the name and update types of inner.
+//
+// Example:
+//
+//	roles := handlers.StorageRoles{}
+//	app.Handle(handlers.Access(handlers.Command{Command: "broadcast", HandleFunc: broadcast}, roles, "admin"))
+//	// grant the role, such as in a /promote command:
+//	err := roles.Grant(ctx, userID, "admin")
+func Access(inner nabot.Handler, roles RoleProvider, require ...Role) nabot.Handler {
+	return nabot.Wrap(inner, RequireRoles(roles, nil, require...))
+}
+
+// RequireRoles returns a nabot.Middleware handling only updates whose sender has at least one of the require
+// roles; see Access. Other updates are passed to onDenied, or on with nabot.ErrPass if nil.
+//
+// Example:
+//
+//	app.Handle(nabot.Wrap(broadcastCommand, handlers.RequireRoles(roles, func(ctx nabot.Context) error {
+//	    _, err := ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Admins only."))
+//	    return err
+//	}, "admin")))
+func RequireRoles(roles RoleProvider, onDenied func(ctx nabot.Context) error, require ...Role) nabot.Middleware {
+	return nabot.MiddlewareFunc(func(ctx nabot.Context, next nabot.Handler) error {
+		allowed, err := hasAnyRole(ctx, roles, require)
+		if err != nil {
+			return err
+		}
+		if allowed {
+			return next.Handle(ctx)
+		}
+		if onDenied != nil {
+			return onDenied(ctx)
+		}
+		return nabot.ErrPass
+	})
+}
+
+// rolesChatKey is the chat key of the DataStorage namespace holding the roles granted with StorageRoles.
+const rolesChatKey = "nabot:roles"
+
+// StorageRoles is a RoleProvider keeping roles granted to users in the DataStorage.
+// The roles of the sender of the update are returned, or of the current chat if the sender is unknown,
+// such as when rendering a state; in private chats they are the same.
+// Grant and Revoke are serialized within the process, so concurrent changes of a user's roles are not lost.
+type StorageRoles struct{}
+
+// rolesMu serializes the changes of roles, which are read and written back.
+var rolesMu sync.Mutex
+
+func (s StorageRoles) Roles(ctx nabot.TransitionContext) ([]Role, error) {
+	id := ctx.ChatID().ID
+	if c, ok := ctx.(nabot.Context); ok {
+		if sender, ok := nabot.UpdateSender(c.Update()); ok {
+			id = sender.ID
+		}
+	}
+	return s.UserRoles(ctx, id)
+}
+
+// UserRoles returns the roles granted to the user.
+func (s StorageRoles) UserRoles(ctx nabot.StorageContext, userID int64) ([]Role, error) {
+	roles, err := nabot.Get(nabot.ForChat(ctx, rolesChatKey), rolesKey(userID))
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return nil, nil
+	}
+	return roles, err
+}
+
+// Grant grants roles to the user.
+func (s StorageRoles) Grant(ctx nabot.StorageContext, userID int64, roles ...Role) error {
+	rolesMu.Lock()
+	defer rolesMu.Unlock()
+	current, err := s.UserRoles(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, r := range roles {
+		if !slices.Contains(current, r) {
+			current = append(current, r)
+		}
+	}
+	return nabot.Set(nabot.ForChat(ctx, rolesChatKey), rolesKey(userID), current)
+}
+
+// Revoke revokes roles from the user.
+func (s StorageRoles) Revoke(ctx nabot.StorageContext, userID int64, roles ...Role) error {
+	rolesMu.Lock()
+	defer rolesMu.Unlock()
+	current, err := s.UserRoles(ctx, userID)
+	if err != nil {
+		return err
+	}
+	current = slices.DeleteFunc(current, func(r Role) bool {
+		return slices.Contains(roles, r)
+	})
+	if len(current) == 0 {
+		return nabot.Remove(nabot.ForChat(ctx, rolesChatKey), rolesKey(userID))
+	}
+	return nabot.Set(nabot.ForChat(ctx, rolesChatKey), rolesKey(userID), current)
+}
+
+func rolesKey(userID int64) nabot.DataKey[[]Role] {
+	return nabot.DataKey[[]Role](strconv.FormatInt(userID, 10))
+}
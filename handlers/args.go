@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CommandArgs handles a command whose arguments are parsed into a struct of type T.
+// Fields of T are described with struct tags:
+//
+//   - `arg:"name"` is a required positional argument, in field order.
+//   - `arg:"name,optional"` is an optional positional argument. Only trailing positionals can be optional.
+//   - `arg:"name"` on a []string field collects all remaining positional arguments.
+//   - `flag:"name"` is a flag given as --name value or --name=value. Bool flags take no value.
+//
+// Supported field types are string, bool, int, int64, uint, uint64, float64, time.Duration and []string.
+// Durations are given like 10m or 1h30m.
+// Arguments can be quoted with "" or '' to contain spaces, as can the values of --name=value flags.
+// Quotes only group words when they are balanced and at the start and end of the argument,
+// so apostrophes, as in don't, are kept as they are.
+// On bad input, the usage text is sent to the chat and HandleFunc is not called.
+//
+// Example:
+//
+//	type banArgs struct {
+//	    User   string `arg:"user"`
+//	    Days   int    `arg:"days,optional"`
+//	    Silent bool   `flag:"silent"`
+//	    Reason string `flag:"reason"`
+//	}
+//
+//	app.Handle(handlers.CommandArgs[banArgs]{
+//	    Command: "ban",
+//	    HandleFunc: func(ctx nabot.Context, args banArgs) error {
+//	        // '/ban alice 3 --reason "spam bot"' sets User, Days and Reason
+//	        return nil
+//	    },
+//	})
+//
+// Aliases and BotUsername match commands like for Command.
+type CommandArgs[T any] struct {
+	Command string
+	Aliases []string
+	// BotUsername is the username of the bot, without @.
+	BotUsername string
+	// Usage is sent on parse errors. Defaults to a usage line generated from T.
+	Usage      string
+	HandleFunc func(ctx nabot.Context, args T) error
+}
+
+func (c CommandArgs[T]) Name() string {
+	return c.command().Name()
+}
+
+func (c CommandArgs[T]) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (c CommandArgs[T]) Handle(ctx nabot.Context) error {
+	return c.command().Handle(ctx)
+}
+
+// command returns the Command matching the commands of c, splitting their arguments like ParseArgs.
+func (c CommandArgs[T]) command() Command {
+	return Command{
+		Command:     c.Command,
+		Aliases:     c.Aliases,
+		BotUsername: c.BotUsername,
+		Separator: func(_ string, text string) []string {
+			_, rest, _ := botCommand(text, "")
+			return splitArgs(rest)
+		},
+		HandleFunc: c.handleArgs,
+	}
+}
+
+func (c CommandArgs[T]) handleArgs(ctx nabot.Context, tokens []string) error {
+	args, err := parseArgTokens[T](tokens)
+	if err != nil {
+		usage := c.Usage
+		if usage == "" {
+			usage = ArgsUsage[T](c.Name())
+		}
+		_, sendErr := ctx.Bot().SendMessage(ctx, &telego.SendMessageParams{
+			ChatID: ctx.ChatID(),
+			Text:   err.Error() + "\n" + usage,
+		})
+		return sendErr
+	}
+	return c.HandleFunc(ctx, args)
+}
+
+// ArgsError is returned by ParseArgs when the input does not match the argument spec.
+type ArgsError struct {
+	Reason string
+}
+
+func (e *ArgsError) Error() string {
+	return e.Reason
+}
+
+func argsErrorf(format string, a ...any) error {
+	return &ArgsError{Reason: fmt.Sprintf(format, a...)}
+}
+
+// ParseArgs parses command arguments into a struct of type T.
+// See CommandArgs for the supported struct tags.
+// Returns an *ArgsError if the input is invalid. Panics if T is not a valid argument struct.
+func ParseArgs[T any](text string) (T, error) {
+	return parseArgTokens[T](splitArgs(text))
+}
+
+// parseArgTokens parses command arguments split by splitArgs into a struct of type T.
+func parseArgTokens[T any](tokens []string) (T, error) {
+	var result T
+	spec := argsSpecOf(reflect.TypeFor[T]())
+	v := reflect.ValueOf(&result).Elem()
+
+	var positionals []string
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		name, ok := strings.CutPrefix(tok, "--")
+		if !ok || name == "" {
+			positionals = append(positionals, tok)
+			continue
+		}
+		name, value, hasValue := strings.Cut(name, "=")
+		f, ok := spec.flags[name]
+		if !ok {
+			return result, argsErrorf("unknown flag --%s", name)
+		}
+		field := v.Field(f.index)
+		if field.Kind() == reflect.Bool && !hasValue {
+			field.SetBool(true)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(tokens) {
+				return result, argsErrorf("flag --%s requires a value", name)
+			}
+			i++
+			value = tokens[i]
+		}
+		if err := setArg(field, value); err != nil {
+			return result, argsErrorf("invalid value for --%s: %v", name, err)
+		}
+	}
+
+	for i, p := range spec.positionals {
+		field := v.Field(p.index)
+		if field.Kind() == reflect.Slice {
+			field.Set(reflect.ValueOf(positionals[min(i, len(positionals)):]))
+			positionals = nil
+			break
+		}
+		if i >= len(positionals) {
+			if p.optional {
+				break
+			}
+			return result, argsErrorf("missing argument <%s>", p.name)
+		}
+		if err := setArg(field, positionals[i]); err != nil {
+			return result, argsErrorf("invalid value for <%s>: %v", p.name, err)
+		}
+	}
+	if len(positionals) > len(spec.positionals) {
+		return result, argsErrorf("too many arguments")
+	}
+	return result, nil
+}
+
+// ArgsUsage returns a usage line for a command with arguments of type T.
+//
+// Example:
+//
+//	handlers.ArgsUsage[banArgs]("/ban") // "/ban <user> [days] [--silent] [--reason <string>]"
+func ArgsUsage[T any](command string) string {
+	spec := argsSpecOf(reflect.TypeFor[T]())
+	var b strings.Builder
+	b.WriteString(command)
+	for _, p := range spec.positionals {
+		switch {
+		case p.typ.Kind() == reflect.Slice:
+			fmt.Fprintf(&b, " [%s...]", p.name)
+		case p.optional:
+			fmt.Fprintf(&b, " [%s]", p.name)
+		default:
+			fmt.Fprintf(&b, " <%s>", p.name)
+		}
+	}
+	for _, f := range spec.flagOrder {
+		if f.typ.Kind() == reflect.Bool {
+			fmt.Fprintf(&b, " [--%s]", f.name)
+		} else {
+			fmt.Fprintf(&b, " [--%s <%s>]", f.name, argTypeName(f.typ))
+		}
+	}
+	return b.String()
+}
+
+type argField struct {
+	name     string
+	index    int
+	typ      reflect.Type
+	optional bool
+}
+
+type argsSpec struct {
+	positionals []argField
+	flags       map[string]argField
+	flagOrder   []argField
+}
+
+func argsSpecOf(t reflect.Type) argsSpec {
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("nabot: command arguments must be a struct, got %v", t))
+	}
+	spec := argsSpec{flags: make(map[string]argField)}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if tag, ok := sf.Tag.Lookup("arg"); ok {
+			name, opts, _ := strings.Cut(tag, ",")
+			f := argField{name: name, index: i, typ: sf.Type, optional: opts == "optional"}
+			if n := len(spec.positionals); n > 0 {
+				prev := spec.positionals[n-1]
+				if prev.typ.Kind() == reflect.Slice {
+					panic(fmt.Sprintf("nabot: argument %q follows variadic argument %q", name, prev.name))
+				}
+				if prev.optional && !f.optional && f.typ.Kind() != reflect.Slice {
+					panic(fmt.Sprintf("nabot: required argument %q follows optional argument %q", name, prev.name))
+				}
+			}
+			checkArgType(sf)
+			spec.positionals = append(spec.positionals, f)
+		} else if tag, ok := sf.Tag.Lookup("flag"); ok {
+			f := argField{name: tag, index: i, typ: sf.Type}
+			if sf.Type.Kind() == reflect.Slice {
+				panic(fmt.Sprintf("nabot: flag %q cannot be a slice", tag))
+			}
+			checkArgType(sf)
+			spec.flags[tag] = f
+			spec.flagOrder = append(spec.flagOrder, f)
+		}
+	}
+	return spec
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// argTypeName returns the name of an argument type for usage lines.
+func argTypeName(t reflect.Type) string {
+	if t == durationType {
+		return "duration"
+	}
+	return t.Kind().String()
+}
+
+func checkArgType(sf reflect.StructField) {
+	switch sf.Type.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Float64:
+		return
+	case reflect.Slice:
+		if sf.Type.Elem().Kind() == reflect.String {
+			return
+		}
+	}
+	panic(fmt.Sprintf("nabot: unsupported argument type %v for field %s", sf.Type, sf.Name))
+}
+
+func setArg(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("expected true or false")
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if field.Type() == durationType {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return errors.New("expected a duration like 10m or 1h30m")
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("expected an integer")
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return errors.New("expected a non-negative integer")
+		}
+		field.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("expected a number")
+		}
+		field.SetFloat(f)
+	}
+	return nil
+}
+
+// splitArgs splits text on whitespace, keeping quoted strings together. A quote opens a group at the start
+// of an argument or after the = of a --name=value flag, if it is closed by the same quote followed by
+// whitespace or the end of text. Other quotes are literal.
+func splitArgs(text string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inToken := false
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsSpace(r) {
+			if inToken {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+			i += size
+			continue
+		}
+		if (r == '"' || r == '\'') && (!inToken || isFlagValueStart(cur.String())) {
+			if end := closingQuote(text, i+size, r); end >= 0 {
+				cur.WriteString(text[i+size : end])
+				inToken = true
+				i = end + size
+				continue
+			}
+		}
+		cur.WriteRune(r)
+		inToken = true
+		i += size
+	}
+	if inToken {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// isFlagValueStart reports whether token is a flag waiting for its value, like --name=.
+func isFlagValueStart(token string) bool {
+	return strings.HasPrefix(token, "--") && strings.HasSuffix(token, "=")
+}
+
+// closingQuote returns the index of the quote closing a group opened before from, the first one followed by
+// whitespace or the end of text, or -1 if there is none.
+func closingQuote(text string, from int, quote rune) int {
+	for i := from; i < len(text); {
+		j := strings.IndexRune(text[i:], quote)
+		if j < 0 {
+			return -1
+		}
+		end := i + j
+		next, _ := utf8.DecodeRuneInString(text[end+1:])
+		if end+1 == len(text) || unicode.IsSpace(next) {
+			return end
+		}
+		i = end + 1
+	}
+	return -1
+}
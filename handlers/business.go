@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// BusinessMessage handles messages received by the business accounts connected to the bot.
+// Replies must be sent with the BusinessConnectionID of the message to be sent on behalf of the account.
+// The chat key of business updates is distinct from the private chat of the same user with the bot;
+// see nabot.DefaultChatKeyAndID.
+//
+// Example:
+//
+//	app.Handle(handlers.BusinessMessage{
+//	    HandlerName: "away",
+//	    HandleFunc: func(ctx nabot.Context, msg telego.Message) error {
+//	        _, err := ctx.Bot().SendMessage(ctx, tu.Message(msg.Chat.ChatID(), "I'm away, I'll reply soon.").
+//	            WithBusinessConnectionID(msg.BusinessConnectionID))
+//	        return err
+//	    },
+//	})
+type BusinessMessage struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, msg telego.Message) error
+}
+
+func (b BusinessMessage) Name() string {
+	return b.HandlerName
+}
+
+func (b BusinessMessage) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeBusinessMessage}
+}
+
+func (b BusinessMessage) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().BusinessMessage
+	if msg == nil {
+		return nabot.ErrPass
+	}
+	return b.HandleFunc(ctx, *msg)
+}
+
+// EditedBusinessMessage handles messages edited in the chats of the business accounts connected to the bot.
+type EditedBusinessMessage struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, msg telego.Message) error
+}
+
+func (e EditedBusinessMessage) Name() string {
+	return e.HandlerName
+}
+
+func (e EditedBusinessMessage) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeEditedBusinessMessage}
+}
+
+func (e EditedBusinessMessage) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().EditedBusinessMessage
+	if msg == nil {
+		return nabot.ErrPass
+	}
+	return e.HandleFunc(ctx, *msg)
+}
+
+// DeletedBusinessMessages handles messages deleted from the chats of the business accounts connected to the bot.
+// HandleFunc receives the chat and the IDs of the deleted messages.
+//
+// Example:
+//
+//	app.Handle(handlers.DeletedBusinessMessages{
+//	    HandlerName: "forget_deleted",
+//	    HandleFunc: func(ctx nabot.Context, chat telego.Chat, messageIDs []int) error {
+//	        return archive.Delete(ctx, chat.ID, messageIDs)
+//	    },
+//	})
+type DeletedBusinessMessages struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, chat telego.Chat, messageIDs []int) error
+}
+
+func (d DeletedBusinessMessages) Name() string {
+	return d.HandlerName
+}
+
+func (d DeletedBusinessMessages) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeDeletedBusinessMessages}
+}
+
+func (d DeletedBusinessMessages) Handle(ctx nabot.Context) error {
+	deleted := ctx.Update().DeletedBusinessMessages
+	if deleted == nil {
+		return nabot.ErrPass
+	}
+	return d.HandleFunc(ctx, deleted.Chat, deleted.MessageIDs)
+}
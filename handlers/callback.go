@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"regexp"
+	"strings"
+)
+
+// Callback handles callback queries of any inline button, and answers them once HandleFunc returns,
+// even with an error, so users are not left with a loading button. HandleFunc must not answer them itself.
+// Set Prefix to handle only data starting with it; HandleFunc then receives the data following it.
+// Set Pattern to handle only data matching it, after Prefix. AnswerText is shown to the user, as an alert if ShowAlert is set.
+// For buttons of a single handler, see InlineButton.
+//
+// Example:
+//
+//	app.Handle(handlers.Callback{
+//	    HandlerName: "stale_buttons",
+//	    AnswerText:  "This button has expired.",
+//	    HandleFunc: func(ctx nabot.Context, data string) error {
+//	        return nil
+//	    },
+//	}, nabot.WithPriority(-100))
+type Callback struct {
+	HandlerName string
+	Prefix      string
+	Pattern     *regexp.Regexp
+	HandleFunc  func(ctx nabot.Context, data string) error
+	AnswerText  string
+	ShowAlert   bool
+}
+
+func (c Callback) Name() string {
+	return c.HandlerName
+}
+
+func (c Callback) UpdateTypes() []string {
+	return callbackUpdates
+}
+
+func (c Callback) Handle(ctx nabot.Context) error {
+	data, ok := nabot.CallbackData(ctx.Update())
+	if !ok {
+		return nabot.ErrPass
+	}
+	if data, ok = strings.CutPrefix(data, c.Prefix); !ok {
+		return nabot.ErrPass
+	}
+	if c.Pattern != nil && !c.Pattern.MatchString(data) {
+		return nabot.ErrPass
+	}
+	err := c.HandleFunc(ctx, data)
+	if errors.Is(err, nabot.ErrPass) {
+		return err
+	}
+	answerErr := ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{
+		CallbackQueryID: ctx.Update().CallbackQuery.ID,
+		Text:            c.AnswerText,
+		ShowAlert:       c.ShowAlert,
+	})
+	return errors.Join(err, answerErr)
+}
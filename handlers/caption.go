@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// Caption handles media messages with a caption, whatever the media.
+// HandleFunc receives the caption and the message carrying the media.
+// Set Match to handle only matching captions; HandleFunc then receives the remainder of the caption, see TextMatch.
+// To handle commands in captions, see Command.InCaptions.
+//
+// Example:
+//
+//	app.Handle(handlers.Caption{
+//	    HandlerName: "tag_media",
+//	    Match:       handlers.TextMatch{Mode: handlers.MatchPrefix, Value: "#"},
+//	    HandleFunc: func(ctx nabot.Context, tag string, msg telego.Message) error {
+//	        return gallery.Tag(ctx, msg.MessageID, tag)
+//	    },
+//	})
+type Caption struct {
+	HandlerName string
+	Match       TextMatch
+	HandleFunc  func(ctx nabot.Context, caption string, msg telego.Message) error
+}
+
+func (c Caption) Name() string {
+	return c.HandlerName
+}
+
+func (c Caption) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (c Caption) Handle(ctx nabot.Context) error {
+	caption, ok := nabot.MessageCaption(ctx.Update())
+	if !ok {
+		return nabot.ErrPass
+	}
+	rest, ok := c.Match.Match(caption)
+	if !ok {
+		return nabot.ErrPass
+	}
+	return c.HandleFunc(ctx, rest, *ctx.Update().Message)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// ChatType wraps inner to handle only updates of chats of one of types, such as telego.ChatTypePrivate.
+// Other updates, and updates without a chat, are passed on with nabot.ErrPass.
+// The wrapped handler keeps the name and update types of inner.
+//
+// Example:
+//
+//	app.Handle(handlers.ChatType(handlers.Command{
+//	    Command:    "settings",
+//	    HandleFunc: showSettings,
+//	}, telego.ChatTypePrivate))
+func ChatType(inner nabot.Handler, types ...string) nabot.Handler {
+	return nabot.Wrap(inner, nabot.RequireChatType(types...))
+}
+
+// Private wraps inner to handle only updates of private chats; see ChatType.
+func Private(inner nabot.Handler) nabot.Handler {
+	return ChatType(inner, telego.ChatTypePrivate)
+}
+
+// Group wraps inner to handle only updates of groups and supergroups; see ChatType.
+func Group(inner nabot.Handler) nabot.Handler {
+	return ChatType(inner, telego.ChatTypeGroup, telego.ChatTypeSupergroup)
+}
+
+// Channel wraps inner to handle only updates of channels; see ChatType.
+func Channel(inner nabot.Handler) nabot.Handler {
+	return ChatType(inner, telego.ChatTypeChannel)
+}
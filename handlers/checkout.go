@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"strings"
+)
+
+// Checkout ties together the steps of selling something with Bale payments:
+// sending the invoice, validating the pre-checkout query, fulfilling the order once paid
+// and sending a receipt.
+//
+// Fulfillment is idempotent: each payment, identified by its charge ID, is fulfilled at most once
+// even if the successful payment message is delivered again. The payment is marked in progress before
+// Fulfill is called, so if the bot stops while fulfilling, the payment is not fulfilled again on redelivery
+// but logged as interrupted, to be checked by hand.
+// Deliveries of the same payment are serialized by charge ID; register it by pointer so they share the locks.
+//
+// Checkout handles the pre-checkout queries and successful payments whose invoice payload starts with
+// PayloadPrefix. With an empty PayloadPrefix it handles all of them, so handlers registered after it,
+// such as SuccessfulPayment, never see any payment; set PayloadPrefix to use them side by side.
+//
+// Example:
+//
+//	checkout := &handlers.Checkout{
+//	    HandlerName:   "checkout",
+//	    PayloadPrefix: "shop:",
+//	    Validate: func(ctx nabot.Context, query telego.PreCheckoutQuery) error {
+//	        if !inStock(query.InvoicePayload) {
+//	            return errors.New("out of stock")
+//	        }
+//	        return nil
+//	    },
+//	    Fulfill: func(ctx nabot.Context, payment telego.SuccessfulPayment) error {
+//	        return shipOrder(ctx, payment.InvoicePayload)
+//	    },
+//	    Receipt: func(ctx nabot.Context, payment telego.SuccessfulPayment) string {
+//	        return "Thanks for your purchase!"
+//	    },
+//	}
+//	app.Handle(checkout)
+//	// later, in a handler:
+//	checkout.SendInvoice(ctx, tu.Invoice(...))
+type Checkout struct {
+	HandlerName string
+	// PayloadPrefix is the prefix of the invoice payloads handled. If empty, all payments are handled.
+	PayloadPrefix string
+	// Validate is called for pre-checkout queries. A non-nil error rejects the payment
+	// and its message is shown to the user. If nil, all payments are accepted.
+	Validate func(ctx nabot.Context, query telego.PreCheckoutQuery) error
+	// Fulfill is called once for each successful payment.
+	Fulfill func(ctx nabot.Context, payment telego.SuccessfulPayment) error
+	// Receipt renders the message sent after fulfillment. If nil, no receipt is sent.
+	Receipt func(ctx nabot.Context, payment telego.SuccessfulPayment) string
+
+	locks nabot.KeyedMutex
+}
+
+func (c *Checkout) Name() string {
+	return c.HandlerName
+}
+
+func (c *Checkout) UpdateTypes() []string {
+	return []string{nabot.UpdateTypePreCheckoutQuery, nabot.UpdateTypeMessage}
+}
+
+func (c *Checkout) Handle(ctx nabot.Context) error {
+	update := ctx.Update()
+	if q := update.PreCheckoutQuery; q != nil && strings.HasPrefix(q.InvoicePayload, c.PayloadPrefix) {
+		return c.answerPreCheckout(ctx, *q)
+	}
+	if update.Message != nil {
+		if p := update.Message.SuccessfulPayment; p != nil && strings.HasPrefix(p.InvoicePayload, c.PayloadPrefix) {
+			return c.fulfill(ctx, *p)
+		}
+	}
+	return nabot.ErrPass
+}
+
+// SendInvoice sends the invoice to the current chat. The payload of params should start with PayloadPrefix.
+func (c *Checkout) SendInvoice(ctx nabot.TransitionContext, params *telego.SendInvoiceParams) (*telego.Message, error) {
+	invoice := *params
+	invoice.ChatID = ctx.ChatID()
+	return ctx.Bot().SendInvoice(ctx, &invoice)
+}
+
+func (c *Checkout) answerPreCheckout(ctx nabot.Context, query telego.PreCheckoutQuery) error {
+	params := &telego.AnswerPreCheckoutQueryParams{
+		PreCheckoutQueryID: query.ID,
+		Ok:                 true,
+	}
+	if c.Validate != nil {
+		if err := c.Validate(ctx, query); err != nil {
+			params.Ok = false
+			params.ErrorMessage = err.Error()
+		}
+	}
+	return ctx.Bot().AnswerPreCheckoutQuery(ctx, params)
+}
+
+func (c *Checkout) fulfill(ctx nabot.Context, payment telego.SuccessfulPayment) error {
+	key := nabot.DataKey[bool]("checkout_fulfilled:" + payment.TelegramPaymentChargeID)
+	inProgressKey := nabot.DataKey[bool]("checkout_fulfilling:" + payment.TelegramPaymentChargeID)
+
+	unlock := c.locks.Lock(payment.TelegramPaymentChargeID)
+	defer unlock()
+	_, err := nabot.Get(ctx, key)
+	if err == nil {
+		ctx.Logger().Warn("nabot: payment already fulfilled; skipping",
+			"charge_id", payment.TelegramPaymentChargeID,
+		)
+		return nil
+	}
+	if !errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return err
+	}
+	_, err = nabot.Get(ctx, inProgressKey)
+	if err == nil {
+		ctx.Logger().Error("nabot: payment fulfillment was interrupted; check it by hand",
+			"charge_id", payment.TelegramPaymentChargeID,
+		)
+		return nil
+	}
+	if !errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return err
+	}
+	if err = nabot.Set(ctx, inProgressKey, true); err != nil {
+		return err
+	}
+	if c.Fulfill != nil {
+		if err = c.Fulfill(ctx, payment); err != nil {
+			// the payment was not fulfilled, so a redelivery may try again
+			return errors.Join(err, nabot.Remove(ctx, inProgressKey))
+		}
+	}
+	if err = nabot.Set(ctx, key, true); err != nil {
+		return err
+	}
+	if err = nabot.Remove(ctx, inProgressKey); err != nil {
+		return err
+	}
+
+	if c.Receipt == nil {
+		return nil
+	}
+	_, err = ctx.Bot().SendMessage(ctx, &telego.SendMessageParams{
+		ChatID: ctx.ChatID(),
+		Text:   c.Receipt(ctx, payment),
+	})
+	return err
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// Contact handles shared contacts. HandleFunc receives the phone number and the user ID of the contact,
+// which is zero if the contact is not a Bale user, and the full contact.
+// Set OwnOnly for phone verification: only the sender's own contact, as shared with the keyboard button
+// created by Button, is handled, and contacts of others are passed to OnOthers, or on with nabot.ErrPass if nil.
+//
+// Example:
+//
+//	verify := handlers.Contact{
+//	    HandlerName: "verify_phone",
+//	    OwnOnly:     true,
+//	    HandleFunc: func(ctx nabot.Context, phone string, userID int64, contact telego.Contact) error {
+//	        return accounts.SetPhone(ctx, userID, phone)
+//	    },
+//	}
+//	app.Handle(verify)
+//	// ask for the contact:
+//	ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Please share your phone number.").
+//	    WithReplyMarkup(verify.Keyboard("Share my phone number")))
+type Contact struct {
+	HandlerName string
+	OwnOnly     bool
+	HandleFunc  func(ctx nabot.Context, phone string, userID int64, contact telego.Contact) error
+	OnOthers    func(ctx nabot.Context, contact telego.Contact) error
+}
+
+func (c Contact) Name() string {
+	return c.HandlerName
+}
+
+func (c Contact) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (c Contact) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.Contact == nil {
+		return nabot.ErrPass
+	}
+	contact := *msg.Contact
+	if c.OwnOnly && (msg.From == nil || contact.UserID != msg.From.ID) {
+		if c.OnOthers != nil {
+			return c.OnOthers(ctx, contact)
+		}
+		return nabot.ErrPass
+	}
+	return c.HandleFunc(ctx, contact.PhoneNumber, contact.UserID, contact)
+}
+
+// Button creates a reply keyboard button asking the user to share their own contact.
+func (c Contact) Button(text string) telego.KeyboardButton {
+	return telego.KeyboardButton{Text: text, RequestContact: true}
+}
+
+// Keyboard creates a one-time reply keyboard with the button created by Button.
+func (c Contact) Keyboard(text string) *telego.ReplyKeyboardMarkup {
+	return &telego.ReplyKeyboardMarkup{
+		Keyboard:        [][]telego.KeyboardButton{{c.Button(text)}},
+		ResizeKeyboard:  true,
+		OneTimeKeyboard: true,
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+)
+
+// Dice handles animated dice messages, such as dice, darts or slot machine rolls.
+// HandleFunc receives the emoji of the roll, such as telego.EmojiDice or telego.EmojiSlotMachine,
+// and its value, from 1 to 6 for dice and darts and from 1 to 64 for slot machines.
+// Set Emoji to handle only rolls of that emoji.
+//
+// Example:
+//
+//	app.Handle(handlers.Dice{
+//	    HandlerName: "darts",
+//	    Emoji:       telego.EmojiDarts,
+//	    HandleFunc: func(ctx nabot.Context, emoji string, value int) error {
+//	        if value == 6 {
+//	            _, err := ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Bullseye!"))
+//	            return err
+//	        }
+//	        return nil
+//	    },
+//	})
+type Dice struct {
+	HandlerName string
+	Emoji       string
+	HandleFunc  func(ctx nabot.Context, emoji string, value int) error
+}
+
+func (d Dice) Name() string {
+	return d.HandlerName
+}
+
+func (d Dice) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (d Dice) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.Dice == nil || (d.Emoji != "" && msg.Dice.Emoji != d.Emoji) {
+		return nabot.ErrPass
+	}
+	return d.HandleFunc(ctx, msg.Dice.Emoji, msg.Dice.Value)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"strings"
+)
+
+// DraftPart is one message added to a draft.
+type DraftPart struct {
+	Text string `json:"text,omitempty"`
+	// PhotoFileID is the file ID of the largest size of the photo, if the message was a photo.
+	PhotoFileID string `json:"photo_file_id,omitempty"`
+}
+
+// DraftContent is the content accumulated in a draft.
+type DraftContent struct {
+	Parts []DraftPart `json:"parts"`
+}
+
+// Text returns the texts and captions of the parts joined by blank lines.
+func (d DraftContent) Text() string {
+	var texts []string
+	for _, part := range d.Parts {
+		if part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// Photos returns the file IDs of the photos in the draft.
+func (d DraftContent) Photos() []string {
+	var photos []string
+	for _, part := range d.Parts {
+		if part.PhotoFileID != "" {
+			photos = append(photos, part.PhotoFileID)
+		}
+	}
+	return photos
+}
+
+// Draft accumulates the text and photo messages of a chat into a draft stored in its DataStorage,
+// until the user sends DoneText, usually by pressing the button returned by DoneButton.
+// The combined draft is then passed to HandleFunc and removed from storage.
+// Use it in the state of flows such as "send us your ad": the draft survives restarts.
+// Only text and photo messages are added, each photo of an album as its own part; other messages,
+// such as videos, documents or voice messages, are passed to the next handler.
+// Messages of a chat are added one at a time, so the photos of an album, delivered as concurrent updates,
+// are all kept; with several App instances sharing the DataStorage, route each chat to a single instance.
+//
+// Example:
+//
+//	draft := handlers.Draft{
+//	    HandlerName: "ad_draft",
+//	    DoneText:    "Done",
+//	    HandleFunc: func(ctx nabot.Context, content handlers.DraftContent) error {
+//	        return submitAd(ctx, content.Text(), content.Photos())
+//	    },
+//	}
+//	// in Render
+//	tu.Message(ctx.ChatID(), "Send the text and photos of your ad, then press Done.").
+//	    WithReplyMarkup(tu.Keyboard(tu.KeyboardRow(draft.DoneButton())).WithResizeKeyboard())
+type Draft struct {
+	HandlerName string
+	DoneText    string
+	// MaxParts limits the number of messages in a draft. Messages beyond it are ignored. Zero means no limit.
+	MaxParts   int
+	HandleFunc func(ctx nabot.Context, content DraftContent) error
+}
+
+func (d Draft) Name() string {
+	return d.HandlerName
+}
+
+func (d Draft) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (d Draft) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil {
+		return nabot.ErrPass
+	}
+	unlock := draftLocks.Lock(ctx.ChatKey() + ":" + d.HandlerName)
+	defer unlock()
+	if msg.Text != "" && nabot.NormalizeText(msg.Text) == nabot.NormalizeText(d.DoneText) {
+		content, err := d.Get(ctx)
+		if err != nil {
+			return err
+		}
+		if err = d.HandleFunc(ctx, content); err != nil {
+			return err
+		}
+		return d.Discard(ctx)
+	}
+
+	var part DraftPart
+	switch {
+	case msg.Text != "":
+		part.Text = msg.Text
+	case len(msg.Photo) > 0:
+		part.PhotoFileID = msg.Photo[len(msg.Photo)-1].FileID
+		part.Text = msg.Caption
+	default:
+		return nabot.ErrPass
+	}
+	content, err := d.Get(ctx)
+	if err != nil {
+		return err
+	}
+	if d.MaxParts > 0 && len(content.Parts) >= d.MaxParts {
+		ctx.Logger().Warn("nabot: draft is full; ignoring message", "max_parts", d.MaxParts)
+		return nil
+	}
+	content.Parts = append(content.Parts, part)
+	return nabot.Set(ctx, d.key(), content)
+}
+
+// Get returns the draft of the current chat. The draft is empty if nothing was added yet.
+func (d Draft) Get(ctx nabot.StorageContext) (DraftContent, error) {
+	content, err := nabot.Get(ctx, d.key())
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return DraftContent{}, nil
+	}
+	return content, err
+}
+
+// Discard removes the draft of the current chat, such as when the user cancels the flow.
+func (d Draft) Discard(ctx nabot.StorageContext) error {
+	return nabot.Remove(ctx, d.key())
+}
+
+// DoneButton creates the reply keyboard button that completes the draft.
+func (d Draft) DoneButton() telego.KeyboardButton {
+	return telego.KeyboardButton{
+		Text: d.DoneText,
+	}
+}
+
+// draftLocks serializes the read-modify-write of the drafts of each chat.
+var draftLocks nabot.KeyedMutex
+
+func (d Draft) key() nabot.DataKey[DraftContent] {
+	return nabot.DataKey[DraftContent]("draft:" + d.HandlerName)
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"container/list"
+	"context"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"sync"
+)
+
+var editedUpdates = []string{nabot.UpdateTypeEditedMessage}
+
+// MessageCache keeps recent messages, so handlers of edited messages can compare them with the original.
+// Fill it with CacheMessages.
+type MessageCache interface {
+	Put(ctx context.Context, msg telego.Message) error
+	// Get returns the cached message. Returns false if it is not cached.
+	Get(ctx context.Context, chatID int64, messageID int) (telego.Message, bool, error)
+}
+
+// NewMemoryMessageCache creates a MessageCache keeping the last size messages in memory.
+func NewMemoryMessageCache(size int) MessageCache {
+	return &memoryMessageCache{
+		size:     max(size, 1),
+		order:    list.New(),
+		messages: make(map[messageRef]*list.Element),
+	}
+}
+
+type messageRef struct {
+	chatID    int64
+	messageID int
+}
+
+type memoryMessageCache struct {
+	size     int
+	mu       sync.Mutex
+	order    *list.List
+	messages map[messageRef]*list.Element
+}
+
+func (m *memoryMessageCache) Put(_ context.Context, msg telego.Message) error {
+	ref := messageRef{chatID: msg.Chat.ID, messageID: msg.MessageID}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.messages[ref]; ok {
+		e.Value = msg
+		m.order.MoveToFront(e)
+		return nil
+	}
+	m.messages[ref] = m.order.PushFront(msg)
+	if m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		old := oldest.Value.(telego.Message)
+		delete(m.messages, messageRef{chatID: old.Chat.ID, messageID: old.MessageID})
+	}
+	return nil
+}
+
+func (m *memoryMessageCache) Get(_ context.Context, chatID int64, messageID int) (telego.Message, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.messages[messageRef{chatID: chatID, messageID: messageID}]
+	if !ok {
+		return telego.Message{}, false, nil
+	}
+	return e.Value.(telego.Message), true, nil
+}
+
+// CacheMessages puts every message into Cache and passes it on with nabot.ErrPass.
+// Register it before other handlers, so edits of any message can be compared with the original.
+//
+// Example:
+//
+//	cache := handlers.NewMemoryMessageCache(10000)
+//	app.Handle(handlers.CacheMessages{Cache: cache}, nabot.WithPriority(100))
+//	app.Handle(handlers.EditedText{HandlerName: "rescan", Cache: cache, HandleFunc: rescan})
+type CacheMessages struct {
+	Cache MessageCache
+}
+
+func (c CacheMessages) Name() string {
+	return "cache_messages"
+}
+
+func (c CacheMessages) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (c CacheMessages) Handle(ctx nabot.Context) error {
+	if msg := ctx.Update().Message; msg != nil {
+		if err := c.Cache.Put(ctx, *msg); err != nil {
+			ctx.Logger().Warn("nabot: failed to cache message", "error", err)
+		}
+	}
+	return nabot.ErrPass
+}
+
+// Edited handles edited messages. HandleFunc receives the edited message and its previous version
+// from Cache, which is nil if Cache is nil or the message is not cached. Once handled without error,
+// the edited message replaces the previous version in Cache, so later edits are compared with it.
+//
+// Example:
+//
+//	app.Handle(handlers.Edited{
+//	    HandlerName: "audit_edits",
+//	    Cache:       cache,
+//	    HandleFunc: func(ctx nabot.Context, edited telego.Message, previous *telego.Message) error {
+//	        return audit.Log(ctx, previous, edited)
+//	    },
+//	})
+type Edited struct {
+	HandlerName string
+	Cache       MessageCache
+	HandleFunc  func(ctx nabot.Context, edited telego.Message, previous *telego.Message) error
+}
+
+func (e Edited) Name() string {
+	return e.HandlerName
+}
+
+func (e Edited) UpdateTypes() []string {
+	return editedUpdates
+}
+
+func (e Edited) Handle(ctx nabot.Context) error {
+	edited := ctx.Update().EditedMessage
+	if edited == nil {
+		return nabot.ErrPass
+	}
+	return handleEdit(ctx, e.Cache, *edited, func(previous *telego.Message) error {
+		return e.HandleFunc(ctx, *edited, previous)
+	})
+}
+
+// EditedText handles edited text messages, such as to re-scan them for moderation.
+// HandleFunc receives the new text and the previous one from Cache, which is empty if Cache is nil
+// or the message is not cached. Cache is updated like for Edited.
+//
+// Example:
+//
+//	app.Handle(handlers.EditedText{
+//	    HandlerName: "rescan",
+//	    Cache:       cache,
+//	    HandleFunc: func(ctx nabot.Context, text string, previous string) error {
+//	        return moderation.Scan(ctx, text)
+//	    },
+//	})
+type EditedText struct {
+	HandlerName string
+	Cache       MessageCache
+	HandleFunc  func(ctx nabot.Context, text string, previous string) error
+}
+
+func (e EditedText) Name() string {
+	return e.HandlerName
+}
+
+func (e EditedText) UpdateTypes() []string {
+	return editedUpdates
+}
+
+func (e EditedText) Handle(ctx nabot.Context) error {
+	edited := ctx.Update().EditedMessage
+	if edited == nil || edited.Text == "" {
+		return nabot.ErrPass
+	}
+	return handleEdit(ctx, e.Cache, *edited, func(previous *telego.Message) error {
+		var previousText string
+		if previous != nil {
+			previousText = previous.Text
+		}
+		return e.HandleFunc(ctx, edited.Text, previousText)
+	})
+}
+
+// handleEdit calls handle with the cached previous version of edited, and caches edited if it is handled.
+func handleEdit(ctx nabot.Context, cache MessageCache, edited telego.Message, handle func(previous *telego.Message) error) error {
+	var previous *telego.Message
+	if cache != nil {
+		msg, ok, err := cache.Get(ctx, edited.Chat.ID, edited.MessageID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			previous = &msg
+		}
+	}
+	if err := handle(previous); err != nil {
+		return err
+	}
+	if cache != nil {
+		if err := cache.Put(ctx, edited); err != nil {
+			ctx.Logger().Warn("nabot: failed to cache edited message", "error", err)
+		}
+	}
+	return nil
+}
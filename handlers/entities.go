@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"slices"
+	"unicode/utf16"
+)
+
+// Entity is an entity of a message, such as a mention or a URL, with the text it covers.
+type Entity struct {
+	// Type is the type of the entity, such as telego.EntityTypeHashtag.
+	Type string
+	// Value is the text covered by the entity, such as "#news" or "@alice".
+	Value string
+	// URL is the URL opened by text links.
+	URL string
+	// User is the mentioned user of text mentions.
+	User *telego.User
+}
+
+// ExtractEntities returns the entities of text having one of types, or all of them if types is empty.
+// Entity offsets and lengths, counted in UTF-16 code units, are converted to text.
+// Entities out of the bounds of text are skipped.
+func ExtractEntities(text string, entities []telego.MessageEntity, types ...string) []Entity {
+	var units []uint16
+	var result []Entity
+	for _, entity := range entities {
+		if len(types) > 0 && !slices.Contains(types, entity.Type) {
+			continue
+		}
+		if units == nil {
+			units = utf16.Encode([]rune(text))
+		}
+		end := entity.Offset + entity.Length
+		if entity.Offset < 0 || entity.Length < 0 || end > len(units) {
+			continue
+		}
+		result = append(result, Entity{
+			Type:  entity.Type,
+			Value: string(utf16.Decode(units[entity.Offset:end])),
+			URL:   entity.URL,
+			User:  entity.User,
+		})
+	}
+	return result
+}
+
+// Entities handles messages containing entities of Types, such as mentions, hashtags, URLs or emails,
+// in their text or caption. HandleFunc receives the entities of Types in order of appearance.
+// If Types is empty, messages with any entities are handled.
+//
+// Example:
+//
+//	app.Handle(handlers.Entities{
+//	    HandlerName: "links",
+//	    Types:       []string{telego.EntityTypeURL, telego.EntityTypeTextLink},
+//	    HandleFunc: func(ctx nabot.Context, entities []handlers.Entity) error {
+//	        for _, entity := range entities {
+//	            url := entity.Value
+//	            if entity.Type == telego.EntityTypeTextLink {
+//	                url = entity.URL
+//	            }
+//	            if blocklist.Contains(url) {
+//	                return moderation.Delete(ctx)
+//	            }
+//	        }
+//	        return nil
+//	    },
+//	})
+type Entities struct {
+	HandlerName string
+	Types       []string
+	HandleFunc  func(ctx nabot.Context, entities []Entity) error
+}
+
+func (e Entities) Name() string {
+	return e.HandlerName
+}
+
+func (e Entities) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (e Entities) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil {
+		return nabot.ErrPass
+	}
+	entities := ExtractEntities(msg.Text, msg.Entities, e.Types...)
+	entities = append(entities, ExtractEntities(msg.Caption, msg.CaptionEntities, e.Types...)...)
+	if len(entities) == 0 {
+		return nabot.ErrPass
+	}
+	return e.HandleFunc(ctx, entities)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"time"
+)
+
+// ForwardOrigin is the origin of a forwarded message, normalized across the kinds of origins.
+type ForwardOrigin struct {
+	// Date is when the original message was sent.
+	Date time.Time
+	// User is the original sender, if it is a user who allows linking forwards to their account.
+	User *telego.User
+	// HiddenUserName is the name of the original sender, if it is a user who does not allow linking forwards.
+	HiddenUserName string
+	// Chat is the original chat, if the message was sent on behalf of a chat or posted in a channel.
+	Chat *telego.Chat
+	// MessageID is the ID of the original message in a channel. It is zero for other origins.
+	MessageID int
+	// AuthorSignature is the signature of the original author, if any.
+	AuthorSignature string
+}
+
+// NewForwardOrigin normalizes origin. Returns false if origin is nil or of an unknown kind.
+func NewForwardOrigin(origin telego.MessageOrigin) (ForwardOrigin, bool) {
+	switch origin := origin.(type) {
+	case *telego.MessageOriginUser:
+		return ForwardOrigin{Date: time.Unix(origin.Date, 0), User: &origin.SenderUser}, true
+	case *telego.MessageOriginHiddenUser:
+		return ForwardOrigin{Date: time.Unix(origin.Date, 0), HiddenUserName: origin.SenderUserName}, true
+	case *telego.MessageOriginChat:
+		return ForwardOrigin{
+			Date:            time.Unix(origin.Date, 0),
+			Chat:            &origin.SenderChat,
+			AuthorSignature: origin.AuthorSignature,
+		}, true
+	case *telego.MessageOriginChannel:
+		return ForwardOrigin{
+			Date:            time.Unix(origin.Date, 0),
+			Chat:            &origin.Chat,
+			MessageID:       origin.MessageID,
+			AuthorSignature: origin.AuthorSignature,
+		}, true
+	}
+	return ForwardOrigin{}, false
+}
+
+// Forwarded handles forwarded messages, such as to track their sources or to stop leaks from private channels.
+// HandleFunc receives the normalized origin and the forwarded message.
+//
+// Example:
+//
+//	app.Handle(handlers.Forwarded{
+//	    HandlerName: "no_leaks",
+//	    HandleFunc: func(ctx nabot.Context, origin handlers.ForwardOrigin, msg telego.Message) error {
+//	        if origin.Chat == nil || origin.Chat.ID != privateChannelID {
+//	            return nabot.ErrPass
+//	        }
+//	        return ctx.Bot().DeleteMessage(ctx, tu.Delete(msg.Chat.ChatID(), msg.MessageID))
+//	    },
+//	})
+type Forwarded struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, origin ForwardOrigin, msg telego.Message) error
+}
+
+func (f Forwarded) Name() string {
+	return f.HandlerName
+}
+
+func (f Forwarded) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (f Forwarded) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil {
+		return nabot.ErrPass
+	}
+	origin, ok := NewForwardOrigin(msg.ForwardOrigin)
+	if !ok {
+		return nabot.ErrPass
+	}
+	return f.HandleFunc(ctx, origin, *msg)
+}
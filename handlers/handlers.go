@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/bale-ir/nabot"
 	"github.com/mymmrac/telego"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+)
+
+var (
+	messageUpdates  = []string{nabot.UpdateTypeMessage}
+	callbackUpdates = []string{nabot.UpdateTypeCallbackQuery}
 )
 
 // Func is a simple function handler.
@@ -26,7 +35,7 @@ func (f Func) Handle(ctx nabot.Context) error {
 
 // Filter passes updates only if the filter function returns true.
 // Returns nil (not ErrPass) if the filter returns false, stopping the handler chain.
-// Useful for creating allowlists for access control.
+// Useful for creating allowlists for access control; for role-based access control, see Access.
 //
 // Example (admin only):
 //
@@ -47,6 +56,7 @@ func (f Filter) Handle(ctx nabot.Context) error {
 }
 
 // Text handles text messages.
+// Set Match to handle only matching texts; HandleFunc then receives the remainder of the text, see TextMatch.
 //
 // Example:
 //
@@ -57,8 +67,20 @@ func (f Filter) Handle(ctx nabot.Context) error {
 //	        return err
 //	    },
 //	})
+//
+// Example (prefix):
+//
+//	app.Handle(handlers.Text{
+//	    HandlerName: "weather",
+//	    Match:       handlers.TextMatch{Mode: handlers.MatchPrefix, Value: "weather", IgnoreCase: true},
+//	    HandleFunc: func(ctx nabot.Context, city string) error {
+//	        // if text is 'Weather Tehran', city will be "Tehran"
+//	        return sendForecast(ctx, city)
+//	    },
+//	})
 type Text struct {
 	HandlerName string
+	Match       TextMatch
 	HandleFunc  func(ctx nabot.Context, text string) error
 }
 
@@ -66,14 +88,26 @@ func (t Text) Name() string {
 	return t.HandlerName
 }
 
+func (t Text) UpdateTypes() []string {
+	return messageUpdates
+}
+
 func (t Text) Handle(ctx nabot.Context) error {
-	if msg := ctx.Update().Message; msg != nil && msg.Text != "" {
-		return t.HandleFunc(ctx, msg.Text)
+	text, ok := nabot.MessageText(ctx.Update())
+	if !ok {
+		return nabot.ErrPass
 	}
-	return nabot.ErrPass
+	rest, ok := t.Match.Match(text)
+	if !ok {
+		return nabot.ErrPass
+	}
+	return t.HandleFunc(ctx, rest)
 }
 
 // Command handles bot commands like /start or /help.
+// Only commands at the start of the message match, optionally followed by @ and the username of a bot,
+// as sent when picking the command from the menu in groups. Set BotUsername to pass on commands
+// addressed to other bots, and Aliases to handle other commands the same way.
 //
 // Example:
 //
@@ -84,38 +118,77 @@ func (t Text) Handle(ctx nabot.Context) error {
 //	        return nil
 //	    },
 //	})
+//
+// Set InCaptions to also handle commands in the captions of media, such as /ocr sent with a photo.
 type Command struct {
 	Command    string
+	Aliases    []string
 	HandleFunc func(ctx nabot.Context, args []string) error
 	Separator  func(cmd string, fullText string) []string
+	InCaptions bool
+	// BotUsername is the username of the bot, without @.
+	BotUsername string
 }
 
 func (c Command) Name() string {
-	if strings.HasPrefix(c.Command, "/") {
-		return c.Command
-	}
-	return "/" + c.Command
+	return commandName(c.Command)
+}
+
+func (c Command) UpdateTypes() []string {
+	return messageUpdates
 }
 
 func (c Command) Handle(ctx nabot.Context) error {
-	update := ctx.Update()
-	if update.Message == nil {
+	text, ok := nabot.MessageText(ctx.Update())
+	if !ok && c.InCaptions {
+		text, ok = nabot.MessageCaption(ctx.Update())
+	}
+	if !ok {
 		return nabot.ErrPass
 	}
-	cmd := c.Name()
-	idx := strings.Index(update.Message.Text, cmd)
-	if idx < 0 {
+	cmd, rest, ok := commandText(text, c.BotUsername, c.Command, c.Aliases...)
+	if !ok {
 		return nabot.ErrPass
 	}
 	var args []string
 	if c.Separator != nil {
-		args = c.Separator(cmd, update.Message.Text)
+		args = c.Separator(cmd, text)
 	} else {
-		args = strings.Fields(update.Message.Text[idx+len(cmd):])
+		args = strings.Fields(rest)
 	}
 	return c.HandleFunc(ctx, args)
 }
 
+// commandName returns cmd with a leading slash.
+func commandName(cmd string) string {
+	return "/" + strings.TrimPrefix(cmd, "/")
+}
+
+// commandText returns the command at the start of text if it is cmd or one of aliases, and the text following it.
+// Commands addressed to a bot other than botUsername are not matched, unless botUsername is empty.
+func commandText(text string, botUsername string, cmd string, aliases ...string) (string, string, bool) {
+	first, rest, ok := botCommand(text, botUsername)
+	if !ok {
+		return "", "", false
+	}
+	if first == commandName(cmd) || slices.ContainsFunc(aliases, func(alias string) bool {
+		return first == commandName(alias)
+	}) {
+		return first, rest, true
+	}
+	return "", "", false
+}
+
+// botCommand returns the command at the start of text without its @username suffix, and the text following it.
+// Commands addressed to a bot other than botUsername are not returned, unless botUsername is empty.
+func botCommand(text string, botUsername string) (string, string, bool) {
+	cmd, username, rest, ok := splitCommand(text)
+	if !ok || (username != "" && botUsername != "" && !strings.EqualFold(username, botUsername)) {
+		return "", "", false
+	}
+	return cmd, rest, true
+}
+
 const (
 	callbackDataSeparator = "\\"
 )
@@ -137,32 +210,107 @@ const (
 //	 btn.Button("request_id")
 //		// Or:
 //		btn.ButtonWithText("Yes", "request_id")
+//
+// Set Require and Roles to restrict the button to chats having at least one of the required roles.
+// Callbacks from other chats are answered without calling HandleFunc,
+// and InlineKeyboard omits the button for them.
+// Set Signer to reject tampered callback data and stale buttons; see CallbackSigner.
+//
+// Set PayloadTTL to pass data larger than the 64 bytes allowed in callback data: data is kept in the DataStorage
+// for PayloadTTL and the callback data only carries a token. Buttons must then be created with StoredButton
+// or InlineKeyboard, and callbacks of expired buttons are answered without calling HandleFunc.
 type InlineButton struct {
 	ID          string
 	DefaultText string
 	HandleFunc  func(ctx nabot.Context, data string) error
+	Require     []Role
+	Roles       RoleProvider
+	Signer      *CallbackSigner
+	PayloadTTL  time.Duration
 }
 
 func (i InlineButton) Name() string {
 	return i.ID
 }
 
+func (i InlineButton) UpdateTypes() []string {
+	return callbackUpdates
+}
+
 func (i InlineButton) Handle(ctx nabot.Context) error {
-	if ctx.Update().CallbackQuery == nil {
+	data, ok := nabot.CallbackData(ctx.Update())
+	if !ok {
 		return nabot.ErrPass
 	}
-	data, ok := strings.CutPrefix(ctx.Update().CallbackQuery.Data, i.ID+callbackDataSeparator)
+	data, ok = cutButtonID(data, i.ID)
 	if !ok {
 		return nabot.ErrPass
 	}
+	if i.Signer != nil {
+		var err error
+		if data, err = i.Signer.verify(ctx, nabot.NormalizeText(i.ID), data); err != nil {
+			ctx.Logger().Warn("nabot: rejected callback of signed button", "button", i.ID, "error", err)
+			return ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{
+				CallbackQueryID: ctx.Update().CallbackQuery.ID,
+			})
+		}
+	}
+	if i.PayloadTTL > 0 {
+		var err error
+		if data, err = loadPayload(ctx, data); errors.Is(err, errPayloadNotFound) {
+			ctx.Logger().Warn("nabot: rejected callback of expired button", "button", i.ID)
+			return ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{
+				CallbackQueryID: ctx.Update().CallbackQuery.ID,
+			})
+		} else if err != nil {
+			return err
+		}
+	}
+	allowed, err := i.Allowed(ctx)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		ctx.Logger().Warn("nabot: rejected callback of restricted button")
+		return ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{
+			CallbackQueryID: ctx.Update().CallbackQuery.ID,
+		})
+	}
 	return i.HandleFunc(ctx, data)
 }
 
-// CallbackData returns the callback data string for this button with the given data.
+// Allowed reports whether the current chat may use this button.
+func (i InlineButton) Allowed(ctx nabot.TransitionContext) (bool, error) {
+	return hasAnyRole(ctx, i.Roles, i.Require)
+}
+
+// Item creates a KeyboardItem for InlineKeyboard. If text is empty, DefaultText is used.
+func (i InlineButton) Item(text, data string) KeyboardItem {
+	if text == "" {
+		text = i.DefaultText
+	}
+	return KeyboardItem{Button: i, Text: text, Data: data}
+}
+
+// CallbackData returns the callback data string for this button with the given data, signed if Signer is set.
 func (i InlineButton) CallbackData(data string) string {
+	if i.Signer != nil {
+		data = i.Signer.sign(nabot.NormalizeText(i.ID), data)
+	}
 	return i.ID + callbackDataSeparator + data
 }
 
+// cutButtonID returns the callback data after the button id. The id is compared normalized,
+// while the rest of the data is machine-generated and returned as sent.
+func cutButtonID(data, id string) (string, bool) {
+	n := strings.Count(id, callbackDataSeparator) + 1
+	parts := strings.SplitN(data, callbackDataSeparator, n+1)
+	if len(parts) <= n || nabot.NormalizeText(strings.Join(parts[:n], callbackDataSeparator)) != nabot.NormalizeText(id) {
+		return "", false
+	}
+	return parts[n], true
+}
+
 // Button creates an inline keyboard button with the DefaultText.
 func (i InlineButton) Button(data string) telego.InlineKeyboardButton {
 	return i.ButtonWithText(i.DefaultText, data)
@@ -189,8 +337,21 @@ func (i InlineButton) ButtonWithText(text, data string) telego.InlineKeyboardBut
 //	}
 //	// Create button:
 //	btn.Button()
+//
+// Set Aliases or Pattern to also handle other texts, such as the translations of a multi-language keyboard.
+// Button always creates the button with Text.
+//
+// Example (multi-language):
+//
+//	back := handlers.KeyboardButton{
+//	    Text:       "بازگشت",
+//	    Aliases:    []string{"Back"},
+//	    HandleFunc: goBack,
+//	}
 type KeyboardButton struct {
 	Text       string
+	Aliases    []string
+	Pattern    *regexp.Regexp
 	HandleFunc func(ctx nabot.Context) error
 }
 
@@ -198,16 +359,95 @@ func (k KeyboardButton) Name() string {
 	return "reply_button_" + k.Text
 }
 
+func (k KeyboardButton) UpdateTypes() []string {
+	return messageUpdates
+}
+
 func (k KeyboardButton) Handle(ctx nabot.Context) error {
-	if msg := ctx.Update().Message; msg != nil && msg.Text == k.Text {
+	if text, ok := nabot.MessageText(ctx.Update()); ok && k.Matches(text) {
 		return k.HandleFunc(ctx)
 	}
 	return nabot.ErrPass
 }
 
+// Matches reports whether text is Text or one of Aliases, or matches Pattern.
+func (k KeyboardButton) Matches(text string) bool {
+	text = nabot.NormalizeText(text)
+	if text == nabot.NormalizeText(k.Text) || (k.Pattern != nil && k.Pattern.MatchString(text)) {
+		return true
+	}
+	return slices.ContainsFunc(k.Aliases, func(alias string) bool {
+		return text == nabot.NormalizeText(alias)
+	})
+}
+
 // Button creates a reply keyboard button.
 func (k KeyboardButton) Button() telego.KeyboardButton {
 	return telego.KeyboardButton{
 		Text: k.Text,
 	}
 }
+
+// Delegate enqueues matching updates to a nabot.JobQueue instead of handling them in-process.
+// A worker process consumes the queue with nabot.UpdatesFromJobQueue and runs the heavy handlers,
+// so slow processing does not hold up the App receiving updates.
+// If Match is nil, every update is delegated.
+//
+// Example:
+//
+//	app.Handle(handlers.Delegate{
+//	    HandlerName: "render_report",
+//	    Queue:       queue,
+//	    Match: func(ctx nabot.Context) bool {
+//	        text, ok := nabot.MessageText(ctx.Update())
+//	        return ok && strings.HasPrefix(text, "/report")
+//	    },
+//	})
+type Delegate struct {
+	HandlerName string
+	Queue       nabot.JobQueue
+	Match       func(ctx nabot.Context) bool
+}
+
+func (d Delegate) Name() string {
+	return d.HandlerName
+}
+
+func (d Delegate) Handle(ctx nabot.Context) error {
+	if d.Match != nil && !d.Match(ctx) {
+		return nabot.ErrPass
+	}
+	return nabot.EnqueueUpdate(ctx, d.Queue, ctx.Update())
+}
+
+// Intent handles updates annotated with the given intent by an annotator registered with nabot.WithAnnotators.
+// The label passed to handleFunc carries the classifier confidence.
+//
+// Example:
+//
+//	app.Handle(handlers.Intent("book_ticket", func(ctx nabot.Context, label nabot.Label) error {
+//	    if label.Score < 0.8 {
+//	        return nabot.ErrPass
+//	    }
+//	    return toBooking.Go(ctx)
+//	}))
+func Intent(intent string, handleFunc func(ctx nabot.Context, label nabot.Label) error) nabot.Handler {
+	return intentHandler{intent: intent, handleFunc: handleFunc}
+}
+
+type intentHandler struct {
+	intent     string
+	handleFunc func(ctx nabot.Context, label nabot.Label) error
+}
+
+func (i intentHandler) Name() string {
+	return "intent_" + i.intent
+}
+
+func (i intentHandler) Handle(ctx nabot.Context) error {
+	label, ok := nabot.GetAnnotation(ctx, nabot.IntentAnnotation)
+	if !ok || label.Value != i.intent {
+		return nabot.ErrPass
+	}
+	return i.handleFunc(ctx, label)
+}
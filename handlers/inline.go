@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var inlineQueryUpdates = []string{nabot.UpdateTypeInlineQuery}
+
+// maxInlineResults is the maximum number of results of an inline query answer.
+const maxInlineResults = 50
+
+// InlinePage is a page of results requested from InlineQuery.
+type InlinePage struct {
+	// Query is the text of the inline query following the Prefix of InlineQuery.
+	Query string
+	// Offset is the number of results already sent to the user for this query.
+	Offset int
+	// Limit is the maximum number of results of the page.
+	Limit int
+}
+
+// InlineQuery answers inline queries starting with the word Prefix, compared case-insensitively, so several of them
+// can route queries such as "gif cats" and "news tehran" to different result sources. An empty Prefix matches
+// every query. Results receives the query following the prefix and the page to return; the offset sent by the
+// client is parsed and the next offset is set while Results returns full pages, so scrolling loads more results.
+//
+// Example:
+//
+//	app.Handle(handlers.InlineQuery{
+//	    HandlerName: "inline_gifs",
+//	    Prefix:      "gif",
+//	    PageSize:    20,
+//	    CacheTime:   60,
+//	    Results: func(ctx nabot.Context, page handlers.InlinePage) ([]telego.InlineQueryResult, error) {
+//	        return gifs.Search(ctx, page.Query, page.Offset, page.Limit)
+//	    },
+//	})
+type InlineQuery struct {
+	HandlerName string
+	Prefix      string
+	// PageSize is the number of results per page, at most 50. Defaults to 50.
+	PageSize int
+	// CacheTime is the time in seconds clients may cache the results.
+	CacheTime int
+	// IsPersonal caches the results only for the user who sent the query.
+	IsPersonal bool
+	Results    func(ctx nabot.Context, page InlinePage) ([]telego.InlineQueryResult, error)
+}
+
+func (q InlineQuery) Name() string {
+	return q.HandlerName
+}
+
+func (q InlineQuery) UpdateTypes() []string {
+	return inlineQueryUpdates
+}
+
+func (q InlineQuery) Handle(ctx nabot.Context) error {
+	query := ctx.Update().InlineQuery
+	if query == nil {
+		return nabot.ErrPass
+	}
+	rest, ok := TextMatch{Mode: MatchPrefix, Value: q.Prefix, IgnoreCase: true}.Match(query.Query)
+	if !ok {
+		return nabot.ErrPass
+	}
+	limit := q.PageSize
+	if limit <= 0 || limit > maxInlineResults {
+		limit = maxInlineResults
+	}
+	offset, err := strconv.Atoi(query.Offset)
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	results, err := q.Results(ctx, InlinePage{Query: rest, Offset: offset, Limit: limit})
+	if err != nil {
+		return err
+	}
+	var nextOffset string
+	if len(results) >= limit {
+		results = results[:limit]
+		nextOffset = strconv.Itoa(offset + limit)
+	}
+	return ctx.Bot().AnswerInlineQuery(ctx, &telego.AnswerInlineQueryParams{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     q.CacheTime,
+		IsPersonal:    q.IsPersonal,
+		NextOffset:    nextOffset,
+	})
+}
+
+// InlineSearch answers inline queries with debouncing.
+// Rapid keystrokes of the same user are coalesced: only the latest query is searched after Delay,
+// and answers of queries superseded while searching are dropped, so results never arrive out of order.
+// Register it by pointer so the debouncing state is shared.
+//
+// Debouncing needs the queries of a user to be handled concurrently. It does not work with
+// nabot.WithOrderedUpdates or nabot.WithFairScheduler: inline queries are keyed by their user, so each query
+// is only handled after the previous one was answered, waits Delay on its own and is never superseded.
+// With those schedulers, leave Delay zero; answers are then in order anyway.
+//
+// Example:
+//
+//	app.Handle(&handlers.InlineSearch{
+//	    HandlerName: "search_products",
+//	    Delay:       300 * time.Millisecond,
+//	    Search: func(ctx nabot.Context, query string) ([]telego.InlineQueryResult, error) {
+//	        return searchProducts(ctx, query)
+//	    },
+//	})
+type InlineSearch struct {
+	HandlerName string
+	Delay       time.Duration
+	Search      func(ctx nabot.Context, query string) ([]telego.InlineQueryResult, error)
+	// CacheTime is the time in seconds clients may cache the results.
+	CacheTime int
+
+	mu     sync.Mutex
+	seq    uint64
+	latest map[int64]uint64
+}
+
+func (s *InlineSearch) Name() string {
+	return s.HandlerName
+}
+
+func (s *InlineSearch) UpdateTypes() []string {
+	return inlineQueryUpdates
+}
+
+func (s *InlineSearch) Handle(ctx nabot.Context) error {
+	query := ctx.Update().InlineQuery
+	if query == nil {
+		return nabot.ErrPass
+	}
+	userID := query.From.ID
+	gen := s.next(userID)
+
+	if s.Delay > 0 {
+		select {
+		case <-nabot.ClockOf(ctx).After(s.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !s.isLatest(userID, gen) {
+			return nil
+		}
+	}
+
+	results, err := s.Search(ctx, query.Query)
+	if err != nil {
+		return err
+	}
+	if !s.isLatest(userID, gen) {
+		return nil
+	}
+	s.forget(userID, gen)
+	return ctx.Bot().AnswerInlineQuery(ctx, &telego.AnswerInlineQueryParams{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     s.CacheTime,
+	})
+}
+
+func (s *InlineSearch) next(userID int64) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest == nil {
+		s.latest = make(map[int64]uint64)
+	}
+	s.seq++
+	s.latest[userID] = s.seq
+	return s.seq
+}
+
+func (s *InlineSearch) isLatest(userID int64, gen uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest[userID] == gen
+}
+
+// forget removes the user entry once its latest query is answered, keeping the map small.
+func (s *InlineSearch) forget(userID int64, gen uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latest[userID] == gen {
+		delete(s.latest, userID)
+	}
+}
+
+// ChosenInlineResult handles inline results chosen by users, routed by result ID like InlineButton routes
+// callbacks: results created with ResultID carry ID as a prefix, and HandleFunc receives the data following it
+// and the chosen result, whose InlineMessageID allows editing the sent message if it has an inline keyboard.
+// Chosen results are only sent if inline feedback is enabled for the bot.
+//
+// Example:
+//
+//	chosen := handlers.ChosenInlineResult{
+//	    ID: "gif",
+//	    HandleFunc: func(ctx nabot.Context, data string, result telego.ChosenInlineResult) error {
+//	        return stats.GifPicked(ctx, data, result.Query)
+//	    },
+//	}
+//	app.Handle(chosen)
+//	// Create a result:
+//	tu.ResultGif(chosen.ResultID(gif.ID), gif.URL, gif.ThumbURL)
+type ChosenInlineResult struct {
+	ID         string
+	HandleFunc func(ctx nabot.Context, data string, result telego.ChosenInlineResult) error
+}
+
+func (c ChosenInlineResult) Name() string {
+	return "chosen_" + c.ID
+}
+
+func (c ChosenInlineResult) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeChosenInlineResult}
+}
+
+func (c ChosenInlineResult) Handle(ctx nabot.Context) error {
+	result := ctx.Update().ChosenInlineResult
+	if result == nil {
+		return nabot.ErrPass
+	}
+	data, ok := strings.CutPrefix(result.ResultID, c.ID+callbackDataSeparator)
+	if !ok {
+		return nabot.ErrPass
+	}
+	return c.HandleFunc(ctx, data, *result)
+}
+
+// ResultID returns the ID of an inline query result routed to this handler with the given data.
+// Result IDs are limited to 64 bytes.
+func (c ChosenInlineResult) ResultID(data string) string {
+	return c.ID + callbackDataSeparator + data
+}
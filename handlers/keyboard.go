@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"reflect"
+)
+
+// StructKeyboard builds an inline keyboard with one button per item, perRow buttons in each row.
+// The button text and callback data are read from the item fields tagged `btn:"text"` and `btn:"data"`.
+// The data field can be of any type and is formatted with fmt.
+// Clicking a button calls button.HandleFunc with the data of its item.
+// Like InlineKeyboard, buttons the current chat is not allowed to use are omitted, and so are nil items.
+// StructKeyboard panics if the tagged fields are missing or unexported.
+//
+// Example:
+//
+//	type product struct {
+//	    ID    int    `btn:"data"`
+//	    Title string `btn:"text"`
+//	    Price int
+//	}
+//
+//	markup, err := handlers.StructKeyboard(ctx, productButton, products, 2)
+func StructKeyboard[T any](ctx nabot.TransitionContext, button InlineButton, items []T, perRow int) (*telego.InlineKeyboardMarkup, error) {
+	perRow = max(perRow, 1)
+	textIdx, dataIdx := structButtonFields(reflect.TypeFor[T]())
+
+	var rows [][]KeyboardItem
+	count := 0
+	for _, item := range items {
+		v := reflect.ValueOf(item)
+		for v.Kind() == reflect.Pointer && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		text := fmt.Sprint(v.Field(textIdx).Interface())
+		data := fmt.Sprint(v.Field(dataIdx).Interface())
+		if count%perRow == 0 {
+			rows = append(rows, nil)
+		}
+		count++
+		rows[len(rows)-1] = append(rows[len(rows)-1], button.Item(text, data))
+	}
+	return InlineKeyboard(ctx, rows...)
+}
+
+// structButtonFields returns the indexes of the fields tagged as button text and data.
+func structButtonFields(t reflect.Type) (int, int) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("nabot: keyboard items must be structs, got %v", t))
+	}
+	textIdx, dataIdx := -1, -1
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("btn")
+		if (tag == "text" || tag == "data") && !field.IsExported() {
+			panic(fmt.Sprintf(`nabot: field %s of %v tagged btn:%q must be exported`, field.Name, t, tag))
+		}
+		switch tag {
+		case "text":
+			textIdx = i
+		case "data":
+			dataIdx = i
+		}
+	}
+	if textIdx < 0 || dataIdx < 0 {
+		panic(fmt.Sprintf(`nabot: %v must have fields tagged btn:"text" and btn:"data"`, t))
+	}
+	return textIdx, dataIdx
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+var locationUpdates = []string{nabot.UpdateTypeMessage, nabot.UpdateTypeEditedMessage}
+
+// Location handles shared locations, including the updates of live locations, which arrive as edited messages.
+// HandleFunc receives the location and whether it is an update of a live location being shared.
+// Venues, which carry a location too, are left to Venue.
+//
+// Example:
+//
+//	app.Handle(handlers.Location{
+//	    HandlerName: "track_courier",
+//	    HandleFunc: func(ctx nabot.Context, location telego.Location, update bool) error {
+//	        return tracker.Move(ctx, ctx.ChatKey(), location.Latitude, location.Longitude)
+//	    },
+//	})
+type Location struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, location telego.Location, update bool) error
+}
+
+func (l Location) Name() string {
+	return l.HandlerName
+}
+
+func (l Location) UpdateTypes() []string {
+	return locationUpdates
+}
+
+func (l Location) Handle(ctx nabot.Context) error {
+	update := ctx.Update()
+	msg, edited := update.Message, false
+	if msg == nil {
+		msg, edited = update.EditedMessage, true
+	}
+	if msg == nil || msg.Location == nil || msg.Venue != nil {
+		return nabot.ErrPass
+	}
+	return l.HandleFunc(ctx, *msg.Location, edited)
+}
+
+// Venue handles shared venues, such as a place picked from a map, with its title, address and location.
+//
+// Example:
+//
+//	app.Handle(handlers.Venue{
+//	    HandlerName: "pickup",
+//	    HandleFunc: func(ctx nabot.Context, venue telego.Venue) error {
+//	        return orders.SetPickup(ctx, venue.Title, venue.Location.Latitude, venue.Location.Longitude)
+//	    },
+//	})
+type Venue struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, venue telego.Venue) error
+}
+
+func (v Venue) Name() string {
+	return v.HandlerName
+}
+
+func (v Venue) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (v Venue) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.Venue == nil {
+		return nabot.ErrPass
+	}
+	return v.HandleFunc(ctx, *msg.Venue)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MatchMode is the way TextMatch compares texts with its Value.
+type MatchMode int
+
+const (
+	// MatchAny matches any text. The remainder is the whole text, untrimmed.
+	MatchAny MatchMode = iota
+	// MatchExact matches texts equal to Value. The remainder is empty.
+	MatchExact
+	// MatchPrefix matches texts starting with Value as a whole word, so "gif" matches "gif cats" but not "gifts".
+	// The remainder is the text following it.
+	MatchPrefix
+	// MatchSuffix matches texts ending with Value. The remainder is the text preceding it.
+	MatchSuffix
+	// MatchContains matches texts containing Value. The remainder is the text with its first occurrence removed.
+	MatchContains
+)
+
+// TextMatch matches texts with Value according to Mode. Both are normalized with nabot.NormalizeText
+// for comparison, and compared case-insensitively if IgnoreCase is set. Remainders are cut from the text
+// as it was sent, with surrounding spaces trimmed. With MatchAny, the default, the text is passed unchanged,
+// so handlers.Text without a Match receives the messages as they were sent.
+//
+// Example:
+//
+//	handlers.TextMatch{Mode: handlers.MatchPrefix, Value: "weather", IgnoreCase: true}.Match("Weather Tehran")
+//	// returns "Tehran", true
+type TextMatch struct {
+	Mode       MatchMode
+	Value      string
+	IgnoreCase bool
+}
+
+// Match reports whether text matches and returns the remainder of text not matched by Value.
+func (m TextMatch) Match(text string) (string, bool) {
+	if m.Mode == MatchAny {
+		return text, true
+	}
+	normalized, value := nabot.NormalizeText(text), nabot.NormalizeText(m.Value)
+	// start and end delimit the part of the normalized text matched by value
+	start, end, ok := 0, 0, false
+	switch m.Mode {
+	case MatchExact:
+		var after string
+		after, ok = m.cutPrefix(normalized, value)
+		ok = ok && after == ""
+		end = len(normalized)
+	case MatchPrefix:
+		var after string
+		if after, ok = m.cutPrefix(normalized, value); ok {
+			ok = !splitsWord(value, after)
+			end = len(normalized) - len(after)
+		}
+	case MatchSuffix:
+		var before string
+		if before, ok = m.cutSuffix(normalized, value); ok {
+			start, end = len(before), len(normalized)
+		}
+	case MatchContains:
+		for i := 0; i <= len(normalized) && !ok; {
+			var after string
+			if after, ok = m.cutPrefix(normalized[i:], value); ok {
+				start, end = i, len(normalized)-len(after)
+			}
+			_, size := utf8.DecodeRuneInString(normalized[i:])
+			i += max(size, 1)
+		}
+	}
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSpace(remainder(text, normalized, start, end)), true
+}
+
+// splitsWord reports whether value ends in the middle of a word continuing in after.
+func splitsWord(value, after string) bool {
+	last, _ := utf8.DecodeLastRuneInString(value)
+	next, _ := utf8.DecodeRuneInString(after)
+	return value != "" && after != "" && isWordRune(last) && isWordRune(next)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+// remainder returns text without the part matched between start and end of its normalized form.
+// If the match does not start or end at a rune boundary of text, such as when normalization composed
+// characters across it, the remainder is cut from the normalized text instead.
+func remainder(text, normalized string, start, end int) string {
+	from, ok := originalOffset(text, normalized, start, false)
+	if !ok {
+		return normalized[:start] + normalized[end:]
+	}
+	to, ok := originalOffset(text, normalized, end, true)
+	if !ok {
+		return normalized[:start] + normalized[end:]
+	}
+	return text[:from] + text[to:]
+}
+
+// originalOffset returns the offset of text whose prefix normalizes to the first n bytes of normalized.
+// If last is set, the last such offset is returned, so characters removed by normalization are included.
+func originalOffset(text, normalized string, n int, last bool) (int, bool) {
+	if n == 0 && !last {
+		return 0, true
+	}
+	// normalization rarely changes the length, so the search starts near n
+	j := min(n, len(text))
+	for j > 0 && j < len(text) && !utf8.RuneStart(text[j]) {
+		j--
+	}
+	if len(nabot.NormalizeText(text[:j])) > n {
+		j = 0
+	}
+	found, ok := 0, false
+	for {
+		prefix := nabot.NormalizeText(text[:j])
+		if len(prefix) > n {
+			break
+		}
+		if prefix == normalized[:n] {
+			found, ok = j, true
+			if !last {
+				break
+			}
+		}
+		if j == len(text) {
+			break
+		}
+		_, size := utf8.DecodeRuneInString(text[j:])
+		j += size
+	}
+	return found, ok
+}
+
+func (m TextMatch) cutPrefix(s, prefix string) (string, bool) {
+	if !m.IgnoreCase {
+		return strings.CutPrefix(s, prefix)
+	}
+	for prefix != "" {
+		r1, n1 := utf8.DecodeRuneInString(s)
+		r2, n2 := utf8.DecodeRuneInString(prefix)
+		if n1 == 0 || !equalFold(r1, r2) {
+			return "", false
+		}
+		s, prefix = s[n1:], prefix[n2:]
+	}
+	return s, true
+}
+
+func (m TextMatch) cutSuffix(s, suffix string) (string, bool) {
+	if !m.IgnoreCase {
+		return strings.CutSuffix(s, suffix)
+	}
+	for suffix != "" {
+		r1, n1 := utf8.DecodeLastRuneInString(s)
+		r2, n2 := utf8.DecodeLastRuneInString(suffix)
+		if n1 == 0 || !equalFold(r1, r2) {
+			return "", false
+		}
+		s, suffix = s[:len(s)-n1], suffix[:len(suffix)-n2]
+	}
+	return s, true
+}
+
+// equalFold reports whether r1 and r2 are equal under simple Unicode case folding.
+func equalFold(r1, r2 rune) bool {
+	if r1 == r2 {
+		return true
+	}
+	for r := unicode.SimpleFold(r1); r != r1; r = unicode.SimpleFold(r) {
+		if r == r2 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"path"
+	"strings"
+)
+
+// Photo handles messages carrying a photo. HandleFunc receives the available sizes of the photo,
+// from the smallest to the largest, and the caption of the message, which may be empty.
+// Set LargestOnly to receive only the largest size, which is usually the one to download.
+//
+// Example:
+//
+//	app.Handle(handlers.Photo{
+//	    HandlerName: "collect_photo",
+//	    LargestOnly: true,
+//	    HandleFunc: func(ctx nabot.Context, photos []telego.PhotoSize, caption string) error {
+//	        return gallery.Add(ctx, ctx.ChatKey(), photos[0].FileID, caption)
+//	    },
+//	})
+type Photo struct {
+	HandlerName string
+	LargestOnly bool
+	HandleFunc  func(ctx nabot.Context, photos []telego.PhotoSize, caption string) error
+}
+
+func (p Photo) Name() string {
+	return p.HandlerName
+}
+
+func (p Photo) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (p Photo) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || len(msg.Photo) == 0 {
+		return nabot.ErrPass
+	}
+	photos := msg.Photo
+	if p.LargestOnly {
+		largest := photos[0]
+		for _, photo := range photos[1:] {
+			if photo.Width*photo.Height > largest.Width*largest.Height {
+				largest = photo
+			}
+		}
+		photos = []telego.PhotoSize{largest}
+	}
+	return p.HandleFunc(ctx, photos, msg.Caption)
+}
+
+// Document handles messages carrying a document, such as an uploaded CSV or PDF file.
+// HandleFunc receives the document and the caption of the message, which may be empty.
+//
+// MimeTypes and Extensions restrict the documents handled: if either is set, a document must have
+// one of the MIME types, such as "text/csv" or "image/*", or one of the file name extensions, such as ".csv".
+// Documents larger than MaxSize bytes are not handled, if it is positive.
+// Documents not matching the filters are passed to OnRejected, such as to explain what is accepted,
+// or passed on with nabot.ErrPass if it is nil.
+//
+// Example:
+//
+//	app.Handle(handlers.Document{
+//	    HandlerName: "import_csv",
+//	    Extensions:  []string{".csv"},
+//	    MaxSize:     5 << 20,
+//	    HandleFunc: func(ctx nabot.Context, doc telego.Document, caption string) error {
+//	        return importer.Start(ctx, doc.FileID)
+//	    },
+//	})
+type Document struct {
+	HandlerName string
+	MimeTypes   []string
+	Extensions  []string
+	MaxSize     int64
+	HandleFunc  func(ctx nabot.Context, doc telego.Document, caption string) error
+	OnRejected  func(ctx nabot.Context, doc telego.Document) error
+}
+
+func (d Document) Name() string {
+	return d.HandlerName
+}
+
+func (d Document) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (d Document) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.Document == nil {
+		return nabot.ErrPass
+	}
+	if !d.Accepts(*msg.Document) {
+		if d.OnRejected != nil {
+			return d.OnRejected(ctx, *msg.Document)
+		}
+		return nabot.ErrPass
+	}
+	return d.HandleFunc(ctx, *msg.Document, msg.Caption)
+}
+
+// Accepts reports whether doc matches the filters of d.
+func (d Document) Accepts(doc telego.Document) bool {
+	if d.MaxSize > 0 && doc.FileSize > d.MaxSize {
+		return false
+	}
+	if len(d.MimeTypes) == 0 && len(d.Extensions) == 0 {
+		return true
+	}
+	mimeType := strings.ToLower(doc.MimeType)
+	for _, t := range d.MimeTypes {
+		t = strings.ToLower(t)
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mimeType, prefix+"/") {
+				return true
+			}
+		} else if mimeType == t {
+			return true
+		}
+	}
+	ext := strings.ToLower(path.Ext(doc.FileName))
+	for _, e := range d.Extensions {
+		if ext != "" && ext == strings.ToLower(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Voice handles voice messages. HandleFunc receives the voice, with its file ID and duration in seconds,
+// and the caption of the message, which may be empty.
+//
+// Example:
+//
+//	app.Handle(handlers.Voice{
+//	    HandlerName: "transcribe",
+//	    HandleFunc: func(ctx nabot.Context, voice telego.Voice, caption string) error {
+//	        if voice.Duration > 120 {
+//	            return sendTooLong(ctx)
+//	        }
+//	        return transcriber.Enqueue(ctx, voice.FileID)
+//	    },
+//	})
+type Voice struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, voice telego.Voice, caption string) error
+}
+
+func (v Voice) Name() string {
+	return v.HandlerName
+}
+
+func (v Voice) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (v Voice) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.Voice == nil {
+		return nabot.ErrPass
+	}
+	return v.HandleFunc(ctx, *msg.Voice, msg.Caption)
+}
+
+// Audio handles audio file messages, such as music. HandleFunc receives the audio, with its file ID,
+// duration in seconds and metadata, and the caption of the message, which may be empty.
+type Audio struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, audio telego.Audio, caption string) error
+}
+
+func (a Audio) Name() string {
+	return a.HandlerName
+}
+
+func (a Audio) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (a Audio) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.Audio == nil {
+		return nabot.ErrPass
+	}
+	return a.HandleFunc(ctx, *msg.Audio, msg.Caption)
+}
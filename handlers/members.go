@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+var memberUpdates = []string{nabot.UpdateTypeMessage, nabot.UpdateTypeChatMember}
+
+// NewMembers handles users joining a chat, whether announced by a service message or by a chat member update,
+// so welcome messages work whichever of them the platform sends. HandleFunc receives the chat and the users
+// who joined. Chat member updates are only received by administrators, and only if allowed with
+// nabot.WithAllowedUpdates; if both variants are received, HandleFunc is called for each of them.
+//
+// Example:
+//
+//	app.Handle(handlers.NewMembers{
+//	    HandlerName: "welcome",
+//	    HandleFunc: func(ctx nabot.Context, chat telego.Chat, users []telego.User) error {
+//	        _, err := ctx.Bot().SendMessage(ctx, tu.Message(chat.ChatID(), "Welcome, "+users[0].FirstName+"!"))
+//	        return err
+//	    },
+//	})
+type NewMembers struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, chat telego.Chat, users []telego.User) error
+}
+
+func (n NewMembers) Name() string {
+	return n.HandlerName
+}
+
+func (n NewMembers) UpdateTypes() []string {
+	return memberUpdates
+}
+
+func (n NewMembers) Handle(ctx nabot.Context) error {
+	update := ctx.Update()
+	if msg := update.Message; msg != nil && len(msg.NewChatMembers) > 0 {
+		return n.HandleFunc(ctx, msg.Chat, msg.NewChatMembers)
+	}
+	if change := update.ChatMember; change != nil && !isMember(change.OldChatMember) && isMember(change.NewChatMember) {
+		return n.HandleFunc(ctx, change.Chat, []telego.User{change.NewChatMember.MemberUser()})
+	}
+	return nabot.ErrPass
+}
+
+// LeftMember handles users leaving or removed from a chat, whether announced by a service message
+// or by a chat member update. HandleFunc receives the chat and the user who left.
+// Chat member updates are received as described for NewMembers.
+//
+// Example:
+//
+//	app.Handle(handlers.LeftMember{
+//	    HandlerName: "farewell",
+//	    HandleFunc: func(ctx nabot.Context, chat telego.Chat, user telego.User) error {
+//	        return members.Remove(ctx, chat.ID, user.ID)
+//	    },
+//	})
+type LeftMember struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, chat telego.Chat, user telego.User) error
+}
+
+func (l LeftMember) Name() string {
+	return l.HandlerName
+}
+
+func (l LeftMember) UpdateTypes() []string {
+	return memberUpdates
+}
+
+func (l LeftMember) Handle(ctx nabot.Context) error {
+	update := ctx.Update()
+	if msg := update.Message; msg != nil && msg.LeftChatMember != nil {
+		return l.HandleFunc(ctx, msg.Chat, *msg.LeftChatMember)
+	}
+	if change := update.ChatMember; change != nil && isMember(change.OldChatMember) && !isMember(change.NewChatMember) {
+		return l.HandleFunc(ctx, change.Chat, change.OldChatMember.MemberUser())
+	}
+	return nabot.ErrPass
+}
+
+// isMember reports whether member is present in the chat. Members are nil if missing from the update.
+func isMember(member telego.ChatMember) bool {
+	return member != nil && member.MemberIsMember()
+}
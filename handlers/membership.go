@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// BotMembership handles changes of the bot's own membership, with a callback for each kind of change:
+//
+//   - OnAdded: the bot was added to a group or channel, including as an administrator.
+//   - OnPromoted: the bot, already a member, was made an administrator.
+//   - OnRemoved: the bot was removed from a group or channel, or left it.
+//   - OnBlocked: the user blocked the bot in a private chat.
+//   - OnUnblocked: the user unblocked the bot in a private chat.
+//
+// Changes without a callback are passed on with nabot.ErrPass.
+// Set ClearOnBlock to clear the DataStorage of chats that blocked the bot, before OnBlocked is called,
+// so broadcasts and reminders skip them.
+//
+// Example:
+//
+//	app.Handle(handlers.BotMembership{
+//	    HandlerName:  "membership",
+//	    ClearOnBlock: true,
+//	    OnAdded: func(ctx nabot.Context, chat telego.Chat) error {
+//	        _, err := ctx.Bot().SendMessage(ctx, tu.Message(chat.ChatID(), "Hi! Make me an admin to moderate."))
+//	        return err
+//	    },
+//	    OnBlocked: func(ctx nabot.Context, chat telego.Chat) error {
+//	        return subscribers.Remove(ctx, chat.ID)
+//	    },
+//	})
+type BotMembership struct {
+	HandlerName  string
+	ClearOnBlock bool
+	OnAdded      func(ctx nabot.Context, chat telego.Chat) error
+	OnPromoted   func(ctx nabot.Context, chat telego.Chat, rights telego.ChatMemberAdministrator) error
+	OnRemoved    func(ctx nabot.Context, chat telego.Chat) error
+	OnBlocked    func(ctx nabot.Context, chat telego.Chat) error
+	OnUnblocked  func(ctx nabot.Context, chat telego.Chat) error
+}
+
+func (b BotMembership) Name() string {
+	return b.HandlerName
+}
+
+func (b BotMembership) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeMyChatMember}
+}
+
+func (b BotMembership) Handle(ctx nabot.Context) error {
+	change := ctx.Update().MyChatMember
+	if change == nil {
+		return nabot.ErrPass
+	}
+	chat := change.Chat
+	wasMember, member := isMember(change.OldChatMember), isMember(change.NewChatMember)
+
+	if chat.Type == telego.ChatTypePrivate {
+		blocked := change.NewChatMember != nil && change.NewChatMember.MemberStatus() == telego.MemberStatusBanned
+		switch {
+		case blocked && b.ClearOnBlock:
+			if err := nabot.Clear(ctx); err != nil {
+				return err
+			}
+			return callOrPass(ctx, chat, b.OnBlocked, nil)
+		case blocked:
+			return callOrPass(ctx, chat, b.OnBlocked, nabot.ErrPass)
+		case !wasMember && member:
+			return callOrPass(ctx, chat, b.OnUnblocked, nabot.ErrPass)
+		}
+		return nabot.ErrPass
+	}
+
+	switch {
+	case !wasMember && member:
+		return callOrPass(ctx, chat, b.OnAdded, nabot.ErrPass)
+	case wasMember && !member:
+		return callOrPass(ctx, chat, b.OnRemoved, nabot.ErrPass)
+	}
+	admin, ok := change.NewChatMember.(*telego.ChatMemberAdministrator)
+	if !ok || b.OnPromoted == nil || change.OldChatMember.MemberStatus() == telego.MemberStatusAdministrator {
+		return nabot.ErrPass
+	}
+	return b.OnPromoted(ctx, chat, *admin)
+}
+
+// callOrPass calls f if set, or returns otherwise.
+func callOrPass(ctx nabot.Context, chat telego.Chat, f func(ctx nabot.Context, chat telego.Chat) error, otherwise error) error {
+	if f == nil {
+		return otherwise
+	}
+	return f(ctx, chat)
+}
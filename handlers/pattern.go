@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CommandPrefix handles commands starting with Prefix, such as /order_1234 for the prefix "order_".
+// The rest of the command is passed as suffix, and the words following the command as args.
+// Like for Command, the command may be followed by @ and the username of a bot; set BotUsername to pass on
+// commands addressed to other bots.
+//
+// Example:
+//
+//	app.Handle(handlers.CommandPrefix{
+//	    Prefix: "order_",
+//	    HandleFunc: func(ctx nabot.Context, suffix string, args []string) error {
+//	        // if text is '/order_1234', suffix will be "1234"
+//	        return showOrder(ctx, suffix)
+//	    },
+//	})
+type CommandPrefix struct {
+	Prefix     string
+	HandleFunc func(ctx nabot.Context, suffix string, args []string) error
+	// BotUsername is the username of the bot, without @.
+	BotUsername string
+}
+
+func (c CommandPrefix) Name() string {
+	return "/" + strings.TrimPrefix(c.Prefix, "/") + "*"
+}
+
+func (c CommandPrefix) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (c CommandPrefix) Handle(ctx nabot.Context) error {
+	text, ok := nabot.MessageText(ctx.Update())
+	if !ok {
+		return nabot.ErrPass
+	}
+	cmd, rest, ok := botCommand(text, c.BotUsername)
+	if !ok {
+		return nabot.ErrPass
+	}
+	suffix, ok := strings.CutPrefix(cmd, "/"+strings.TrimPrefix(c.Prefix, "/"))
+	if !ok || suffix == "" {
+		return nabot.ErrPass
+	}
+	return c.HandleFunc(ctx, suffix, strings.Fields(rest))
+}
+
+// CommandPattern handles commands matching Pattern, in which {name} placeholders match any part of the command,
+// such as /track_{id} matching /track_AB12. The parts are passed in params by name,
+// and the words following the command as args. Like for Command, the command may be followed by @ and
+// the username of a bot; set BotUsername to pass on commands addressed to other bots.
+// Create it with NewCommandPattern to validate Pattern at startup; otherwise an invalid Pattern,
+// such as one with a duplicate placeholder, makes Handle return an error.
+//
+// Example:
+//
+//	app.Handle(handlers.NewCommandPattern("/track_{carrier}_{id}",
+//	    func(ctx nabot.Context, params map[string]string, args []string) error {
+//	        return track(ctx, params["carrier"], params["id"])
+//	    },
+//	))
+type CommandPattern struct {
+	Pattern    string
+	HandleFunc func(ctx nabot.Context, params map[string]string, args []string) error
+	// BotUsername is the username of the bot, without @.
+	BotUsername string
+}
+
+// NewCommandPattern creates a CommandPattern. Panics if pattern is invalid.
+func NewCommandPattern(pattern string, handleFunc func(ctx nabot.Context, params map[string]string, args []string) error) CommandPattern {
+	if _, err := compilePattern(pattern); err != nil {
+		panic(fmt.Sprintf("nabot: %v", err))
+	}
+	return CommandPattern{Pattern: pattern, HandleFunc: handleFunc}
+}
+
+func (c CommandPattern) Name() string {
+	return c.Pattern
+}
+
+func (c CommandPattern) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (c CommandPattern) Handle(ctx nabot.Context) error {
+	text, ok := nabot.MessageText(ctx.Update())
+	if !ok {
+		return nabot.ErrPass
+	}
+	cmd, rest, ok := botCommand(text, c.BotUsername)
+	if !ok {
+		return nabot.ErrPass
+	}
+	re, err := compilePattern(c.Pattern)
+	if err != nil {
+		return err
+	}
+	match := re.FindStringSubmatch(cmd)
+	if match == nil {
+		return nabot.ErrPass
+	}
+	params := make(map[string]string)
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			params[name] = match[i]
+		}
+	}
+	return c.HandleFunc(ctx, params, strings.Fields(rest))
+}
+
+// splitCommand returns the command at the start of text without its @username suffix, the username,
+// and the text following it.
+func splitCommand(text string) (string, string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", "", false
+	}
+	cmd, rest := text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i >= 0 {
+		_, size := utf8.DecodeRuneInString(text[i:])
+		cmd, rest = text[:i], text[i+size:]
+	}
+	cmd, username, _ := strings.Cut(cmd, "@")
+	return cmd, username, rest, true
+}
+
+var (
+	patterns           sync.Map
+	patternPlaceholder = regexp.MustCompile(`\{(\w+)}`)
+)
+
+// compilePattern compiles a command pattern to a regular expression, caching the result.
+// It returns an error if the pattern is invalid, such as with a duplicate placeholder.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	p := "/" + strings.TrimPrefix(pattern, "/")
+	var sb strings.Builder
+	sb.WriteString("^")
+	last := 0
+	names := make(map[string]bool)
+	for _, loc := range patternPlaceholder.FindAllStringSubmatchIndex(p, -1) {
+		name := p[loc[2]:loc[3]]
+		if names[name] {
+			return nil, fmt.Errorf("command pattern %q has duplicate placeholder {%s}", pattern, name)
+		}
+		names[name] = true
+		sb.WriteString(regexp.QuoteMeta(p[last:loc[0]]))
+		sb.WriteString(fmt.Sprintf(`(?P<%s>.+?)`, name))
+		last = loc[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(p[last:]))
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid command pattern %q: %w", pattern, err)
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// SuccessfulPayment handles successful payment messages, sent once the user paid an invoice.
+// HandleFunc receives the invoice payload parsed into T, the total amount in the smallest units
+// of the currency, and the full payment. Payloads are JSON, as created by InvoicePayload,
+// except for T of type string, which receives the payload as is.
+// Unlike Checkout, payments are not deduplicated: HandleFunc must tolerate repeated deliveries.
+// A Checkout registered before it takes all payments unless the Checkout has a PayloadPrefix.
+//
+// Example:
+//
+//	type order struct {
+//	    Product string `json:"p"`
+//	    Count   int    `json:"c"`
+//	}
+//
+//	app.Handle(handlers.SuccessfulPayment[order]{
+//	    HandlerName: "paid",
+//	    HandleFunc: func(ctx nabot.Context, order order, amount int, payment telego.SuccessfulPayment) error {
+//	        return shop.Ship(ctx, order.Product, order.Count)
+//	    },
+//	})
+//	// when sending the invoice:
+//	payload, err := handlers.InvoicePayload(order{Product: "book", Count: 2})
+type SuccessfulPayment[T any] struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, payload T, amount int, payment telego.SuccessfulPayment) error
+}
+
+func (s SuccessfulPayment[T]) Name() string {
+	return s.HandlerName
+}
+
+func (s SuccessfulPayment[T]) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (s SuccessfulPayment[T]) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.SuccessfulPayment == nil {
+		return nabot.ErrPass
+	}
+	payment := *msg.SuccessfulPayment
+	var payload T
+	if p, ok := any(&payload).(*string); ok {
+		*p = payment.InvoicePayload
+	} else if err := json.Unmarshal([]byte(payment.InvoicePayload), &payload); err != nil {
+		return fmt.Errorf("failed to parse invoice payload: %w", err)
+	}
+	return s.HandleFunc(ctx, payload, payment.TotalAmount, payment)
+}
+
+// InvoicePayload encodes v as an invoice payload for SuccessfulPayment. Strings are returned as is.
+// Payloads are limited to 128 bytes.
+func InvoicePayload[T any](v T) (string, error) {
+	if s, ok := any(v).(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode invoice payload: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+var (
+	pollUpdates       = []string{nabot.UpdateTypePoll}
+	pollAnswerUpdates = []string{nabot.UpdateTypePollAnswer}
+)
+
+// pollsChatKey is the chat key of the DataStorage namespace holding the chats polls were sent to.
+const pollsChatKey = "nabot:polls"
+
+// SendPoll sends a poll with params and remembers the chat it was sent to, so Poll and PollAnswer
+// pass it to their HandleFunc; poll updates and answers do not carry the chat of the poll.
+func SendPoll(ctx nabot.TransitionContext, params *telego.SendPollParams) (*telego.Message, error) {
+	msg, err := ctx.Bot().SendPoll(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if err = RememberPoll(ctx, msg); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+// RememberPoll remembers the chat of a poll message sent without SendPoll, such as by a forward.
+func RememberPoll(ctx nabot.StorageContext, msg *telego.Message) error {
+	if msg == nil || msg.Poll == nil {
+		return nil
+	}
+	if err := nabot.Set(nabot.ForChat(ctx, pollsChatKey), nabot.DataKey[telego.ChatID](msg.Poll.ID), msg.Chat.ChatID()); err != nil {
+		return fmt.Errorf("failed to remember poll: %w", err)
+	}
+	return nil
+}
+
+// PollChat returns the chat the poll was sent to, as remembered by SendPoll or RememberPoll.
+// Returns false if the poll is unknown.
+func PollChat(ctx nabot.StorageContext, pollID string) (telego.ChatID, bool, error) {
+	chatID, err := nabot.Get(nabot.ForChat(ctx, pollsChatKey), nabot.DataKey[telego.ChatID](pollID))
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return telego.ChatID{}, false, nil
+	}
+	if err != nil {
+		return telego.ChatID{}, false, err
+	}
+	return chatID, true, nil
+}
+
+// Poll handles poll updates, sent when a poll sent by the bot is stopped or its results change.
+// HandleFunc receives the poll and the chat it was sent to, which is zero unless the poll was sent
+// with SendPoll or remembered with RememberPoll.
+// The Context of poll updates has no chat; see nabot.DefaultChatKeyAndID.
+//
+// Example:
+//
+//	app.Handle(handlers.Poll{
+//	    HandlerName: "poll_closed",
+//	    HandleFunc: func(ctx nabot.Context, poll telego.Poll, chat telego.ChatID) error {
+//	        if !poll.IsClosed || chat.ID == 0 {
+//	            return nil
+//	        }
+//	        _, err := ctx.Bot().SendMessage(ctx, tu.Message(chat, "The poll is closed."))
+//	        return err
+//	    },
+//	})
+type Poll struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, poll telego.Poll, chat telego.ChatID) error
+}
+
+func (p Poll) Name() string {
+	return p.HandlerName
+}
+
+func (p Poll) UpdateTypes() []string {
+	return pollUpdates
+}
+
+func (p Poll) Handle(ctx nabot.Context) error {
+	poll := ctx.Update().Poll
+	if poll == nil {
+		return nabot.ErrPass
+	}
+	chat, _, err := PollChat(ctx, poll.ID)
+	if err != nil {
+		return err
+	}
+	return p.HandleFunc(ctx, *poll, chat)
+}
+
+// PollAnswer handles answers to non-anonymous polls sent by the bot. The Context is the one of the voter.
+// HandleFunc receives the answer and the chat the poll was sent to, which is zero unless the poll was sent
+// with SendPoll or remembered with RememberPoll, so answers to quizzes in groups can be routed to the group.
+//
+// Example:
+//
+//	app.Handle(handlers.PollAnswer{
+//	    HandlerName: "quiz_answer",
+//	    HandleFunc: func(ctx nabot.Context, answer telego.PollAnswer, chat telego.ChatID) error {
+//	        return scores.Record(ctx, chat, answer.User.ID, answer.OptionIDs)
+//	    },
+//	})
+type PollAnswer struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, answer telego.PollAnswer, chat telego.ChatID) error
+}
+
+func (p PollAnswer) Name() string {
+	return p.HandlerName
+}
+
+func (p PollAnswer) UpdateTypes() []string {
+	return pollAnswerUpdates
+}
+
+func (p PollAnswer) Handle(ctx nabot.Context) error {
+	answer := ctx.Update().PollAnswer
+	if answer == nil {
+		return nabot.ErrPass
+	}
+	chat, _, err := PollChat(ctx, answer.PollID)
+	if err != nil {
+		return err
+	}
+	return p.HandleFunc(ctx, *answer, chat)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the updates handled per chat, so a flooding user does not trigger the full handler chain
+// and its storage hits for every message. Each chat may send Burst updates per Window; excess updates are
+// dropped, stopping the chain, or delayed until they fit the limit if Wait is set.
+// OnLimit is called for the first dropped update of a chat until it is under the limit again,
+// such as to ask the user to slow down. Dropped callback queries are answered, so the button stops loading.
+//
+// Limits are kept in memory, per App instance. Register RateLimit by pointer, before other handlers.
+//
+// Example:
+//
+//	app.Handle(&handlers.RateLimit{
+//	    Burst:  5,
+//	    Window: 10 * time.Second,
+//	    OnLimit: func(ctx nabot.Context) error {
+//	        _, err := ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Slow down, please."))
+//	        return err
+//	    },
+//	})
+type RateLimit struct {
+	Burst  int
+	Window time.Duration
+	// Wait delays excess updates instead of dropping them, up to MaxWait. Updates that would wait longer are dropped.
+	Wait bool
+	// MaxWait is the longest an update waits if Wait is set. Defaults to Window.
+	MaxWait time.Duration
+	OnLimit func(ctx nabot.Context) error
+
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	pruned  time.Time
+}
+
+// rateBucket is a token bucket refilled with Burst tokens per Window.
+type rateBucket struct {
+	tokens   float64
+	last     time.Time
+	notified bool
+}
+
+func (r *RateLimit) Name() string {
+	return "rate_limit"
+}
+
+func (r *RateLimit) Handle(ctx nabot.Context) error {
+	wait, ok, notify := r.take(ctx.ChatKey(), nabot.ClockOf(ctx).Now())
+	if !ok {
+		if query := ctx.Update().CallbackQuery; query != nil {
+			err := ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{CallbackQueryID: query.ID})
+			if err != nil {
+				ctx.Logger().Warn("nabot: failed to answer callback query", "error", err)
+			}
+		}
+		if notify && r.OnLimit != nil {
+			return r.OnLimit(ctx)
+		}
+		ctx.Logger().Debug("nabot: rate limit exceeded; dropping update")
+		return nil
+	}
+	if wait > 0 {
+		select {
+		case <-nabot.ClockOf(ctx).After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nabot.ErrPass
+}
+
+// take takes a token of the chat. It returns how long to wait for it, whether the update may proceed,
+// and whether OnLimit should be called for a dropped update.
+func (r *RateLimit) take(chatKey string, now time.Time) (time.Duration, bool, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buckets == nil {
+		r.buckets = make(map[string]*rateBucket)
+	}
+	r.prune(now)
+	burst := float64(max(r.Burst, 1))
+	b, ok := r.buckets[chatKey]
+	if !ok {
+		b = &rateBucket{tokens: burst, last: now}
+		r.buckets[chatKey] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 && r.Window > 0 {
+		b.tokens = min(burst, b.tokens+burst*float64(elapsed)/float64(r.Window))
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		b.notified = false
+		return 0, true, false
+	}
+	if r.Wait {
+		// reserve the next token, so waiting updates proceed in order
+		wait := time.Duration((1 - b.tokens) / burst * float64(r.Window))
+		maxWait := r.MaxWait
+		if maxWait <= 0 {
+			maxWait = r.Window
+		}
+		if wait <= maxWait {
+			b.tokens--
+			return wait, true, false
+		}
+	}
+	notify := !b.notified
+	b.notified = true
+	return 0, false, notify
+}
+
+// prune removes the buckets of chats idle for a window, which are full again. Must be called with r.mu held.
+func (r *RateLimit) prune(now time.Time) {
+	if now.Sub(r.pruned) < r.Window {
+		return
+	}
+	r.pruned = now
+	for key, b := range r.buckets {
+		if now.Sub(b.last) >= r.Window && b.tokens >= 0 {
+			delete(r.buckets, key)
+		}
+	}
+}
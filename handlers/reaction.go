@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"slices"
+)
+
+// ReactionChange is a change of the reactions of a user to a message.
+// Reactions are their emoji, "custom:" followed by the ID of custom emojis, or "paid" for paid reactions.
+type ReactionChange struct {
+	Chat      telego.Chat
+	MessageID int
+	// User is the user who reacted. It is nil if the user is anonymous; see ActorChat.
+	User *telego.User
+	// ActorChat is the chat on behalf of which an anonymous user reacted.
+	ActorChat *telego.Chat
+	Added     []string
+	Removed   []string
+}
+
+// Reaction handles changes of the reactions to messages, such as for voting or acknowledgements
+// with reactions. HandleFunc receives the reactions added and removed by the user.
+// Reaction updates are only received by administrators, and only if allowed with nabot.WithAllowedUpdates.
+//
+// Example:
+//
+//	app.Handle(handlers.Reaction{
+//	    HandlerName: "votes",
+//	    HandleFunc: func(ctx nabot.Context, change handlers.ReactionChange) error {
+//	        return votes.Update(ctx, change.MessageID, change.Added, change.Removed)
+//	    },
+//	})
+type Reaction struct {
+	HandlerName string
+	HandleFunc  func(ctx nabot.Context, change ReactionChange) error
+}
+
+func (r Reaction) Name() string {
+	return r.HandlerName
+}
+
+func (r Reaction) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeMessageReaction}
+}
+
+func (r Reaction) Handle(ctx nabot.Context) error {
+	reaction := ctx.Update().MessageReaction
+	if reaction == nil {
+		return nabot.ErrPass
+	}
+	old, current := reactionKeys(reaction.OldReaction), reactionKeys(reaction.NewReaction)
+	change := ReactionChange{
+		Chat:      reaction.Chat,
+		MessageID: reaction.MessageID,
+		User:      reaction.User,
+		ActorChat: reaction.ActorChat,
+	}
+	for _, key := range current {
+		if !slices.Contains(old, key) {
+			change.Added = append(change.Added, key)
+		}
+	}
+	for _, key := range old {
+		if !slices.Contains(current, key) {
+			change.Removed = append(change.Removed, key)
+		}
+	}
+	return r.HandleFunc(ctx, change)
+}
+
+func reactionKeys(reactions []telego.ReactionType) []string {
+	keys := make([]string, 0, len(reactions))
+	for _, reaction := range reactions {
+		switch reaction := reaction.(type) {
+		case *telego.ReactionTypeEmoji:
+			keys = append(keys, reaction.Emoji)
+		case *telego.ReactionTypeCustomEmoji:
+			keys = append(keys, "custom:"+reaction.CustomEmojiID)
+		case *telego.ReactionTypePaid:
+			keys = append(keys, telego.ReactionPaid)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// ReplyTo handles text messages replying to another message, such as moderation commands replied to
+// the offending message. HandleFunc receives the text of the reply and the message replied to.
+// Set Match to handle only matching replies; HandleFunc then receives the remainder of the text, see TextMatch.
+//
+// Example:
+//
+//	app.Handle(handlers.ReplyTo{
+//	    HandlerName: "warn",
+//	    Match:       handlers.TextMatch{Mode: handlers.MatchPrefix, Value: "/warn"},
+//	    HandleFunc: func(ctx nabot.Context, reason string, replied telego.Message) error {
+//	        // if '/warn spam' replies to a message, reason will be "spam"
+//	        return moderation.Warn(ctx, replied.From, reason)
+//	    },
+//	})
+type ReplyTo struct {
+	HandlerName string
+	Match       TextMatch
+	HandleFunc  func(ctx nabot.Context, text string, replied telego.Message) error
+}
+
+func (r ReplyTo) Name() string {
+	return r.HandlerName
+}
+
+func (r ReplyTo) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (r ReplyTo) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.ReplyToMessage == nil || msg.Text == "" {
+		return nabot.ErrPass
+	}
+	rest, ok := r.Match.Match(msg.Text)
+	if !ok {
+		return nabot.ErrPass
+	}
+	return r.HandleFunc(ctx, rest, *msg.ReplyToMessage)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// ContactRequestButton is a reply keyboard button asking users to share their phone number,
+// and the handler receiving it. Only users' own contacts, as shared by the button, are handled;
+// other contacts are passed on with nabot.ErrPass.
+//
+// Example:
+//
+//	share := handlers.ContactRequestButton{
+//	    Text: "Share my phone number",
+//	    HandleFunc: func(ctx nabot.Context, contact telego.Contact) error {
+//	        return accounts.SetPhone(ctx, contact.UserID, contact.PhoneNumber)
+//	    },
+//	}
+//	app.Handle(share)
+//	// Ask for the contact:
+//	ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Please share your phone number.").
+//	    WithReplyMarkup(share.Keyboard()))
+type ContactRequestButton struct {
+	Text       string
+	HandleFunc func(ctx nabot.Context, contact telego.Contact) error
+}
+
+func (c ContactRequestButton) Name() string {
+	return "request_contact_" + c.Text
+}
+
+func (c ContactRequestButton) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (c ContactRequestButton) Handle(ctx nabot.Context) error {
+	return c.contact().Handle(ctx)
+}
+
+func (c ContactRequestButton) contact() Contact {
+	return Contact{
+		HandlerName: c.Name(),
+		OwnOnly:     true,
+		HandleFunc: func(ctx nabot.Context, _ string, _ int64, contact telego.Contact) error {
+			return c.HandleFunc(ctx, contact)
+		},
+	}
+}
+
+// Button creates the reply keyboard button.
+func (c ContactRequestButton) Button() telego.KeyboardButton {
+	return c.contact().Button(c.Text)
+}
+
+// Keyboard creates a one-time reply keyboard with the button.
+func (c ContactRequestButton) Keyboard() *telego.ReplyKeyboardMarkup {
+	return c.contact().Keyboard(c.Text)
+}
+
+// LocationRequestButton is a reply keyboard button asking users to share their current location,
+// and the handler receiving it. Live locations and venues are passed on with nabot.ErrPass;
+// see Location and Venue. Locations shared with the button cannot be told apart from locations
+// the user attached by hand, so HandleFunc receives both.
+//
+// Example:
+//
+//	share := handlers.LocationRequestButton{
+//	    Text: "Send my location",
+//	    HandleFunc: func(ctx nabot.Context, location telego.Location) error {
+//	        return sendNearestBranch(ctx, location.Latitude, location.Longitude)
+//	    },
+//	}
+//	app.Handle(share)
+//	// Ask for the location:
+//	ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Where are you?").WithReplyMarkup(share.Keyboard()))
+type LocationRequestButton struct {
+	Text       string
+	HandleFunc func(ctx nabot.Context, location telego.Location) error
+}
+
+func (l LocationRequestButton) Name() string {
+	return "request_location_" + l.Text
+}
+
+func (l LocationRequestButton) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (l LocationRequestButton) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.Location == nil || msg.Location.LivePeriod != 0 || msg.Venue != nil {
+		return nabot.ErrPass
+	}
+	return l.HandleFunc(ctx, *msg.Location)
+}
+
+// Button creates the reply keyboard button.
+func (l LocationRequestButton) Button() telego.KeyboardButton {
+	return telego.KeyboardButton{Text: l.Text, RequestLocation: true}
+}
+
+// Keyboard creates a one-time reply keyboard with the button.
+func (l LocationRequestButton) Keyboard() *telego.ReplyKeyboardMarkup {
+	return &telego.ReplyKeyboardMarkup{
+		Keyboard:        [][]telego.KeyboardButton{{l.Button()}},
+		ResizeKeyboard:  true,
+		OneTimeKeyboard: true,
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/bale-ir/nabot"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signatureLength is the length of encoded callback data signatures.
+const signatureLength = 11
+
+var (
+	errInvalidSignature = errors.New("invalid callback data signature")
+	errStaleButton      = errors.New("stale button")
+)
+
+// CallbackSigner signs the callback data of InlineButton and TypedButton with an HMAC of an app-level secret,
+// so callbacks with data not created by the bot are rejected, and, if maxAge is positive, so are buttons
+// created more than maxAge ago. Rejected callbacks are answered without calling HandleFunc.
+// Changing the secret invalidates all the buttons signed before.
+// Signing adds 18 bytes to the callback data, which is limited to 64 bytes.
+//
+// Example:
+//
+//	signer := handlers.NewCallbackSigner([]byte(os.Getenv("CALLBACK_SECRET")), 24*time.Hour)
+//	app.Handle(handlers.InlineButton{
+//	    ID:     "approve",
+//	    Signer: signer,
+//	    HandleFunc: func(ctx nabot.Context, data string) error {
+//	        // data was created by the bot less than a day ago
+//	        return requests.Approve(ctx, data)
+//	    },
+//	})
+type CallbackSigner struct {
+	secret []byte
+	maxAge time.Duration
+	clock  nabot.Clock
+}
+
+// NewCallbackSigner creates a CallbackSigner. Panics if secret is empty.
+func NewCallbackSigner(secret []byte, maxAge time.Duration) *CallbackSigner {
+	if len(secret) == 0 {
+		panic("nabot: callback signer secret must not be empty")
+	}
+	return &CallbackSigner{secret: secret, maxAge: maxAge, clock: nabot.SystemClock}
+}
+
+// WithClock returns a copy of the signer timestamping buttons with clock instead of nabot.SystemClock.
+// Buttons are created without a context, so pass the Clock of the App, which checks their age, such as
+// when testing with a fake clock.
+func (s *CallbackSigner) WithClock(clock nabot.Clock) *CallbackSigner {
+	c := *s
+	c.clock = clock
+	return &c
+}
+
+// sign returns data followed by the creation time and the signature of the button id with data.
+func (s *CallbackSigner) sign(id, data string) string {
+	ts := strconv.FormatInt(s.clock.Now().Unix(), 36)
+	return data + callbackDataSeparator + ts + s.signature(id, data, ts)
+}
+
+// verify returns the data signed by sign. Returns an error if the signature is invalid or the button is stale.
+func (s *CallbackSigner) verify(ctx context.Context, id, signed string) (string, error) {
+	i := strings.LastIndex(signed, callbackDataSeparator)
+	if i < 0 || len(signed)-i-1 <= signatureLength {
+		return "", errInvalidSignature
+	}
+	data, suffix := signed[:i], signed[i+1:]
+	ts, signature := suffix[:len(suffix)-signatureLength], suffix[len(suffix)-signatureLength:]
+	if !hmac.Equal([]byte(signature), []byte(s.signature(id, data, ts))) {
+		return "", errInvalidSignature
+	}
+	created, err := strconv.ParseInt(ts, 36, 64)
+	if err != nil {
+		return "", errInvalidSignature
+	}
+	if s.maxAge > 0 && nabot.ClockOf(ctx).Now().Sub(time.Unix(created, 0)) > s.maxAge {
+		return "", errStaleButton
+	}
+	return data, nil
+}
+
+func (s *CallbackSigner) signature(id, data, ts string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id + "\x00" + data + "\x00" + ts))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:8])
+}
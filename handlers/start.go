@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"net/url"
+	"strings"
+)
+
+// maxStartParameter is the maximum length of the start parameter of deep links.
+const maxStartParameter = 64
+
+// StartPayload handles /start commands sent by opening deep links created with Link, such as for referrals
+// or QR codes. Links carry Prefix followed by - and the payload encoded as URL-safe base64, so any payload
+// can be passed, and several StartPayload handlers with different prefixes can route the links.
+// Prefixes should not contain -. If Prefix is empty, the whole parameter is the encoded payload.
+// /start commands with other or invalid parameters are passed on with nabot.ErrPass.
+//
+// Example:
+//
+//	referral := handlers.StartPayload{
+//	    Prefix: "ref",
+//	    HandleFunc: func(ctx nabot.Context, payload string) error {
+//	        return referrals.Record(ctx, payload, ctx.ChatID().ID)
+//	    },
+//	}
+//	app.Handle(referral)
+//	// Create a link:
+//	link, err := referral.Link("mybot", strconv.FormatInt(userID, 10))
+type StartPayload struct {
+	Prefix     string
+	HandleFunc func(ctx nabot.Context, payload string) error
+}
+
+func (s StartPayload) Name() string {
+	return "/start " + s.Prefix
+}
+
+func (s StartPayload) UpdateTypes() []string {
+	return messageUpdates
+}
+
+func (s StartPayload) Handle(ctx nabot.Context) error {
+	text, ok := nabot.MessageText(ctx.Update())
+	if !ok {
+		return nabot.ErrPass
+	}
+	_, param, ok := commandText(text, "", "start")
+	if !ok {
+		return nabot.ErrPass
+	}
+	payload, ok := s.decode(param)
+	if !ok {
+		return nabot.ErrPass
+	}
+	return s.HandleFunc(ctx, payload)
+}
+
+// Link returns a deep link to the bot with the given username, starting it with payload.
+// Returns an error if the encoded payload exceeds the 64 characters allowed in deep links.
+func (s StartPayload) Link(botUsername, payload string) (string, error) {
+	param := s.encode(payload)
+	if len(param) > maxStartParameter {
+		return "", fmt.Errorf("start parameter is %d characters long, at most %d allowed", len(param), maxStartParameter)
+	}
+	return "https://ble.ir/" + url.PathEscape(botUsername) + "?start=" + param, nil
+}
+
+func (s StartPayload) encode(payload string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	if s.Prefix == "" {
+		return encoded
+	}
+	return s.Prefix + "-" + encoded
+}
+
+func (s StartPayload) decode(param string) (string, bool) {
+	if s.Prefix != "" {
+		var ok bool
+		if param, ok = strings.CutPrefix(param, s.Prefix+"-"); !ok {
+			return "", false
+		}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(param))
+	if err != nil {
+		return "", false
+	}
+	return string(payload), true
+}
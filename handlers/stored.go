@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// payloadsChatKey is the prefix of the chat keys of the DataStorage namespaces holding stored payloads.
+// Payloads are grouped in hourly buckets by expiry, so expired buckets are cleared at once.
+const (
+	payloadsChatKey = "nabot:payloads"
+	payloadBucket   = time.Hour
+)
+
+var (
+	lastClearedBucketKey = nabot.DataKey[int64]("last_cleared")
+	errPayloadNotFound   = errors.New("stored payload not found or expired")
+)
+
+type storedPayload struct {
+	Data    string    `json:"data"`
+	Expires time.Time `json:"expires"`
+}
+
+// StoredButton creates an inline keyboard button for a button with a PayloadTTL, storing data in the DataStorage
+// and passing only a short token as callback data. If text is empty, DefaultText is used.
+// InlineKeyboard creates buttons this way for buttons with a PayloadTTL.
+func (i InlineButton) StoredButton(ctx nabot.TransitionContext, text, data string) (telego.InlineKeyboardButton, error) {
+	if text == "" {
+		text = i.DefaultText
+	}
+	token, err := storePayload(ctx, data, i.PayloadTTL)
+	if err != nil {
+		return telego.InlineKeyboardButton{}, err
+	}
+	return i.ButtonWithText(text, token), nil
+}
+
+// storePayload stores data until ttl elapses and returns its token, clearing the buckets of expired payloads.
+func storePayload(ctx nabot.TransitionContext, data string, ttl time.Duration) (string, error) {
+	now := nabot.ClockOf(ctx).Now()
+	expires := now.Add(ttl)
+	bucket := expires.Unix()/int64(payloadBucket.Seconds()) + 1
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to store payload: %w", err)
+	}
+	token := strconv.FormatInt(bucket, 36) + "." + base64.RawURLEncoding.EncodeToString(random)
+	payload := storedPayload{Data: data, Expires: expires}
+	if err := nabot.Set(nabot.ForChat(ctx, payloadBucketKey(bucket)), nabot.DataKey[storedPayload](token), payload); err != nil {
+		return "", fmt.Errorf("failed to store payload: %w", err)
+	}
+	if err := clearExpiredPayloads(ctx, now); err != nil {
+		nabot.LoggerOf(ctx).Warn("nabot: failed to clear expired payloads", "error", err)
+	}
+	return token, nil
+}
+
+// loadPayload returns the data stored with token. Returns errPayloadNotFound if it is missing or expired.
+func loadPayload(ctx nabot.TransitionContext, token string) (string, error) {
+	bucketStr, _, ok := strings.Cut(token, ".")
+	bucket, err := strconv.ParseInt(bucketStr, 36, 64)
+	if !ok || err != nil {
+		return "", errPayloadNotFound
+	}
+	payload, err := nabot.Get(nabot.ForChat(ctx, payloadBucketKey(bucket)), nabot.DataKey[storedPayload](token))
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return "", errPayloadNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if nabot.ClockOf(ctx).Now().After(payload.Expires) {
+		return "", errPayloadNotFound
+	}
+	return payload.Data, nil
+}
+
+// clearExpiredPayloads clears the buckets expired since the last call.
+func clearExpiredPayloads(ctx nabot.TransitionContext, now time.Time) error {
+	index := nabot.ForChat(ctx, payloadsChatKey)
+	expired := now.Unix() / int64(payloadBucket.Seconds())
+	last, err := nabot.Get(index, lastClearedBucketKey)
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return nabot.Set(index, lastClearedBucketKey, expired)
+	}
+	if err != nil || last >= expired {
+		return err
+	}
+	if err = nabot.Set(index, lastClearedBucketKey, expired); err != nil {
+		return err
+	}
+	for bucket := last + 1; bucket <= expired; bucket++ {
+		if err = nabot.Clear(nabot.ForChat(ctx, payloadBucketKey(bucket))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func payloadBucketKey(bucket int64) string {
+	return payloadsChatKey + ":" + strconv.FormatInt(bucket, 10)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"reflect"
+)
+
+// maxCallbackData is the maximum length of the callback data of inline buttons, in bytes.
+const maxCallbackData = 64
+
+// TypedButton is an InlineButton whose callback data is a struct of type T.
+// The exported fields of T are encoded compactly, as a JSON array of their values in field order,
+// so renaming fields keeps old buttons working but reordering them does not.
+// Callback data is limited to 64 bytes; creating buttons with larger data returns an error.
+// Require, Roles and Signer restrict the button like for InlineButton.
+//
+// Example:
+//
+//	type shipData struct {
+//	    OrderID int64
+//	    Express bool
+//	}
+//
+//	ship := handlers.TypedButton[shipData]{
+//	    ID:          "ship",
+//	    DefaultText: "Ship",
+//	    HandleFunc: func(ctx nabot.Context, data shipData) error {
+//	        return orders.Ship(ctx, data.OrderID, data.Express)
+//	    },
+//	}
+//	app.Handle(ship)
+//	// Create button:
+//	btn, err := ship.Button(shipData{OrderID: 1234, Express: true})
+type TypedButton[T any] struct {
+	ID          string
+	DefaultText string
+	HandleFunc  func(ctx nabot.Context, data T) error
+	Require     []Role
+	Roles       RoleProvider
+	Signer      *CallbackSigner
+}
+
+func (t TypedButton[T]) Name() string {
+	return t.ID
+}
+
+func (t TypedButton[T]) UpdateTypes() []string {
+	return callbackUpdates
+}
+
+func (t TypedButton[T]) Handle(ctx nabot.Context) error {
+	return t.inlineButton().Handle(ctx)
+}
+
+// inlineButton returns the InlineButton handling the callbacks, decoding their data.
+func (t TypedButton[T]) inlineButton() InlineButton {
+	return InlineButton{
+		ID:          t.ID,
+		DefaultText: t.DefaultText,
+		Require:     t.Require,
+		Roles:       t.Roles,
+		Signer:      t.Signer,
+		HandleFunc: func(ctx nabot.Context, data string) error {
+			value, err := decodeButtonData[T](data)
+			if err != nil {
+				ctx.Logger().Warn("nabot: invalid callback data", "button", t.ID, "error", err)
+				return ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{
+					CallbackQueryID: ctx.Update().CallbackQuery.ID,
+				})
+			}
+			return t.HandleFunc(ctx, value)
+		},
+	}
+}
+
+// CallbackData returns the callback data string for this button with the given data.
+func (t TypedButton[T]) CallbackData(data T) (string, error) {
+	encoded, err := t.encode(data)
+	if err != nil {
+		return "", err
+	}
+	return t.inlineButton().CallbackData(encoded), nil
+}
+
+// Button creates an inline keyboard button with the DefaultText.
+func (t TypedButton[T]) Button(data T) (telego.InlineKeyboardButton, error) {
+	return t.ButtonWithText(t.DefaultText, data)
+}
+
+// ButtonWithText creates an inline keyboard button with custom text.
+func (t TypedButton[T]) ButtonWithText(text string, data T) (telego.InlineKeyboardButton, error) {
+	callbackData, err := t.CallbackData(data)
+	if err != nil {
+		return telego.InlineKeyboardButton{}, err
+	}
+	return telego.InlineKeyboardButton{Text: text, CallbackData: callbackData}, nil
+}
+
+// Item creates a KeyboardItem for InlineKeyboard. If text is empty, DefaultText is used.
+func (t TypedButton[T]) Item(text string, data T) (KeyboardItem, error) {
+	encoded, err := t.encode(data)
+	if err != nil {
+		return KeyboardItem{}, err
+	}
+	return t.inlineButton().Item(text, encoded), nil
+}
+
+// encode encodes data, checking the size of the resulting callback data.
+func (t TypedButton[T]) encode(data T) (string, error) {
+	encoded, err := encodeButtonData(data)
+	if err != nil {
+		return "", err
+	}
+	if size := len(t.inlineButton().CallbackData(encoded)); size > maxCallbackData {
+		return "", fmt.Errorf("callback data of button %q is %d bytes long, at most %d allowed", t.ID, size, maxCallbackData)
+	}
+	return encoded, nil
+}
+
+// encodeButtonData encodes the exported fields of data as a JSON array. Panics if T is not a struct.
+func encodeButtonData[T any](data T) (string, error) {
+	v := reflect.ValueOf(data)
+	fields := buttonDataFields(v.Type())
+	values := make([]any, len(fields))
+	for i, index := range fields {
+		values[i] = v.Field(index).Interface()
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode button data: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// decodeButtonData decodes data encoded by encodeButtonData. Missing trailing fields are left zero.
+func decodeButtonData[T any](data string) (T, error) {
+	var result T
+	var values []json.RawMessage
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return result, fmt.Errorf("failed to decode button data: %w", err)
+	}
+	v := reflect.ValueOf(&result).Elem()
+	fields := buttonDataFields(v.Type())
+	if len(values) > len(fields) {
+		return result, fmt.Errorf("failed to decode button data: %d values for %d fields", len(values), len(fields))
+	}
+	for i, value := range values {
+		if err := json.Unmarshal(value, v.Field(fields[i]).Addr().Interface()); err != nil {
+			return result, fmt.Errorf("failed to decode button data: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// buttonDataFields returns the indexes of the exported fields of t.
+func buttonDataFields(t reflect.Type) []int {
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("nabot: button data must be a struct, got %v", t))
+	}
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			fields = append(fields, i)
+		}
+	}
+	return fields
+}
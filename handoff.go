@@ -0,0 +1,362 @@
+package nabot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mymmrac/telego"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HandoffSession records that a chat is in agent mode.
+type HandoffSession struct {
+	Since time.Time `json:"since"`
+	// ChatID is the chat the answers of agents are sent to.
+	ChatID telego.ChatID `json:"chat_id"`
+}
+
+const (
+	handoffKey DataKey[HandoffSession] = "handoff"
+
+	// HandoffSecretHeader is the header of requests to the Handoff http.Handler carrying the secret
+	// set with WithAgentSecret.
+	HandoffSecretHeader = "X-Nabot-Handoff-Secret"
+)
+
+// Agent delivers the messages of chats in agent mode to human agents.
+// HandoffGroup and HandoffWebhook create agents relaying to a chat or an HTTP endpoint.
+type Agent interface {
+	// Started is called when a chat enters agent mode.
+	Started(ctx TransitionContext) error
+	// Relay delivers a message of a chat in agent mode.
+	Relay(ctx Context) error
+}
+
+// Handoff hands conversations over to human agents.
+// While a chat is in agent mode, its messages are relayed to the Agent and StateHandler and the handlers
+// registered after Handoff do not see them; its callback queries are answered without effect and its other
+// updates are passed on. Releasing the chat returns it to the bot, optionally at a state.
+//
+// Handoff is a Handler; register it before the StateHandler and other automated handlers.
+// With HandoffGroup, agents answer by replying to the relayed messages in the group
+// and release the chat by replying with the release command, optionally followed by a return state name.
+// With HandoffWebhook, agents answer through the Handoff http.Handler, authenticated with WithAgentSecret.
+//
+// Example:
+//
+//	handoff := nabot.NewHandoff(app, nabot.HandoffGroup(telego.ChatID{ID: agentsGroupID}, 0),
+//	    nabot.WithReturnState("menu", toMainMenu),
+//	)
+//	app.Handle(handoff)
+//	app.Handle(stateHandler)
+//	// in a handler:
+//	err := handoff.Start(ctx)
+type Handoff struct {
+	app            *App
+	agent          Agent
+	returnStates   map[string]Transition
+	releaseCommand string
+	secret         string
+}
+
+// NewHandoff creates a Handoff relaying chats in agent mode to agent.
+func NewHandoff(app *App, agent Agent, options ...HandoffOption) *Handoff {
+	h := &Handoff{
+		app:            app,
+		agent:          agent,
+		returnStates:   make(map[string]Transition),
+		releaseCommand: "/release",
+	}
+	if g, ok := agent.(*groupAgent); ok {
+		g.handoff = h
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+func (h *Handoff) Name() string {
+	return "handoff"
+}
+
+func (h *Handoff) Handle(ctx Context) error {
+	if g, ok := h.agent.(*groupAgent); ok && ctx.ChatID().ID == g.chat.ID {
+		return g.handleAgent(ctx)
+	}
+	if _, err := Get(ctx, handoffKey); err != nil {
+		if errors.Is(err, ErrDataKeyNotFound) {
+			return ErrPass
+		}
+		return err
+	}
+	update := ctx.Update()
+	if update.CallbackQuery != nil {
+		// the buttons of the bot do nothing while agents answer, but the client still waits for an answer
+		return ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+		})
+	}
+	if update.Message == nil {
+		return ErrPass
+	}
+	return h.agent.Relay(ctx)
+}
+
+// Start puts the current chat in agent mode.
+func (h *Handoff) Start(ctx TransitionContext) error {
+	err := Set(ctx, handoffKey, HandoffSession{Since: ClockOf(ctx).Now(), ChatID: ctx.ChatID()})
+	if err != nil {
+		return err
+	}
+	return h.agent.Started(ctx)
+}
+
+// Active reports whether the current chat is in agent mode.
+func (h *Handoff) Active(ctx StorageContext) (bool, error) {
+	_, err := Get(ctx, handoffKey)
+	if errors.Is(err, ErrDataKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Release returns the current chat to the bot. If state is not empty, the chat goes to the return state
+// registered with WithReturnState under that name; otherwise its state is left as it was.
+func (h *Handoff) Release(ctx TransitionContext, state string) error {
+	var to Transition
+	if state != "" {
+		var ok bool
+		if to, ok = h.returnStates[state]; !ok {
+			return fmt.Errorf("%w: %q", ErrStateNotFound, state)
+		}
+	}
+	if err := Remove(ctx, handoffKey); err != nil {
+		return err
+	}
+	if to == nil {
+		return nil
+	}
+	return to.Go(ctx)
+}
+
+// agentMessage is a message of an agent received by the Handoff http.Handler.
+type agentMessage struct {
+	ChatKey string `json:"chat_key"`
+	Text    string `json:"text,omitempty"`
+	Release bool   `json:"release,omitempty"`
+	State   string `json:"state,omitempty"`
+}
+
+// ServeHTTP receives the answers of agents for HandoffWebhook.
+// The request body is a JSON object with the chat_key of the chat and either the text to send to the chat,
+// or release set to true with an optional return state. The chat must be in agent mode; the message is sent
+// to the chat recorded when it entered it.
+// Requests must carry the secret set with WithAgentSecret in the HandoffSecretHeader header;
+// without a secret, all requests are rejected.
+func (h *Handoff) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	secret := r.Header.Get(HandoffSecretHeader)
+	if h.secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(h.secret)) != 1 {
+		http.Error(w, "invalid secret", http.StatusUnauthorized)
+		return
+	}
+	var msg agentMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.ChatKey == "" {
+		http.Error(w, "invalid message", http.StatusBadRequest)
+		return
+	}
+	session, err := Get(h.app.chatContext(r.Context(), msg.ChatKey, telego.ChatID{}), handoffKey)
+	if errors.Is(err, ErrDataKeyNotFound) || (err == nil && session.ChatID == (telego.ChatID{})) {
+		http.Error(w, "chat is not in agent mode", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.app.logger.Error("nabot: failed to get handoff session", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctx := h.app.chatContext(r.Context(), msg.ChatKey, session.ChatID)
+	if msg.Release {
+		err = h.Release(ctx, msg.State)
+	} else {
+		_, err = ctx.Bot().SendMessage(ctx, &telego.SendMessageParams{ChatID: session.ChatID, Text: msg.Text})
+	}
+	if err != nil {
+		ctx.Logger().Error("nabot: failed to handle agent message", "error", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandoffOption configures a Handoff.
+type HandoffOption func(*Handoff)
+
+// WithReturnState registers a state chats can be returned to when released, under name.
+func WithReturnState(name string, to Transition) HandoffOption {
+	return func(h *Handoff) {
+		h.returnStates[name] = to
+	}
+}
+
+// WithAgentSecret sets the secret the answers of agents must carry in the HandoffSecretHeader header
+// to be accepted by the Handoff http.Handler.
+func WithAgentSecret(secret string) HandoffOption {
+	return func(h *Handoff) {
+		h.secret = secret
+	}
+}
+
+// WithReleaseCommand sets the command agents reply with in a HandoffGroup to release a chat.
+// Default is "/release".
+func WithReleaseCommand(command string) HandoffOption {
+	return func(h *Handoff) {
+		if !strings.HasPrefix(command, "/") {
+			command = "/" + command
+		}
+		h.releaseCommand = command
+	}
+}
+
+// HandoffGroup returns an Agent relaying messages to a group chat, or a topic of it if threadID is not zero.
+// Agents answer by replying to the relayed messages. Replies to the messages of a released chat are ignored.
+func HandoffGroup(chat telego.ChatID, threadID int) Agent {
+	return &groupAgent{chat: chat, threadID: threadID}
+}
+
+type groupAgent struct {
+	chat     telego.ChatID
+	threadID int
+	handoff  *Handoff
+}
+
+// agentRef links a message in the agents group to the chat it was relayed from.
+type agentRef struct {
+	ChatKey string        `json:"chat_key"`
+	ChatID  telego.ChatID `json:"chat_id"`
+}
+
+func agentRefKey(messageID int) DataKey[agentRef] {
+	return DataKey[agentRef]("handoff_message:" + strconv.Itoa(messageID))
+}
+
+func (g *groupAgent) Started(ctx TransitionContext) error {
+	msg, err := ctx.Bot().SendMessage(ctx, &telego.SendMessageParams{
+		ChatID:          g.chat,
+		MessageThreadID: g.threadID,
+		Text:            fmt.Sprintf("Chat %s was handed off to an agent. Reply to its messages to answer.", ctx.ChatID()),
+	})
+	if err != nil {
+		return err
+	}
+	return g.link(ctx, msg.MessageID)
+}
+
+func (g *groupAgent) Relay(ctx Context) error {
+	msg := ctx.Update().Message
+	if msg == nil {
+		return nil
+	}
+	copied, err := ctx.Bot().CopyMessage(ctx, &telego.CopyMessageParams{
+		ChatID:          g.chat,
+		MessageThreadID: g.threadID,
+		FromChatID:      ctx.ChatID(),
+		MessageID:       msg.MessageID,
+	})
+	if err != nil {
+		return err
+	}
+	return g.link(ctx, copied.MessageID)
+}
+
+func (g *groupAgent) link(ctx TransitionContext, messageID int) error {
+	return Set(ForChat(ctx, g.chat.String()), agentRefKey(messageID), agentRef{
+		ChatKey: ctx.ChatKey(),
+		ChatID:  ctx.ChatID(),
+	})
+}
+
+func (g *groupAgent) handleAgent(ctx Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.ReplyToMessage == nil {
+		return ErrPass
+	}
+	ref, err := Get(ForChat(ctx, g.chat.String()), agentRefKey(msg.ReplyToMessage.MessageID))
+	if errors.Is(err, ErrDataKeyNotFound) {
+		return ErrPass
+	}
+	if err != nil {
+		return err
+	}
+	user := g.handoff.app.chatContext(ctx, ref.ChatKey, ref.ChatID)
+	active, err := g.handoff.Active(user)
+	if err != nil {
+		return err
+	}
+	if !active {
+		// the chat was released, so it no longer hears from agents
+		return nil
+	}
+
+	command, state, _ := strings.Cut(strings.TrimSpace(msg.Text), " ")
+	if command == g.handoff.releaseCommand {
+		return g.handoff.Release(user, strings.TrimSpace(state))
+	}
+	_, err = ctx.Bot().CopyMessage(ctx, &telego.CopyMessageParams{
+		ChatID:     ref.ChatID,
+		FromChatID: g.chat,
+		MessageID:  msg.MessageID,
+	})
+	return err
+}
+
+// HandoffWebhook returns an Agent POSTing the messages of chats in agent mode as JSON to url,
+// with the chat_key and chat_id of the chat and the message. A chat entering agent mode is posted
+// without a message. Agents answer through the Handoff http.Handler.
+// If client is nil, http.DefaultClient is used.
+func HandoffWebhook(url string, client *http.Client) Agent {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return webhookAgent{url: url, client: client}
+}
+
+type webhookAgent struct {
+	url    string
+	client *http.Client
+}
+
+type webhookAgentEvent struct {
+	ChatKey string          `json:"chat_key"`
+	ChatID  telego.ChatID   `json:"chat_id"`
+	Message *telego.Message `json:"message,omitempty"`
+}
+
+func (w webhookAgent) Started(ctx TransitionContext) error {
+	return w.post(ctx, webhookAgentEvent{ChatKey: ctx.ChatKey(), ChatID: ctx.ChatID()})
+}
+
+func (w webhookAgent) Relay(ctx Context) error {
+	return w.post(ctx, webhookAgentEvent{
+		ChatKey: ctx.ChatKey(),
+		ChatID:  ctx.ChatID(),
+		Message: ctx.Update().Message,
+	})
+}
+
+func (w webhookAgent) post(ctx context.Context, event webhookAgentEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, w.client, w.url, body)
+}
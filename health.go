@@ -0,0 +1,94 @@
+package nabot
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// sourceHealth tracks the updates channel for monitoring.
+type sourceHealth struct {
+	// lastUpdate is the time of the last received update, or of the start of Run, in Unix nanoseconds.
+	lastUpdate atomic.Int64
+	closed     atomic.Bool
+	onClosed   func()
+	silence    time.Duration
+	onSilence  func(silent time.Duration)
+}
+
+// WithOnSourceClosed sets a callback called when the updates channel is closed and Run returns,
+// such as when long polling stopped. The callback is called before Run returns,
+// while handlers of the last updates may still be running.
+func WithOnSourceClosed(callback func()) AppOption {
+	return func(a *App) {
+		a.health.onClosed = callback
+	}
+}
+
+// WithWatchdog alerts when no updates arrive for silence while Run is running, such as when the connection
+// to the server is silently lost. A warning is logged and onSilence, if not nil, is called with the time
+// since the last update; both repeat every silence period until an update arrives.
+// onSilence can check whether the bot is expected to be active, such as during office hours,
+// before paging anyone.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithWatchdog(10*time.Minute, func(silent time.Duration) {
+//	    alerts.Send(fmt.Sprintf("no updates for %v", silent))
+//	}))
+func WithWatchdog(silence time.Duration, onSilence func(silent time.Duration)) AppOption {
+	return func(a *App) {
+		a.health.silence = silence
+		a.health.onSilence = onSilence
+	}
+}
+
+// SinceLastUpdate returns the time since the last update was received.
+// Before the first update, it is the time since Run started. Zero if Run was never called.
+func (a *App) SinceLastUpdate() time.Duration {
+	last := a.health.lastUpdate.Load()
+	if last == 0 {
+		return 0
+	}
+	return a.clock.Now().Sub(time.Unix(0, last))
+}
+
+// SourceClosed reports whether the updates channel was closed.
+func (a *App) SourceClosed() bool {
+	return a.health.closed.Load()
+}
+
+func (a *App) touchSource() {
+	a.health.lastUpdate.Store(a.clock.Now().UnixNano())
+}
+
+// sourceClosed records that the updates channel was closed and notifies the callback.
+func (a *App) sourceClosed() {
+	a.health.closed.Store(true)
+	a.logger.Info("nabot: updates channel closed")
+	if a.health.onClosed != nil {
+		a.health.onClosed()
+	}
+}
+
+// watchdog alerts when no updates arrive for the silence period, until stop is closed.
+func (a *App) watchdog(stop <-chan struct{}) {
+	wait := a.health.silence
+	for {
+		select {
+		case <-stop:
+			return
+		case <-a.clock.After(wait):
+		}
+		silent := a.SinceLastUpdate()
+		if silent < a.health.silence {
+			wait = a.health.silence - silent
+			continue
+		}
+		a.logger.Warn("nabot: no updates received", slog.Duration("silent", silent))
+		if a.health.onSilence != nil {
+			a.health.onSilence(silent)
+		}
+		wait = a.health.silence
+	}
+}
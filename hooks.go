@@ -0,0 +1,63 @@
+package nabot
+
+import (
+	"github.com/mymmrac/telego"
+	"time"
+)
+
+// HookEvent describes an update to the Hooks of an App.
+type HookEvent struct {
+	Update     telego.Update
+	UpdateType string
+	ChatKey    string
+	// Handler is the name of the handler that handled the update or failed. Empty for OnUpdate and OnUnhandled.
+	Handler string
+	// Duration is the time spent in the handler chain. Zero for OnUpdate.
+	Duration time.Duration
+	// Error is the error returned by Handler. Only set for OnError.
+	Error error
+}
+
+// Hooks are called by the App while it handles updates, such as to feed analytics,
+// without wrapping handlers or forking the dispatch loop. Any of them may be nil.
+// Hooks run synchronously on the goroutine handling the update, so they should return quickly.
+type Hooks struct {
+	// OnUpdate is called for each update before the handler chain.
+	OnUpdate func(ctx Context, event HookEvent)
+	// OnHandled is called when a handler handled the update.
+	OnHandled func(ctx Context, event HookEvent)
+	// OnUnhandled is called when all handlers passed the update with ErrPass.
+	OnUnhandled func(ctx Context, event HookEvent)
+	// OnError is called when a handler failed, after the error is logged and the ErrorHandler is called.
+	OnError func(ctx Context, event HookEvent)
+}
+
+// WithHooks adds hooks called while the App handles updates. Hooks added by multiple options are called
+// in the order they were added.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithHooks(nabot.Hooks{
+//	    OnHandled: func(ctx nabot.Context, event nabot.HookEvent) {
+//	        analytics.Track(event.ChatKey, event.Handler, event.Duration)
+//	    },
+//	}))
+func WithHooks(hooks Hooks) AppOption {
+	return func(a *App) {
+		a.hooks = append(a.hooks, hooks)
+	}
+}
+
+// fireHooks calls the hook selected by pick of each Hooks of the App.
+func (a *App) fireHooks(ctx Context, pick func(Hooks) func(Context, HookEvent), event HookEvent) {
+	for _, hooks := range a.hooks {
+		if hook := pick(hooks); hook != nil {
+			hook(ctx, event)
+		}
+	}
+}
+
+func onUpdate(h Hooks) func(Context, HookEvent)    { return h.OnUpdate }
+func onHandled(h Hooks) func(Context, HookEvent)   { return h.OnHandled }
+func onUnhandled(h Hooks) func(Context, HookEvent) { return h.OnUnhandled }
+func onError(h Hooks) func(Context, HookEvent)     { return h.OnError }
@@ -0,0 +1,254 @@
+// Package inline builds results for answering inline queries.
+//
+// Results are built with fluent constructors and collected with Results, which generates missing IDs
+// and drops duplicates, so they can be returned directly from handlers.InlineSearch.
+//
+// Example:
+//
+//	Search: func(ctx nabot.Context, query string) ([]telego.InlineQueryResult, error) {
+//	    var articles []inline.Builder
+//	    for _, p := range searchProducts(query) {
+//	        articles = append(articles, inline.Article("", p.Title).
+//	            Description(p.Summary).
+//	            Thumb(p.ImageURL).
+//	            Message("{{.Title}}\nPrice: {{.Price}}", p))
+//	    }
+//	    return inline.Results(articles...)
+//	}
+package inline
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/mymmrac/telego"
+	htmltemplate "html/template"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+const (
+	// MaxResults is the maximum number of results in an answer to an inline query.
+	MaxResults = 50
+)
+
+// Builder builds an inline query result.
+type Builder interface {
+	Build() (telego.InlineQueryResult, error)
+}
+
+// Results builds the results in order, dropping results with the ID of an earlier result
+// and results beyond MaxResults.
+func Results(builders ...Builder) ([]telego.InlineQueryResult, error) {
+	results := make([]telego.InlineQueryResult, 0, min(len(builders), MaxResults))
+	seen := make(map[string]bool)
+	for _, b := range builders {
+		if len(results) == MaxResults {
+			break
+		}
+		result, err := b.Build()
+		if err != nil {
+			return nil, err
+		}
+		id, err := resultID(result)
+		if err != nil {
+			return nil, err
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// resultID returns the ID field all telego inline query result types have.
+// Returns an error if result is nil or has no ID field.
+func resultID(result telego.InlineQueryResult) (string, error) {
+	v := reflect.ValueOf(result)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "", errors.New("inline result is nil")
+	}
+	if v.Kind() != reflect.Struct {
+		return "", fmt.Errorf("inline result %T has no ID", result)
+	}
+	id := v.FieldByName("ID")
+	if !id.IsValid() || id.Kind() != reflect.String {
+		return "", fmt.Errorf("inline result %T has no ID", result)
+	}
+	return id.String(), nil
+}
+
+// ArticleBuilder builds an article result.
+type ArticleBuilder struct {
+	article telego.InlineQueryResultArticle
+	content telego.InputTextMessageContent
+	// tmpl and data are set by Message and executed by Build, once the parse mode is known.
+	tmpl *string
+	data any
+}
+
+// Article starts building an article result. If id is empty, an ID is generated from the title and message,
+// so identical articles get the same ID and are deduplicated by Results.
+// Unless Message or Text is called, the message sent is the title.
+func Article(id, title string) *ArticleBuilder {
+	return &ArticleBuilder{
+		article: telego.InlineQueryResultArticle{
+			Type:  telego.ResultTypeArticle,
+			ID:    id,
+			Title: title,
+		},
+	}
+}
+
+// Description sets the description shown under the title.
+func (a *ArticleBuilder) Description(description string) *ArticleBuilder {
+	a.article.Description = description
+	return a
+}
+
+// Thumb sets the URL of the thumbnail.
+func (a *ArticleBuilder) Thumb(url string) *ArticleBuilder {
+	a.article.ThumbnailURL = url
+	return a
+}
+
+// ThumbSize sets the size of the thumbnail.
+func (a *ArticleBuilder) ThumbSize(width, height int) *ArticleBuilder {
+	a.article.ThumbnailWidth = width
+	a.article.ThumbnailHeight = height
+	return a
+}
+
+// URL sets the URL of the article.
+func (a *ArticleBuilder) URL(url string) *ArticleBuilder {
+	a.article.URL = url
+	return a
+}
+
+// Text sets the text of the message sent when the article is chosen.
+func (a *ArticleBuilder) Text(text string) *ArticleBuilder {
+	a.content.MessageText = text
+	a.tmpl, a.data = nil, nil
+	return a
+}
+
+// Message sets the text of the message sent when the article is chosen by executing tmpl,
+// a text/template, with data. With ParseMode telego.ModeHTML, tmpl is an html/template instead,
+// so the values of data are escaped.
+func (a *ArticleBuilder) Message(tmpl string, data any) *ArticleBuilder {
+	a.tmpl, a.data = &tmpl, data
+	return a
+}
+
+// ParseMode sets the parse mode of the message text, such as telego.ModeHTML.
+func (a *ArticleBuilder) ParseMode(mode string) *ArticleBuilder {
+	a.content.ParseMode = mode
+	return a
+}
+
+// Markup sets the inline keyboard attached to the message.
+func (a *ArticleBuilder) Markup(markup *telego.InlineKeyboardMarkup) *ArticleBuilder {
+	a.article.ReplyMarkup = markup
+	return a
+}
+
+func (a *ArticleBuilder) Build() (telego.InlineQueryResult, error) {
+	article := a.article
+	content := a.content
+	if a.tmpl != nil {
+		t, err := parseTemplate(*a.tmpl, content.ParseMode == telego.ModeHTML)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		if err = t.Execute(&sb, a.data); err != nil {
+			return nil, fmt.Errorf("failed to execute message template: %w", err)
+		}
+		content.MessageText = sb.String()
+	}
+	if content.MessageText == "" {
+		content.MessageText = article.Title
+	}
+	article.InputMessageContent = &content
+	if article.ID == "" {
+		article.ID = generateID(article.Title, content.MessageText)
+	}
+	return &article, nil
+}
+
+// generateID hashes parts into an ID within the 64 bytes limit of result IDs.
+func generateID(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// maxTemplates is the number of parsed templates cached; the least recently used are evicted first.
+const maxTemplates = 256
+
+type messageTemplate interface {
+	Execute(w io.Writer, data any) error
+}
+
+type templateKey struct {
+	tmpl string
+	html bool
+}
+
+type cachedTemplate struct {
+	key      templateKey
+	template messageTemplate
+}
+
+var templates = struct {
+	mu      sync.Mutex
+	entries map[templateKey]*list.Element
+	// recent orders the entries from the most to the least recently used.
+	recent *list.List
+}{
+	entries: make(map[templateKey]*list.Element),
+	recent:  list.New(),
+}
+
+// parseTemplate parses tmpl as an html/template if html is set, or a text/template otherwise,
+// caching the result as the same templates are used for every query.
+func parseTemplate(tmpl string, html bool) (messageTemplate, error) {
+	key := templateKey{tmpl: tmpl, html: html}
+	templates.mu.Lock()
+	defer templates.mu.Unlock()
+	if e, ok := templates.entries[key]; ok {
+		templates.recent.MoveToFront(e)
+		return e.Value.(cachedTemplate).template, nil
+	}
+
+	var t messageTemplate
+	var err error
+	if html {
+		t, err = htmltemplate.New("message").Parse(tmpl)
+	} else {
+		t, err = template.New("message").Parse(tmpl)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message template: %w", err)
+	}
+	templates.entries[key] = templates.recent.PushFront(cachedTemplate{key: key, template: t})
+	for templates.recent.Len() > maxTemplates {
+		oldest := templates.recent.Back()
+		templates.recent.Remove(oldest)
+		delete(templates.entries, oldest.Value.(cachedTemplate).key)
+	}
+	return t, nil
+}
@@ -0,0 +1,200 @@
+package nabot
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// instrument wraps the dependencies of the App reporting to its metrics and tracer.
+// Called once all options are applied.
+func (a *App) instrument() {
+	if a.metrics == nil && a.tracer == nil {
+		return
+	}
+	a.dataStore = instrumentStore(a.dataStore, a.metrics, a.tracer, a.clock)
+}
+
+// instrumentedHandler reports the calls of a handler to the metrics and tracer, either of which may be nil.
+type instrumentedHandler struct {
+	Handler
+	metrics Metrics
+	tracer  TracerProvider
+}
+
+func (h instrumentedHandler) Handle(ctx Context) error {
+	var span Span
+	if h.tracer != nil {
+		var spanCtx context.Context
+		spanCtx, span = h.tracer.Start(ctx, "handler "+h.Name(), slog.String("nabot.handler", h.Name()))
+		ctx = derivedContext{Context: ctx, ctx: spanCtx}
+	}
+	start := ClockOf(ctx).Now()
+	err := h.Handler.Handle(ctx)
+	if h.metrics != nil {
+		h.metrics.HandlerDone(h.Name(), ClockOf(ctx).Now().Sub(start), err)
+	}
+	if span != nil {
+		endSpan(span, err)
+	}
+	return err
+}
+
+// instrumentStore wraps store reporting its operations, keeping the optional interfaces it implements,
+// so blobs and watches keep using the native support of the store.
+func instrumentStore(store DataStorage, metrics Metrics, tracer TracerProvider, clock Clock) DataStorage {
+	s := instrumentedStore{DataStorage: store, metrics: metrics, tracer: tracer, clock: clock}
+	blob, isBlob := store.(BlobStorage)
+	watch, isWatch := store.(WatchableStorage)
+	switch {
+	case isBlob && isWatch:
+		return struct {
+			instrumentedStore
+			BlobStorage
+			dataWatcher
+		}{s, blob, watch}
+	case isBlob:
+		return struct {
+			instrumentedStore
+			BlobStorage
+		}{s, blob}
+	case isWatch:
+		return struct {
+			instrumentedStore
+			dataWatcher
+		}{s, watch}
+	}
+	return s
+}
+
+// dataWatcher is the method WatchableStorage adds to DataStorage.
+type dataWatcher interface {
+	WatchData(ctx context.Context, chatKey string, dataKey string, notify func()) error
+}
+
+type instrumentedStore struct {
+	DataStorage
+	metrics Metrics
+	tracer  TracerProvider
+	clock   Clock
+}
+
+func (s instrumentedStore) SetData(ctx context.Context, chatKey string, dataKey string, value any) error {
+	return s.do(ctx, "set", chatKey, dataKey, func(ctx context.Context) error {
+		return s.DataStorage.SetData(ctx, chatKey, dataKey, value)
+	})
+}
+
+func (s instrumentedStore) GetData(ctx context.Context, chatKey string, dataKey string, pointer any) error {
+	return s.do(ctx, "get", chatKey, dataKey, func(ctx context.Context) error {
+		return s.DataStorage.GetData(ctx, chatKey, dataKey, pointer)
+	})
+}
+
+func (s instrumentedStore) RemoveData(ctx context.Context, chatKey string, dataKey string) error {
+	return s.do(ctx, "remove", chatKey, dataKey, func(ctx context.Context) error {
+		return s.DataStorage.RemoveData(ctx, chatKey, dataKey)
+	})
+}
+
+func (s instrumentedStore) ClearData(ctx context.Context, chatKey string) error {
+	return s.do(ctx, "clear", chatKey, "", func(ctx context.Context) error {
+		return s.DataStorage.ClearData(ctx, chatKey)
+	})
+}
+
+// Healthy reports the health of the wrapped store, as returned by App.StorageHealthy.
+func (s instrumentedStore) Healthy() bool {
+	if h, ok := s.DataStorage.(interface{ Healthy() bool }); ok {
+		return h.Healthy()
+	}
+	return true
+}
+
+// Close closes the wrapped store if it implements io.Closer.
+func (s instrumentedStore) Close() error {
+	if c, ok := s.DataStorage.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (s instrumentedStore) do(ctx context.Context, op string, chatKey string, dataKey string,
+	f func(ctx context.Context) error) error {
+	var span Span
+	if s.tracer != nil {
+		attrs := []slog.Attr{slog.String("nabot.chat_key", chatKey)}
+		if dataKey != "" {
+			attrs = append(attrs, slog.String("nabot.data_key", dataKey))
+		}
+		ctx, span = s.tracer.Start(ctx, "storage "+op, attrs...)
+	}
+	start := s.clock.Now()
+	err := f(ctx)
+	reported := err
+	if errors.Is(err, ErrDataKeyNotFound) {
+		reported = nil
+	}
+	if s.metrics != nil {
+		s.metrics.StorageDone(op, s.clock.Now().Sub(start), reported)
+	}
+	if span != nil {
+		endSpan(span, reported)
+	}
+	return err
+}
+
+// endSpan records err on span, unless it is nil or ErrPass, and ends it.
+func endSpan(span Span, err error) {
+	if err != nil && !errors.Is(err, ErrPass) {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// derivedContext runs a Context with a context.Context derived from it, such as one carrying a span
+// or a deadline, keeping the rest of the Context.
+type derivedContext struct {
+	Context
+	ctx context.Context
+}
+
+func (d derivedContext) Deadline() (time.Time, bool) {
+	return d.ctx.Deadline()
+}
+
+func (d derivedContext) Done() <-chan struct{} {
+	return d.ctx.Done()
+}
+
+func (d derivedContext) Err() error {
+	return d.ctx.Err()
+}
+
+func (d derivedContext) Value(key any) any {
+	return d.ctx.Value(key)
+}
+
+// derivedTransitionContext is a derivedContext for a TransitionContext.
+type derivedTransitionContext struct {
+	TransitionContext
+	ctx context.Context
+}
+
+func (d derivedTransitionContext) Deadline() (time.Time, bool) {
+	return d.ctx.Deadline()
+}
+
+func (d derivedTransitionContext) Done() <-chan struct{} {
+	return d.ctx.Done()
+}
+
+func (d derivedTransitionContext) Err() error {
+	return d.ctx.Err()
+}
+
+func (d derivedTransitionContext) Value(key any) any {
+	return d.ctx.Value(key)
+}
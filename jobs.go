@@ -0,0 +1,142 @@
+package nabot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mymmrac/telego"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrJobQueueClosed is returned by JobQueue.Pop when no more jobs will be delivered,
+	// and by JobQueue.Push once the queue is closed.
+	ErrJobQueueClosed = errors.New("job queue closed")
+)
+
+// JobQueue transports serialized updates from the App receiving them to worker processes.
+// An in-memory implementation is available via NewInMemoryJobQueue.
+// You can implement this interface to use Redis, SQL or any other queue.
+type JobQueue interface {
+	// Push enqueues a serialized update.
+	Push(ctx context.Context, job []byte) error
+	// Pop blocks until a job is available and dequeues it.
+	// Returns ErrJobQueueClosed when the queue will not deliver any more jobs.
+	Pop(ctx context.Context) ([]byte, error)
+	// Close stops the queue: Push returns ErrJobQueueClosed, and Pop returns ErrJobQueueClosed
+	// once the jobs pushed before are delivered.
+	Close() error
+}
+
+type memoryJobQueue struct {
+	jobs      chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewInMemoryJobQueue creates an in-memory job queue buffering up to size jobs.
+// Push blocks while the queue is full.
+func NewInMemoryJobQueue(size int) JobQueue {
+	return &memoryJobQueue{
+		jobs:   make(chan []byte, size),
+		closed: make(chan struct{}),
+	}
+}
+
+func (m *memoryJobQueue) Push(ctx context.Context, job []byte) error {
+	select {
+	case <-m.closed:
+		return ErrJobQueueClosed
+	default:
+	}
+	select {
+	case m.jobs <- job:
+		return nil
+	case <-m.closed:
+		return ErrJobQueueClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *memoryJobQueue) Pop(ctx context.Context) ([]byte, error) {
+	select {
+	case job := <-m.jobs:
+		return job, nil
+	case <-m.closed:
+		// deliver the jobs pushed before Close
+		select {
+		case job := <-m.jobs:
+			return job, nil
+		default:
+			return nil, ErrJobQueueClosed
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *memoryJobQueue) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+	})
+	return nil
+}
+
+// EnqueueUpdate serializes the update and pushes it to the queue.
+func EnqueueUpdate(ctx context.Context, queue JobQueue, update telego.Update) error {
+	job, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to marshal update: %w", err)
+	}
+	if err = queue.Push(ctx, job); err != nil {
+		return fmt.Errorf("failed to enqueue update: %w", err)
+	}
+	return nil
+}
+
+// UpdatesFromJobQueue returns an update channel fed by jobs popped from the queue.
+// Use it to run a stripped-down App in a worker process that only registers the heavy handlers.
+// The channel is closed when ctx is done or the queue returns ErrJobQueueClosed.
+//
+// Example:
+//
+//	updates := nabot.UpdatesFromJobQueue(ctx, queue)
+//	worker := nabot.NewApp(bot, updates)
+//	worker.Handle(heavyHandler)
+//	worker.Run()
+func UpdatesFromJobQueue(ctx context.Context, queue JobQueue) <-chan telego.Update {
+	updates := make(chan telego.Update)
+	go func() {
+		defer close(updates)
+		for {
+			job, err := queue.Pop(ctx)
+			if ctx.Err() != nil || errors.Is(err, ErrJobQueueClosed) {
+				return
+			}
+			if err != nil {
+				slog.Default().Error("nabot: failed to pop job", "error", err)
+				select {
+				case <-ClockOf(ctx).After(time.Second):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			var update telego.Update
+			if err = json.Unmarshal(job, &update); err != nil {
+				slog.Default().Error("nabot: failed to unmarshal job; skipping", "error", err)
+				continue
+			}
+			select {
+			case updates <- update.WithContext(ctx):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return updates
+}
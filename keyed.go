@@ -0,0 +1,49 @@
+package nabot
+
+import (
+	"sync"
+)
+
+// KeyedMutex is a set of mutexes identified by keys, for serializing work per chat or per payment
+// rather than globally. Mutexes are created on demand and removed once unlocked by all their holders.
+// The zero value is ready to use. A KeyedMutex must not be copied after first use.
+//
+// Example:
+//
+//	unlock := h.locks.Lock(ctx.ChatKey())
+//	defer unlock()
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu sync.Mutex
+	// refs is the number of holders and waiters of the lock; guarded by KeyedMutex.mu.
+	refs int
+}
+
+// Lock locks the mutex of key, blocking until it is available, and returns the function unlocking it.
+func (k *KeyedMutex) Lock(key string) (unlock func()) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		k.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
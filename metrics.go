@@ -0,0 +1,233 @@
+package nabot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements of an App, to export them to a monitoring system.
+// Implement it to report to any provider, or use PrometheusMetrics. Methods are called concurrently.
+type Metrics interface {
+	// UpdateReceived is called for each update before it is handled.
+	UpdateReceived(updateType string)
+	// UpdateDropped is called for each update dropped by the overflow policy of WithMaxInFlight.
+	UpdateDropped(updateType string)
+	// UpdateUnhandled is called for each update passed by all handlers with ErrPass.
+	UpdateUnhandled(updateType string)
+	// HandlerDone is called after each handler call with its duration and result: nil, ErrPass or an error.
+	HandlerDone(handler string, duration time.Duration, err error)
+	// StorageDone is called after each DataStorage operation, "set", "get", "remove" or "clear",
+	// with its duration and error. ErrDataKeyNotFound is reported as nil.
+	StorageDone(op string, duration time.Duration, err error)
+}
+
+// WithMetrics reports the measurements of the App to metrics.
+//
+// Example:
+//
+//	metrics := nabot.NewPrometheusMetrics()
+//	app := nabot.NewApp(bot, updates, nabot.WithMetrics(metrics))
+//	adminMux.Handle("/metrics", metrics)
+func WithMetrics(metrics Metrics) AppOption {
+	return func(a *App) {
+		a.metrics = metrics
+	}
+}
+
+// PrometheusMetrics is a Metrics keeping counters and histograms in memory.
+// It implements http.Handler serving them in the Prometheus text format, to be scraped without
+// depending on the Prometheus client library:
+//
+//   - nabot_updates_received_total{type}
+//   - nabot_updates_dropped_total{type}
+//   - nabot_updates_unhandled_total{type}
+//   - nabot_handler_calls_total{handler, result}, where result is "handled", "passed" or "error"
+//   - nabot_handler_duration_seconds{handler}, a histogram
+//   - nabot_storage_operations_total{op, result}, where result is "ok" or "error"
+//   - nabot_storage_duration_seconds{op}, a histogram
+//
+// Example:
+//
+//	metrics := nabot.NewPrometheusMetrics()
+//	app := nabot.NewApp(bot, updates, nabot.WithMetrics(metrics))
+//	adminMux.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu              sync.Mutex
+	received        map[string]uint64
+	dropped         map[string]uint64
+	unhandled       map[string]uint64
+	handlerCalls    map[[2]string]uint64
+	handlerDuration map[string]*histogram
+	storageOps      map[[2]string]uint64
+	storageDuration map[string]*histogram
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics with histogram buckets in seconds,
+// by default .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5 and 10.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	return &PrometheusMetrics{
+		buckets:         buckets,
+		received:        make(map[string]uint64),
+		dropped:         make(map[string]uint64),
+		unhandled:       make(map[string]uint64),
+		handlerCalls:    make(map[[2]string]uint64),
+		handlerDuration: make(map[string]*histogram),
+		storageOps:      make(map[[2]string]uint64),
+		storageDuration: make(map[string]*histogram),
+	}
+}
+
+func (p *PrometheusMetrics) UpdateReceived(updateType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.received[updateType]++
+}
+
+func (p *PrometheusMetrics) UpdateDropped(updateType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dropped[updateType]++
+}
+
+func (p *PrometheusMetrics) UpdateUnhandled(updateType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unhandled[updateType]++
+}
+
+func (p *PrometheusMetrics) HandlerDone(handler string, duration time.Duration, err error) {
+	result := "handled"
+	if errors.Is(err, ErrPass) {
+		result = "passed"
+	} else if err != nil {
+		result = "error"
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlerCalls[[2]string{handler, result}]++
+	p.observe(p.handlerDuration, handler, duration)
+}
+
+func (p *PrometheusMetrics) StorageDone(op string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.storageOps[[2]string{op, result}]++
+	p.observe(p.storageDuration, op, duration)
+}
+
+// observe adds duration to the histogram of label. Must be called with p.mu held.
+func (p *PrometheusMetrics) observe(histograms map[string]*histogram, label string, duration time.Duration) {
+	h, ok := histograms[label]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(p.buckets))}
+		histograms[label] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range p.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// histogram holds cumulative bucket counts, like Prometheus histograms.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var b strings.Builder
+	p.mu.Lock()
+	writeCounter(&b, "nabot_updates_received_total", "Updates received, by type.",
+		[]string{"type"}, singleLabel(p.received))
+	writeCounter(&b, "nabot_updates_dropped_total", "Updates dropped by the overflow policy, by type.",
+		[]string{"type"}, singleLabel(p.dropped))
+	writeCounter(&b, "nabot_updates_unhandled_total", "Updates passed by all handlers, by type.",
+		[]string{"type"}, singleLabel(p.unhandled))
+	writeCounter(&b, "nabot_handler_calls_total", "Handler calls, by handler and result.",
+		[]string{"handler", "result"}, p.handlerCalls)
+	p.writeHistogram(&b, "nabot_handler_duration_seconds", "Handler call duration, by handler.",
+		"handler", p.handlerDuration)
+	writeCounter(&b, "nabot_storage_operations_total", "Storage operations, by operation and result.",
+		[]string{"op", "result"}, p.storageOps)
+	p.writeHistogram(&b, "nabot_storage_duration_seconds", "Storage operation duration, by operation.",
+		"op", p.storageDuration)
+	p.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func singleLabel(counts map[string]uint64) map[[2]string]uint64 {
+	m := make(map[[2]string]uint64, len(counts))
+	for label, n := range counts {
+		m[[2]string{label}] = n
+	}
+	return m
+}
+
+func writeCounter(b *strings.Builder, name string, help string, labels []string, counts map[[2]string]uint64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([][2]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b [2]string) int {
+		return strings.Compare(a[0]+"\x00"+a[1], b[0]+"\x00"+b[1])
+	})
+	for _, key := range keys {
+		pairs := make([]string, len(labels))
+		for i, label := range labels {
+			pairs[i] = label + "=" + quoteLabel(key[i])
+		}
+		fmt.Fprintf(b, "%s{%s} %d\n", name, strings.Join(pairs, ","), counts[key])
+	}
+}
+
+func (p *PrometheusMetrics) writeHistogram(b *strings.Builder, name string, help string, label string,
+	histograms map[string]*histogram) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	keys := make([]string, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		h := histograms[key]
+		l := label + "=" + quoteLabel(key)
+		for i, bound := range p.buckets {
+			fmt.Fprintf(b, "%s_bucket{%s,le=\"%g\"} %d\n", name, l, bound, h.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, h.count)
+		fmt.Fprintf(b, "%s_sum{%s} %g\n%s_count{%s} %d\n", name, l, h.sum, name, l, h.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
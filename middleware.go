@@ -0,0 +1,86 @@
+package nabot
+
+// Middleware wraps a Handler to run code before and after it, such as logging, access control,
+// recovery or metrics. It returns the Handler called instead of next.
+// Middlewares are added to an App with App.Use; MiddlewareFunc creates one from a function.
+type Middleware func(next Handler) Handler
+
+// MiddlewareFunc creates a Middleware calling f with the context and the wrapped handler,
+// which f calls with next.Handle(ctx) to continue.
+//
+// Example:
+//
+//	app.Use(nabot.MiddlewareFunc(func(ctx nabot.Context, next nabot.Handler) error {
+//	    start := time.Now()
+//	    err := next.Handle(ctx)
+//	    if !errors.Is(err, nabot.ErrPass) {
+//	        ctx.Logger().Info("handled", "handler", next.Name(), "duration", time.Since(start))
+//	    }
+//	    return err
+//	}))
+func MiddlewareFunc(f func(ctx Context, next Handler) error) Middleware {
+	return func(next Handler) Handler {
+		return middlewareHandler{next: next, f: f}
+	}
+}
+
+type middlewareHandler struct {
+	next Handler
+	f    func(ctx Context, next Handler) error
+}
+
+func (m middlewareHandler) Name() string {
+	return m.next.Name()
+}
+
+func (m middlewareHandler) Handle(ctx Context) error {
+	return m.f(ctx, m.next)
+}
+
+// Use adds middlewares wrapping every handler of the App, including handlers registered before Use.
+// The first middleware is the outermost: it runs first before a handler and last after it.
+// Middlewares run for each handler of the chain, including handlers that pass with ErrPass.
+// Use panics if the App is frozen; see Freeze.
+//
+// Example:
+//
+//	app.Use(recoverMiddleware, logMiddleware)
+func (a *App) Use(middleware ...Middleware) {
+	if a.frozen.Load() {
+		panic("nabot: cannot add middleware after the app is frozen")
+	}
+	a.middleware = append(a.middleware, middleware...)
+}
+
+// applyMiddleware wraps handler with the middlewares of the App. The result keeps the name of handler,
+// so logs and features are attributed to the handler rather than to its middlewares.
+func (a *App) applyMiddleware(handler Handler) Handler {
+	if a.metrics != nil || a.tracer != nil {
+		// innermost, so the measured duration is the handler's own
+		return a.wrapMiddleware(handler, instrumentedHandler{Handler: handler, metrics: a.metrics, tracer: a.tracer})
+	}
+	return a.wrapMiddleware(handler, handler)
+}
+
+// wrapMiddleware wraps inner, handler or an instrumented version of it, with the middlewares of the App,
+// keeping the name of handler.
+func (a *App) wrapMiddleware(handler Handler, inner Handler) Handler {
+	if len(a.middleware) == 0 {
+		return inner
+	}
+	wrapped := inner
+	for i := len(a.middleware) - 1; i >= 0; i-- {
+		wrapped = a.middleware[i](wrapped)
+	}
+	return namedHandler{Handler: wrapped, name: handler.Name()}
+}
+
+// namedHandler is a Handler with the name of the handler it wraps.
+type namedHandler struct {
+	Handler
+	name string
+}
+
+func (n namedHandler) Name() string {
+	return n.name
+}
@@ -1,11 +1,16 @@
 package nabot
 
 import (
+	"cmp"
+	"context"
 	"errors"
 	"github.com/mymmrac/telego"
 	"log/slog"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // App is the main bot application.
@@ -21,16 +26,41 @@ import (
 type App struct {
 	bot             *telego.Bot
 	updatesChan     <-chan telego.Update
-	handlers        []Handler
+	handlers        []registration
+	middleware      []Middleware
+	routes          atomic.Pointer[map[string][]Handler]
+	handlersMu      sync.Mutex
+	freezeOnce      sync.Once
+	frozen          atomic.Bool
+	annotators      []Annotator
 	logger          *slog.Logger
 	dataStore       DataStorage
 	extractChatInfo ChatInfoExtractor
 	executor        Executor
+	clock           Clock
+	updateTimeout   time.Duration
+	allowedUpdates  []string
+	errorHandler    ErrorHandler
+	ordered         *orderedQueues
+	fair            *fairScheduler
+	health          sourceHealth
+	replies         *replyRegistry
+	faults          *FaultConfig
+	shadow          *Shadow
+	metrics         Metrics
+	tracer          TracerProvider
+	hooks           []Hooks
+	runCtx          context.Context
+	dependencies    map[string]any
+	inFlight        *inFlight
+	fallback        Handler
+	fallbackTypes   []string
 	wg              sync.WaitGroup
 }
 
 // NewApp creates a new bot App.
 // The update channel can be created using bot.UpdatesViaLongPolling or bot.UpdatesViaWebhook.
+// It may be nil if the App is run with RunSource or RunWebhook instead.
 func NewApp(bot *telego.Bot, updates <-chan telego.Update, options ...AppOption) *App {
 	app := &App{
 		bot:             bot,
@@ -39,15 +69,25 @@ func NewApp(bot *telego.Bot, updates <-chan telego.Update, options ...AppOption)
 		dataStore:       NewInMemoryDataStore(),
 		extractChatInfo: DefaultChatKeyAndID,
 		executor:        DefaultExecutor,
+		clock:           SystemClock,
 	}
 	for _, ops := range options {
 		ops(app)
 	}
+	app.replies = &replyRegistry{clock: app.clock}
+	app.applyFaults()
+	app.instrument()
+	if app.shadow != nil {
+		app.shadow.attach(app)
+	}
 	return app
 }
 
 // Handle adds a handler to the list of handlers.
-// Handlers are called in registration order until one returns an error other than ErrPass.
+// Handlers are called in order of priority, then in registration order, until one returns an error
+// other than ErrPass. The default priority is zero; see WithPriority.
+// Handlers implementing TypedHandler are skipped for updates of other types.
+// Handle panics if the App is frozen; see Freeze.
 //
 // Example:
 //
@@ -58,28 +98,345 @@ func NewApp(bot *telego.Bot, updates <-chan telego.Update, options ...AppOption)
 //	        return nil
 //	    },
 //	})
-func (a *App) Handle(handler Handler) {
-	a.handlers = append(a.handlers, handler)
+func (a *App) Handle(handler Handler, options ...HandleOption) {
+	r := registration{handler: handler}
+	for _, option := range options {
+		option(&r)
+	}
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
+	if a.frozen.Load() {
+		panic("nabot: cannot register handler after the app is frozen")
+	}
+	a.handlers = append(a.handlers, r)
+}
+
+// HandleIf adds a handler called only for updates matching predicate. For other updates it passes with ErrPass,
+// so the next handlers are tried, unlike handlers.Filter, which stops the chain.
+// The predicate runs before the handler, and its type routing is kept if it is a TypedHandler.
+//
+// Example:
+//
+//	app.HandleIf(func(ctx nabot.Context) bool {
+//	    return ctx.ChatID().ID == adminChatID
+//	}, adminCommands)
+func (a *App) HandleIf(predicate func(ctx Context) bool, handler Handler, options ...HandleOption) {
+	conditional := conditionalHandler{Handler: handler, predicate: predicate}
+	if th, ok := handler.(TypedHandler); ok {
+		a.Handle(typedConditionalHandler{conditionalHandler: conditional, types: th.UpdateTypes()}, options...)
+		return
+	}
+	a.Handle(conditional, options...)
+}
+
+type conditionalHandler struct {
+	Handler
+	predicate func(ctx Context) bool
+}
+
+func (c conditionalHandler) Handle(ctx Context) error {
+	if !c.predicate(ctx) {
+		return ErrPass
+	}
+	return c.Handler.Handle(ctx)
+}
+
+type typedConditionalHandler struct {
+	conditionalHandler
+	types []string
+}
+
+func (t typedConditionalHandler) UpdateTypes() []string {
+	return t.types
+}
+
+// registration is a handler registered with Handle.
+type registration struct {
+	handler  Handler
+	priority int
+}
+
+// HandleOption configures the registration of a handler with App.Handle.
+type HandleOption func(*registration)
+
+// WithPriority sets the priority of a handler. Handlers with a higher priority are called first,
+// regardless of registration order, so modules registering their own handlers can be added in any order.
+// Handlers of the same priority are called in registration order.
+//
+// Example:
+//
+//	app.Handle(cancelCommand, nabot.WithPriority(100))
+//	app.Handle(fallback, nabot.WithPriority(-100))
+func WithPriority(priority int) HandleOption {
+	return func(r *registration) {
+		r.priority = priority
+	}
+}
+
+// sortedHandlers returns the registered handlers in the order they are called.
+func (a *App) sortedHandlers() []Handler {
+	sorted := slices.Clone(a.handlers)
+	slices.SortStableFunc(sorted, func(x, y registration) int {
+		return cmp.Compare(y.priority, x.priority)
+	})
+	result := make([]Handler, len(sorted))
+	for i, r := range sorted {
+		result[i] = r.handler
+	}
+	return result
+}
+
+// Freeze ends the registration phase of the App and compiles its routing structures.
+// Registering a handler after Freeze panics, though handlers can still be removed or replaced
+// with Remove and Replace. Run calls Freeze implicitly;
+// calling it earlier catches handlers registered after Run at startup instead of silently racing with it.
+func (a *App) Freeze() {
+	a.freezeOnce.Do(func() {
+		a.handlersMu.Lock()
+		a.buildRoutes()
+		fallback := a.fallback
+		if a.fallback != nil {
+			if th, ok := a.fallback.(TypedHandler); ok {
+				a.fallbackTypes = th.UpdateTypes()
+			}
+			a.fallback = a.applyMiddleware(a.fallback)
+		}
+		a.frozen.Store(true)
+		a.handlersMu.Unlock()
+		if a.shadow != nil {
+			a.shadow.freeze(a, fallback)
+		}
+	})
+}
+
+// buildRoutes compiles the routes of the registered handlers. Must be called with a.handlersMu held.
+// Updates being handled keep the routes they started with.
+func (a *App) buildRoutes() {
+	routes := map[string][]Handler{
+		UpdateTypeMessage: {a.applyMiddleware(a.replies)},
+	}
+	for _, handler := range a.sortedHandlers() {
+		types := updateTypes
+		if th, ok := handler.(TypedHandler); ok {
+			types = th.UpdateTypes()
+		}
+		wrapped := a.applyMiddleware(handler)
+		for _, t := range types {
+			routes[t] = append(routes[t], wrapped)
+		}
+	}
+	a.routes.Store(&routes)
+}
+
+// Remove unregisters the handlers named name and reports whether any was found.
+// Unlike Handle, it can be called while the App is running, such as to turn a feature off;
+// updates already being handled are not affected.
+func (a *App) Remove(name string) bool {
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
+	n := len(a.handlers)
+	a.handlers = slices.DeleteFunc(slices.Clone(a.handlers), func(r registration) bool {
+		return r.handler.Name() == name
+	})
+	if len(a.handlers) == n {
+		return false
+	}
+	if a.frozen.Load() {
+		a.buildRoutes()
+	}
+	return true
+}
+
+// Replace replaces the handlers named name with handler, keeping their priority and position,
+// and reports whether any was found. Like Remove, it can be called while the App is running.
+//
+// Example:
+//
+//	// hot-toggle a module behind a feature flag
+//	if flags.NewCheckout() {
+//	    app.Replace("checkout", newCheckout)
+//	}
+func (a *App) Replace(name string, handler Handler) bool {
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
+	handlers := slices.Clone(a.handlers)
+	found := false
+	for i, r := range handlers {
+		if r.handler.Name() == name {
+			handlers[i].handler = handler
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+	a.handlers = handlers
+	if a.frozen.Load() {
+		a.buildRoutes()
+	}
+	return true
 }
 
-// Run starts processing updates and blocks until the update channel is closed.
+// AllowedUpdates returns the update types handled by the registered handlers,
+// suitable for the AllowedUpdates parameter of GetUpdatesParams and SetWebhookParams.
+// Returns nil if any handler accepts all update types.
+// If WithAllowedUpdates is set, its types are returned instead.
+func (a *App) AllowedUpdates() []string {
+	if a.allowedUpdates != nil {
+		return slices.Clone(a.allowedUpdates)
+	}
+	a.handlersMu.Lock()
+	defer a.handlersMu.Unlock()
+	var allowed []string
+	for _, r := range a.handlers {
+		th, ok := r.handler.(TypedHandler)
+		if !ok {
+			return nil
+		}
+		for _, t := range th.UpdateTypes() {
+			if !slices.Contains(allowed, t) {
+				allowed = append(allowed, t)
+			}
+		}
+	}
+	return allowed
+}
+
+// Run freezes the App, starts processing updates and blocks until the update channel is closed.
+// Updates are handed to the Executor as they arrive, so they may be handled out of order.
+// Use WithOrderedUpdates or WithFairScheduler to handle updates of each chat sequentially.
 func (a *App) Run() {
-	for update := range a.updatesChan {
-		a.wg.Add(1)
-		a.executor(func() {
-			defer a.wg.Done()
-			a.processUpdate(update)
-		})
+	a.run(context.Background())
+}
+
+// RunContext is like Run, but also stops when ctx is done, even if the update channel stays open,
+// and then waits for the handlers to finish, like Stop. Handlers get a Context canceled with ctx.
+//
+// Example:
+//
+//	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer cancel()
+//	app.RunContext(ctx)
+func (a *App) RunContext(ctx context.Context) {
+	a.runCtx = ctx
+	a.run(ctx)
+	a.Stop()
+}
+
+func (a *App) run(ctx context.Context) {
+	a.Freeze()
+	a.touchSource()
+	if a.health.silence > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go a.watchdog(stop)
+	}
+	if a.fair != nil {
+		a.startFair()
+		defer a.stopFair()
 	}
+	for {
+		var update telego.Update
+		var ok bool
+		select {
+		case update, ok = <-a.updatesChan:
+		case <-ctx.Done():
+			a.logger.Info("nabot: context done; stopping")
+			return
+		}
+		if !ok {
+			break
+		}
+		a.touchSource()
+		if a.allowedUpdates != nil && !slices.Contains(a.allowedUpdates, GetTypeOfUpdate(update)) {
+			ackUpdate(update)
+			continue
+		}
+		if a.inFlight != nil {
+			if update, ok = a.inFlight.admit(update, a.dropUpdate); !ok {
+				continue
+			}
+		}
+		if a.fair != nil {
+			a.dispatchFair(update)
+			continue
+		}
+		if a.ordered != nil {
+			a.dispatchOrdered(update)
+			continue
+		}
+		a.dispatch(update)
+	}
+	a.sourceClosed()
 }
 
+func (a *App) dispatch(update telego.Update) {
+	update = queuedUpdate(update)
+	a.wg.Add(1)
+	a.executor(func() {
+		defer a.wg.Done()
+		a.processUpdate(update)
+	})
+}
+
+// runInChat runs task in turn with the updates of the chat when they are handled one at a time,
+// with WithOrderedUpdates or WithFairScheduler, and hands it to the Executor otherwise.
+// The task is queued even if the queue of the chat is full. Stop waits for it.
+func (a *App) runInChat(chatKey string, task func()) {
+	update := telego.Update{}.WithContext(context.WithValue(context.Background(), chatTaskKey{}, task))
+	switch {
+	case a.fair != nil:
+		if !a.enqueueFair(chatKey, update, false) {
+			// the scheduler is stopped
+			a.dispatch(update)
+		}
+	case a.ordered != nil:
+		a.enqueueOrdered(chatKey, update, false)
+	default:
+		a.dispatch(update)
+	}
+}
+
+// chatTaskKey is the context key of the task carried by the updates queued by runInChat.
+type chatTaskKey struct{}
+
 // Stop blocks until all currently processing handlers are done.
 // Call this after the update channel is closed to ensure a clean shutdown.
 func (a *App) Stop() {
 	a.wg.Wait()
 }
 
+// StorageHealthy reports whether the data storage is available.
+// Always true unless the storage reports its health, like FallbackDataStore does.
+func (a *App) StorageHealthy() bool {
+	if h, ok := a.dataStore.(interface{ Healthy() bool }); ok {
+		return h.Healthy()
+	}
+	return true
+}
+
 func (a *App) processUpdate(update telego.Update) {
+	if task, ok := update.Context().Value(chatTaskKey{}).(func()); ok {
+		task()
+		return
+	}
+	if a.inFlight != nil {
+		admission, ok := a.inFlight.start(update)
+		if !ok {
+			// dropped to make room; it was reported when dropped
+			return
+		}
+		if admission != nil {
+			update = admission.update
+		}
+		defer a.inFlight.done(admission)
+	}
+	defer func() {
+		// updates interrupted by the end of RunContext are left for the queue to redeliver
+		if a.runCtx == nil || a.runCtx.Err() == nil {
+			ackUpdate(update)
+		}
+	}()
 	ctx := a.newContext(update)
 	if ctx == nil {
 		a.logger.Warn("nabot: could not determine context; ignoring update",
@@ -87,33 +444,91 @@ func (a *App) processUpdate(update telego.Update) {
 		)
 		return
 	}
-	var err error
-	var handler Handler
-	for _, h := range a.handlers {
-		handler = h
-		err = h.Handle(ContextWithLogger(ctx, a.logger.With(slog.String("handler", h.Name()))))
-		if errors.Is(err, ErrPass) {
-			continue
+	if a.runCtx != nil {
+		// the update keeps the values of its own context, but is canceled with the App
+		var cancel context.CancelFunc
+		ctx.Context, cancel = context.WithCancel(ctx.Context)
+		defer cancel()
+		defer context.AfterFunc(a.runCtx, cancel)()
+	}
+	if a.updateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx.Context, cancel = context.WithTimeout(ctx.Context, a.updateTimeout)
+		defer cancel()
+	}
+	if a.metrics != nil {
+		a.metrics.UpdateReceived(GetTypeOfUpdate(update))
+	}
+	var span Span
+	ctx.Context, span = a.startSpan(ctx.Context, "update "+GetTypeOfUpdate(update),
+		slog.String("nabot.update_type", GetTypeOfUpdate(update)),
+		slog.String("nabot.chat_key", ctx.chatKey),
+	)
+	a.injectDelay(ctx)
+	a.annotate(ctx)
+	var candidate *ShadowOutcome
+	if a.shadow != nil {
+		if candidate = a.shadow.mirror(a, ctx); candidate != nil {
+			ctx.values.shadow = &callRecording{}
 		}
-		break
 	}
-	if err != nil {
-		if errors.Is(err, ErrPass) {
-			a.logger.Info("nabot: update was not handled by any handler")
+	event := HookEvent{Update: update, UpdateType: GetTypeOfUpdate(update), ChatKey: ctx.chatKey}
+	a.fireHooks(ctx, onUpdate, event)
+	start := a.clock.Now()
+	handler, err := runChain(ctx, (*a.routes.Load())[GetTypeOfUpdate(update)], func(ctx Context, h Handler) Context {
+		return &labeledContext{Context: ctx, key: "handler", name: h.Name()}
+	})
+	if errors.Is(err, ErrPass) && a.handlesFallback(update) {
+		handler = a.fallback
+		err = handler.Handle(&labeledContext{Context: ctx, key: "handler", name: handler.Name()})
+	}
+	event.Duration = a.clock.Now().Sub(start)
+	if handler != nil && !errors.Is(err, ErrPass) {
+		event.Handler = handler.Name()
+	}
+	switch {
+	case err == nil:
+		a.fireHooks(ctx, onHandled, event)
+	case errors.Is(err, ErrPass):
+		a.logger.Info("nabot: update was not handled by any handler")
+		if a.metrics != nil {
+			a.metrics.UpdateUnhandled(GetTypeOfUpdate(update))
+		}
+		a.fireHooks(ctx, onUnhandled, event)
+	default:
+		handlerName := "<nil>"
+		if handler != nil {
+			handlerName = handler.Name()
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			a.logger.Error("nabot: update handling timed out",
+				"error", err,
+				"handler", handlerName,
+				"timeout", a.updateTimeout,
+			)
 		} else {
-			handlerName := "<nil>"
-			if handler != nil {
-				handlerName = handler.Name()
-			}
 			a.logger.
 				With("error", err).
 				With("handler", handlerName).
 				Error("nabot: failed to handle update")
 		}
+		if a.errorHandler != nil {
+			a.errorHandler(ctx, handler, err)
+		}
+		event.Error = err
+		a.fireHooks(ctx, onError, event)
+	}
+	if span != nil {
+		endSpan(span, err)
+	}
+	if candidate != nil {
+		live := ShadowOutcome{Calls: ctx.values.shadow.calls}
+		live.Handler, live.Error = outcomeOf(handler, err)
+		a.shadow.compare(ctx, live, *candidate)
 	}
 }
 
-func (a *App) newContext(update telego.Update) Context {
+func (a *App) newContext(update telego.Update) *nativeContext {
 	chatKey, chatId, ok := a.extractChatInfo(update)
 	if !ok {
 		return nil
@@ -126,13 +541,32 @@ func (a *App) newContext(update telego.Update) Context {
 		chatKey:   chatKey,
 		chatID:    chatId,
 		logger:    a.logger,
+		clock:     a.clock,
+		values:    updateValues{replies: a.replies, dependencies: a.dependencies, app: a},
 	}
-	n.logger = n.logger.With(
-		slog.String("chat", n.chatID.String()),
-	)
 	return n
 }
 
+// handlesFallback reports whether the fallback handler handles the update when no other handler did.
+func (a *App) handlesFallback(update telego.Update) bool {
+	return a.fallback != nil && (a.fallbackTypes == nil || slices.Contains(a.fallbackTypes, GetTypeOfUpdate(update)))
+}
+
+// chatContext returns a context for the chat outside of its updates, such as when an agent answers,
+// a session expires or a state times out.
+func (a *App) chatContext(ctx context.Context, chatKey string, chatID telego.ChatID) Context {
+	return &nativeContext{
+		Context:   ctx,
+		bot:       a.bot,
+		dataStore: a.dataStore,
+		chatKey:   chatKey,
+		chatID:    chatID,
+		logger:    a.logger,
+		clock:     a.clock,
+		values:    updateValues{replies: a.replies, dependencies: a.dependencies, app: a},
+	}
+}
+
 // AppOption configures an App.
 type AppOption func(*App)
 
@@ -151,6 +585,74 @@ func WithDataStore(dataStorage DataStorage) AppOption {
 	}
 }
 
+// WithClock sets the clock used for timeouts, TTLs and scheduling.
+// Default is SystemClock. Handlers read it with ClockOf.
+func WithClock(clock Clock) AppOption {
+	return func(a *App) {
+		a.clock = clock
+	}
+}
+
+// WithUpdateTimeout cancels the Context of each update once d has passed since handling started,
+// so handlers waiting on API calls, storage or other context-aware operations return instead of hanging.
+// Handlers failing after the deadline are logged as timed out. Handlers ignoring the Context are not interrupted.
+// Default is no timeout.
+func WithUpdateTimeout(d time.Duration) AppOption {
+	return func(a *App) {
+		a.updateTimeout = d
+	}
+}
+
+// WithAllowedUpdates drops updates of other types as they are received, before a Context is created
+// or any handler runs, such as reactions a group bot never handles. Types are as returned by GetTypeOfUpdate.
+// AllowedUpdates returns the types, so they can also be passed to GetUpdatesParams
+// and SetWebhookParams for the server to stop sending them.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithAllowedUpdates(nabot.UpdateTypeMessage, nabot.UpdateTypeCallbackQuery))
+func WithAllowedUpdates(types ...string) AppOption {
+	return func(a *App) {
+		a.allowedUpdates = append([]string{}, types...)
+	}
+}
+
+// WithFallbackHandler sets a handler called when all handlers passed the update with ErrPass,
+// instead of logging that the update was not handled. Unlike a catch-all handler registered last,
+// it stays last regardless of priorities and handlers registered later. If it passes as well,
+// the update is reported as unhandled. A TypedHandler is only called for its update types.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithFallbackHandler(handlers.Func(func(ctx nabot.Context) error {
+//	    _, err := ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Sorry, I did not understand. Try /help."))
+//	    return err
+//	})))
+func WithFallbackHandler(handler Handler) AppOption {
+	return func(a *App) {
+		a.fallback = handler
+	}
+}
+
+// ErrorHandler is called with the handler that failed to handle an update and its error.
+type ErrorHandler func(ctx Context, handler Handler, err error)
+
+// WithErrorHandler sets a function called when a handler fails with an error other than ErrPass,
+// after the error is logged. Use it to tell the user something went wrong, report the error or retry.
+// The Context is the one of the failed update, so its deadline may have passed; see WithUpdateTimeout.
+//
+// Example:
+//
+//	nabot.WithErrorHandler(func(ctx nabot.Context, h nabot.Handler, err error) {
+//	    sentry.CaptureException(err)
+//	    _, _ = ctx.Bot().SendMessage(context.WithoutCancel(ctx), tu.Message(ctx.ChatID(), "Something went wrong."))
+//	})
+func WithErrorHandler(handler ErrorHandler) AppOption {
+	return func(a *App) {
+		a.errorHandler = handler
+	}
+}
+
 // ChatInfoExtractor extracts chat key and chat ID from an update.
 // The chat key is used as the parent key in DataStorage.
 // Returns false if the update type is not supported and should not be processed by App.
@@ -165,22 +667,32 @@ func WithCustomChatKeyAndID(extractor ChatInfoExtractor) AppOption {
 }
 
 // DefaultChatKeyAndID extracts chat key and chat ID from most update types.
-// Uses chat ID as the key, or user ID for user-specific updates like inline queries.
+// Uses chat ID as the key, or user ID for user-specific updates like inline queries
+// and callback queries sent from inline messages.
+// Poll updates, which have no chat, get the key "poll:" followed by the poll ID and a zero chat ID;
+// see handlers.Poll to find the chat the poll was sent to.
+// Business messages get the key "business:" followed by the business connection ID and the chat ID,
+// so chats of business accounts do not share state with the private chats of the same users with the bot.
 func DefaultChatKeyAndID(update telego.Update) (string, telego.ChatID, bool) {
 	var chatId telego.ChatID
 	var user telego.User
 
+	if connectionID, chat, ok := businessChat(update); ok {
+		return "business:" + connectionID + ":" + strconv.FormatInt(chat.ID, 10), chat.ChatID(), true
+	}
+
 	switch {
 	case update.Message != nil:
 		chatId = update.Message.Chat.ChatID()
 	case update.CallbackQuery != nil:
-		chatId = update.CallbackQuery.Message.GetChat().ChatID()
+		if id, ok := CallbackChatID(update); ok {
+			chatId = id
+		} else {
+			user = update.CallbackQuery.From
+		}
 	case update.EditedMessage != nil:
 		chatId = update.EditedMessage.Chat.ChatID()
 	case update.ChannelPost != nil:
-		if update.ChannelPost.PinnedMessage != nil {
-			chatId = update.ChannelPost.PinnedMessage.GetChat().ChatID()
-		}
 		chatId = update.ChannelPost.Chat.ChatID()
 	case update.EditedChannelPost != nil:
 		chatId = update.EditedChannelPost.Chat.ChatID()
@@ -204,6 +716,8 @@ func DefaultChatKeyAndID(update telego.Update) (string, telego.ChatID, bool) {
 		user = update.PreCheckoutQuery.From
 	case update.PurchasedPaidMedia != nil:
 		user = update.PurchasedPaidMedia.From
+	case update.BusinessConnection != nil:
+		user = update.BusinessConnection.User
 	case update.PollAnswer != nil:
 		if update.PollAnswer.VoterChat != nil {
 			chatId = update.PollAnswer.VoterChat.ChatID()
@@ -219,9 +733,25 @@ func DefaultChatKeyAndID(update telego.Update) (string, telego.ChatID, bool) {
 	if user.ID != 0 {
 		return strconv.FormatInt(user.ID, 10), telego.ChatID{ID: user.ID}, true
 	}
+	if update.Poll != nil {
+		return "poll:" + update.Poll.ID, telego.ChatID{}, true
+	}
 	return "", telego.ChatID{}, false
 }
 
+// businessChat returns the business connection ID and the chat of business message updates.
+func businessChat(update telego.Update) (string, telego.Chat, bool) {
+	switch {
+	case update.BusinessMessage != nil:
+		return update.BusinessMessage.BusinessConnectionID, update.BusinessMessage.Chat, true
+	case update.EditedBusinessMessage != nil:
+		return update.EditedBusinessMessage.BusinessConnectionID, update.EditedBusinessMessage.Chat, true
+	case update.DeletedBusinessMessages != nil:
+		return update.DeletedBusinessMessages.BusinessConnectionID, update.DeletedBusinessMessages.Chat, true
+	}
+	return "", telego.Chat{}, false
+}
+
 // Executor runs handler functions for each update.
 // Can be used to set up a worker pool for processing updates.
 type Executor func(func())
@@ -240,56 +770,112 @@ func DefaultExecutor(f func()) {
 	go f()
 }
 
+// Update types returned by GetTypeOfUpdate.
+const (
+	UpdateTypeMessage                 = "message"
+	UpdateTypeEditedMessage           = "edited_message"
+	UpdateTypeChannelPost             = "channel_post"
+	UpdateTypeEditedChannelPost       = "edited_channel_post"
+	UpdateTypeMessageReaction         = "message_reaction"
+	UpdateTypeMessageReactionCount    = "message_reaction_count"
+	UpdateTypeCallbackQuery           = "callback_query"
+	UpdateTypeInlineQuery             = "inline_query"
+	UpdateTypeChosenInlineResult      = "chosen_inline_result"
+	UpdateTypeShippingQuery           = "shipping_query"
+	UpdateTypePreCheckoutQuery        = "pre_checkout_query"
+	UpdateTypePurchasedPaidMedia      = "purchased_paid_media"
+	UpdateTypePoll                    = "poll"
+	UpdateTypePollAnswer              = "poll_answer"
+	UpdateTypeMyChatMember            = "my_chat_member"
+	UpdateTypeChatMember              = "chat_member"
+	UpdateTypeChatJoinRequest         = "chat_join_request"
+	UpdateTypeChatBoost               = "chat_boost"
+	UpdateTypeRemovedChatBoost        = "removed_chat_boost"
+	UpdateTypeBusinessConnection      = "business_connection"
+	UpdateTypeBusinessMessage         = "business_message"
+	UpdateTypeEditedBusinessMessage   = "edited_business_message"
+	UpdateTypeDeletedBusinessMessages = "deleted_business_messages"
+	UpdateTypeUnknown                 = "<unknown>"
+)
+
+// updateTypes lists all update types returned by GetTypeOfUpdate.
+var updateTypes = []string{
+	UpdateTypeMessage,
+	UpdateTypeEditedMessage,
+	UpdateTypeChannelPost,
+	UpdateTypeEditedChannelPost,
+	UpdateTypeMessageReaction,
+	UpdateTypeMessageReactionCount,
+	UpdateTypeCallbackQuery,
+	UpdateTypeInlineQuery,
+	UpdateTypeChosenInlineResult,
+	UpdateTypeShippingQuery,
+	UpdateTypePreCheckoutQuery,
+	UpdateTypePurchasedPaidMedia,
+	UpdateTypePoll,
+	UpdateTypePollAnswer,
+	UpdateTypeMyChatMember,
+	UpdateTypeChatMember,
+	UpdateTypeChatJoinRequest,
+	UpdateTypeChatBoost,
+	UpdateTypeRemovedChatBoost,
+	UpdateTypeBusinessConnection,
+	UpdateTypeBusinessMessage,
+	UpdateTypeEditedBusinessMessage,
+	UpdateTypeDeletedBusinessMessages,
+	UpdateTypeUnknown,
+}
+
 // GetTypeOfUpdate returns a string representing the update type.
 // Useful for logging and debugging.
 func GetTypeOfUpdate(update telego.Update) string {
 	switch {
 	case update.Message != nil:
-		return "message"
+		return UpdateTypeMessage
 	case update.EditedMessage != nil:
-		return "edited_message"
+		return UpdateTypeEditedMessage
 	case update.ChannelPost != nil:
-		return "channel_post"
+		return UpdateTypeChannelPost
 	case update.EditedChannelPost != nil:
-		return "edited_channel_post"
+		return UpdateTypeEditedChannelPost
 	case update.MessageReaction != nil:
-		return "message_reaction"
+		return UpdateTypeMessageReaction
 	case update.MessageReactionCount != nil:
-		return "message_reaction_count"
+		return UpdateTypeMessageReactionCount
 	case update.CallbackQuery != nil:
-		return "callback_query"
+		return UpdateTypeCallbackQuery
 	case update.InlineQuery != nil:
-		return "inline_query"
+		return UpdateTypeInlineQuery
 	case update.ChosenInlineResult != nil:
-		return "chosen_inline_result"
+		return UpdateTypeChosenInlineResult
 	case update.ShippingQuery != nil:
-		return "shipping_query"
+		return UpdateTypeShippingQuery
 	case update.PreCheckoutQuery != nil:
-		return "pre_checkout_query"
+		return UpdateTypePreCheckoutQuery
 	case update.PurchasedPaidMedia != nil:
-		return "purchased_paid_media"
+		return UpdateTypePurchasedPaidMedia
 	case update.Poll != nil:
-		return "poll"
+		return UpdateTypePoll
 	case update.PollAnswer != nil:
-		return "poll_answer"
+		return UpdateTypePollAnswer
 	case update.MyChatMember != nil:
-		return "my_chat_member"
+		return UpdateTypeMyChatMember
 	case update.ChatMember != nil:
-		return "chat_member"
+		return UpdateTypeChatMember
 	case update.ChatJoinRequest != nil:
-		return "chat_join_request"
+		return UpdateTypeChatJoinRequest
 	case update.ChatBoost != nil:
-		return "chat_boost"
+		return UpdateTypeChatBoost
 	case update.RemovedChatBoost != nil:
-		return "removed_chat_boost"
+		return UpdateTypeRemovedChatBoost
 	case update.BusinessConnection != nil:
-		return "business_connection"
+		return UpdateTypeBusinessConnection
 	case update.BusinessMessage != nil:
-		return "business_message"
+		return UpdateTypeBusinessMessage
 	case update.EditedBusinessMessage != nil:
-		return "edited_business_message"
+		return UpdateTypeEditedBusinessMessage
 	case update.DeletedBusinessMessages != nil:
-		return "deleted_business_messages"
+		return UpdateTypeDeletedBusinessMessages
 	}
-	return "<unknown>"
+	return UpdateTypeUnknown
 }
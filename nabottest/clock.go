@@ -0,0 +1,86 @@
+// Package nabottest provides utilities for testing bots built with nabot.
+package nabottest
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a nabot.Clock whose time only moves when Advance or Set is called.
+// Timers created with After fire deterministically once the clock reaches their deadline.
+//
+// Example:
+//
+//	clock := nabottest.NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+//	app := nabot.NewApp(bot, updates, nabot.WithClock(clock))
+//	// ...
+//	clock.Advance(10 * time.Minute) // fires every timer due in the next 10 minutes
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock creates a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, fakeWaiter{deadline: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d and fires all timers that became due.
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(f.now.Add(d))
+}
+
+// Set moves the clock to t and fires all timers that became due.
+// Setting a time before the current time does not fire any timers.
+func (f *FakeClock) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setLocked(t)
+}
+
+// Waiters returns the number of timers that have not fired yet.
+// Useful to assert that a component is waiting before advancing the clock.
+func (f *FakeClock) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func (f *FakeClock) setLocked(t time.Time) {
+	f.now = t
+	pending := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.deadline.After(t) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- t
+	}
+	f.waiters = pending
+}
@@ -0,0 +1,54 @@
+package nabot
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+const (
+	zeroWidthJoiner = '\u200d'
+)
+
+// persianReplacer maps Arabic code points that clients send for Persian letters to their Persian forms.
+var persianReplacer = strings.NewReplacer(
+	"\u064a", "\u06cc", // Arabic yeh
+	"\u0649", "\u06cc", // Arabic alef maksura
+	"\u0643", "\u06a9", // Arabic kaf
+)
+
+// NormalizeText normalizes text for comparison, so that strings that look identical compare equal
+// regardless of the client that sent them. It applies NFC normalization, maps Arabic yeh and kaf
+// to their Persian forms, removes variation selectors and removes zero width joiners
+// that are not part of an emoji sequence. Zero width non-joiners are kept as they are meaningful in Persian.
+//
+// Handlers in the handlers package use it when matching text and callback data.
+func NormalizeText(s string) string {
+	s = persianReplacer.Replace(norm.NFC.String(s))
+	if !strings.ContainsFunc(s, isIgnorable) {
+		return s
+	}
+	runes := []rune(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	var prev rune
+	for i, r := range runes {
+		if unicode.Is(unicode.Variation_Selector, r) {
+			continue
+		}
+		if r == zeroWidthJoiner && !(isEmoji(prev) && i+1 < len(runes) && isEmoji(runes[i+1])) {
+			continue
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return b.String()
+}
+
+func isIgnorable(r rune) bool {
+	return r == zeroWidthJoiner || unicode.Is(unicode.Variation_Selector, r)
+}
+
+func isEmoji(r rune) bool {
+	return r >= 0x1f000 || (r >= 0x2600 && r <= 0x27bf) || unicode.Is(unicode.So, r)
+}
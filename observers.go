@@ -0,0 +1,99 @@
+package nabot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebhookObserver returns a TransitionObserver that POSTs each TransitionEvent as JSON to url.
+// Events are queued and posted one at a time by a background worker, so transitions are not delayed.
+// Events arriving while 256 events are already waiting are dropped; drops and failures are logged with logger.
+// If client is nil, a client with a timeout of 10 seconds is used.
+//
+// Example:
+//
+//	stateHandler := nabot.NewStateHandler(app,
+//	    nabot.WithTransitionObserver(nabot.WebhookObserver("https://crm.example.com/hooks/bot", nil, logger)),
+//	)
+func WebhookObserver(url string, client *http.Client, logger *slog.Logger) TransitionObserver {
+	if client == nil {
+		client = &http.Client{Timeout: webhookObserverTimeout}
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	queue := make(chan webhookEvent, webhookObserverQueue)
+	var start sync.Once
+	return func(ctx context.Context, event TransitionEvent) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			logger.Error("nabot: failed to marshal transition event", "error", err)
+			return
+		}
+		start.Do(func() {
+			go postEvents(queue, client, url, logger)
+		})
+		select {
+		case queue <- webhookEvent{ctx: context.WithoutCancel(ctx), chatKey: event.ChatKey, body: body}:
+		default:
+			logger.Warn("nabot: too many transition events waiting; dropping event", slog.String("chat", event.ChatKey))
+		}
+	}
+}
+
+const (
+	webhookObserverTimeout = 10 * time.Second
+	webhookObserverQueue   = 256
+)
+
+type webhookEvent struct {
+	ctx     context.Context
+	chatKey string
+	body    []byte
+}
+
+// postEvents posts the events of the queue in order, forever.
+func postEvents(queue <-chan webhookEvent, client *http.Client, url string, logger *slog.Logger) {
+	for e := range queue {
+		if err := postJSON(e.ctx, client, url, e.body); err != nil {
+			logger.Error("nabot: failed to post transition event",
+				"error", err,
+				slog.String("chat", e.chatKey),
+			)
+		}
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// ChannelObserver returns a TransitionObserver that sends each TransitionEvent to ch.
+// Events are dropped if ch is not ready to receive, so a slow consumer never blocks transitions.
+func ChannelObserver(ch chan<- TransitionEvent) TransitionObserver {
+	return func(_ context.Context, event TransitionEvent) {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
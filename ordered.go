@@ -0,0 +1,120 @@
+package nabot
+
+import (
+	"github.com/mymmrac/telego"
+	"slices"
+	"sync"
+)
+
+// WithOrderedUpdates guarantees that updates of the same chat are handled one at a time, in the order received.
+// The App partitions incoming updates by chat key into per-chat FIFO queues holding up to bufferPerChat updates,
+// and drains each queue with a single executor task. Updates of different chats are still handled concurrently.
+// Updates received while the queue of their chat is full are dropped, logged and reported to the Metrics
+// of the App, so a stuck chat never holds up the updates of other chats.
+//
+// Without this option, ordering depends on the Executor: DefaultExecutor gives no ordering guarantee.
+func WithOrderedUpdates(bufferPerChat int) AppOption {
+	if bufferPerChat < 1 {
+		bufferPerChat = 1
+	}
+	return func(a *App) {
+		a.ordered = &orderedQueues{
+			buffer: bufferPerChat,
+			queues: make(map[string]*chatQueue),
+		}
+	}
+}
+
+type orderedQueues struct {
+	buffer int
+	mu     sync.Mutex
+	queues map[string]*chatQueue
+}
+
+// chatQueue holds the updates of a chat waiting for its drain task; guarded by orderedQueues.mu.
+type chatQueue struct {
+	updates []telego.Update
+}
+
+// dispatchOrdered pushes the update to its chat queue, starting a drain task if the queue is idle.
+// The update is dropped if the chat queue is full.
+func (a *App) dispatchOrdered(update telego.Update) {
+	chatKey, _, ok := a.extractChatInfo(update)
+	if !ok {
+		a.dispatch(update)
+		return
+	}
+	a.enqueueOrdered(chatKey, update, true)
+}
+
+// enqueueOrdered pushes the update to the queue of the chat, starting a drain task if the queue is idle.
+// If bounded, the update is dropped if the chat queue is full.
+func (a *App) enqueueOrdered(chatKey string, update telego.Update, bounded bool) {
+	o := a.ordered
+	o.mu.Lock()
+	q, exists := o.queues[chatKey]
+	if bounded && exists && len(q.updates) >= o.buffer {
+		o.mu.Unlock()
+		a.dropChatUpdate(update)
+		return
+	}
+	if !exists {
+		q = &chatQueue{}
+		o.queues[chatKey] = q
+	}
+	queued := queuedUpdate(update)
+	q.updates = append(q.updates, queued)
+	if adm := admissionOf(update); adm != nil {
+		adm.remove = func() {
+			a.removeOrdered(chatKey, queued)
+		}
+	}
+	a.wg.Add(1)
+	o.mu.Unlock()
+
+	if !exists {
+		a.executor(func() {
+			a.drain(chatKey, q)
+		})
+	}
+}
+
+func (a *App) drain(chatKey string, q *chatQueue) {
+	o := a.ordered
+	for {
+		o.mu.Lock()
+		if len(q.updates) == 0 {
+			delete(o.queues, chatKey)
+			o.mu.Unlock()
+			return
+		}
+		update := q.updates[0]
+		q.updates = q.updates[1:]
+		o.mu.Unlock()
+
+		a.processUpdate(update)
+		a.wg.Done()
+	}
+}
+
+// removeOrdered removes a dropped update from the queue of its chat, if it is still queued.
+func (a *App) removeOrdered(chatKey string, update telego.Update) {
+	o := a.ordered
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q, ok := o.queues[chatKey]
+	if !ok {
+		return
+	}
+	if i := indexOfAdmission(q.updates, admissionOf(update)); i >= 0 {
+		q.updates = slices.Delete(q.updates, i, i+1)
+		a.wg.Done()
+	}
+}
+
+// indexOfAdmission returns the index of the queued update of adm in updates, or -1.
+func indexOfAdmission(updates []telego.Update, adm *admission) int {
+	return slices.IndexFunc(updates, func(u telego.Update) bool {
+		return admissionOf(u) == adm
+	})
+}
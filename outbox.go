@@ -0,0 +1,302 @@
+package nabot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mymmrac/telego"
+	"github.com/mymmrac/telego/telegoapi"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OutboxStateStorage is a StateStorage that commits a stack update together with the messages
+// sent by the Render of the new state, in one transaction.
+// When the StateHandler storage implements it, messages sent with QueueMessage during a transition
+// are written to the outbox instead of being sent, and an OutboxDispatcher sends them afterward.
+// This guarantees users never end up in a state whose Render messages were lost on a crash.
+//
+// An in-memory implementation is available via NewInMemoryOutboxStateStore.
+type OutboxStateStorage interface {
+	StateStorage
+	// SetStackWithOutbox stores the stack and appends the messages to the outbox atomically.
+	SetStackWithOutbox(ctx context.Context, chatKey string, stack []byte, messages [][]byte) error
+	// PendingOutbox returns up to limit unsent outbox entries, oldest first.
+	PendingOutbox(ctx context.Context, limit int) ([]OutboxEntry, error)
+	// AckOutbox removes a sent entry from the outbox.
+	AckOutbox(ctx context.Context, id string) error
+}
+
+// OutboxEntry is a message waiting in the outbox.
+type OutboxEntry struct {
+	ID      string
+	ChatKey string
+	Message []byte
+}
+
+type memoryOutboxStore struct {
+	memoryStateStore
+	mu     sync.Mutex
+	nextID int
+	outbox []OutboxEntry
+}
+
+// NewInMemoryOutboxStateStore creates an in-memory state storage with an outbox.
+func NewInMemoryOutboxStateStore() OutboxStateStorage {
+	return &memoryOutboxStore{}
+}
+
+func (m *memoryOutboxStore) SetStackWithOutbox(_ context.Context, chatKey string, stack []byte, messages [][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data.Store(chatKey, stack)
+	for _, msg := range messages {
+		m.nextID++
+		m.outbox = append(m.outbox, OutboxEntry{
+			ID:      strconv.Itoa(m.nextID),
+			ChatKey: chatKey,
+			Message: msg,
+		})
+	}
+	return nil
+}
+
+func (m *memoryOutboxStore) PendingOutbox(_ context.Context, limit int) ([]OutboxEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := min(limit, len(m.outbox))
+	result := make([]OutboxEntry, n)
+	copy(result, m.outbox[:n])
+	return result, nil
+}
+
+func (m *memoryOutboxStore) AckOutbox(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, e := range m.outbox {
+		if e.ID == id {
+			m.outbox = append(m.outbox[:i], m.outbox[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+type outboxKey struct{}
+
+type outboxBuffer struct {
+	messages [][]byte
+}
+
+// outboxContext collects the messages queued by a Render during a transition.
+type outboxContext struct {
+	TransitionContext
+	buffer *outboxBuffer
+}
+
+func (o outboxContext) Value(key any) any {
+	if key == (outboxKey{}) {
+		return o.buffer
+	}
+	return o.TransitionContext.Value(key)
+}
+
+// outboxMessage is the serialized form of telego.SendMessageParams.
+// ReplyMarkup is kept raw as telego.ReplyMarkup is an interface.
+type outboxMessage struct {
+	telego.SendMessageParams
+	ReplyMarkup json.RawMessage `json:"reply_markup,omitempty"`
+}
+
+// QueueMessage sends a message from a state's Render.
+// During a transition of a StateHandler using an OutboxStateStorage, the message is committed to the outbox
+// together with the new stack and sent later by an OutboxDispatcher. Otherwise, it is sent immediately.
+//
+// Example:
+//
+//	func (s *myState) Render(ctx nabot.TransitionContext) error {
+//	    return nabot.QueueMessage(ctx, tu.Message(ctx.ChatID(), "Welcome!"))
+//	}
+func QueueMessage(ctx TransitionContext, params *telego.SendMessageParams) error {
+	buffer, ok := ctx.Value(outboxKey{}).(*outboxBuffer)
+	if !ok {
+		_, err := ctx.Bot().SendMessage(ctx, params)
+		return err
+	}
+	msg, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	buffer.messages = append(buffer.messages, msg)
+	return nil
+}
+
+// OutboxDispatcher sends the messages committed to an OutboxStateStorage.
+//
+// Example:
+//
+//	store := nabot.NewInMemoryOutboxStateStore()
+//	stateHandler := nabot.NewStateHandler(app, nabot.WithStateStore(store))
+//	go nabot.NewOutboxDispatcher(app, store).Run(ctx)
+type OutboxDispatcher struct {
+	app      *App
+	storage  OutboxStateStorage
+	interval time.Duration
+	batch    int
+	// retries holds the backoff of the chats whose last message failed with a retryable error.
+	retries map[string]outboxRetry
+}
+
+type outboxRetry struct {
+	at    time.Time
+	delay time.Duration
+}
+
+// maxOutboxBackoff caps the delay between retries of the messages of a chat.
+const maxOutboxBackoff = 5 * time.Minute
+
+// NewOutboxDispatcher creates a dispatcher sending the outbox of storage with the App's bot.
+func NewOutboxDispatcher(app *App, storage OutboxStateStorage, options ...OutboxDispatcherOption) *OutboxDispatcher {
+	d := &OutboxDispatcher{
+		app:      app,
+		storage:  storage,
+		interval: time.Second,
+		batch:    100,
+		retries:  make(map[string]outboxRetry),
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// Run sends pending messages periodically and blocks until ctx is done.
+// Messages failing with a retryable error are kept and retried with a backoff per chat, doubling from the
+// interval up to five minutes. The later messages of the chat wait for them, so they are sent in order,
+// while the messages of other chats are still sent.
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	for {
+		d.dispatch(ctx)
+		select {
+		case <-d.app.clock.After(d.interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *OutboxDispatcher) dispatch(ctx context.Context) {
+	entries, err := d.storage.PendingOutbox(ctx, d.batch)
+	if err != nil {
+		d.app.logger.Error("nabot: failed to read outbox", "error", err)
+		return
+	}
+	now := d.app.clock.Now()
+	// waiting holds the chats with a message to retry, whose later messages are not sent yet to keep their order
+	waiting := make(map[string]bool)
+	for _, e := range entries {
+		if waiting[e.ChatKey] {
+			continue
+		}
+		if retry, ok := d.retries[e.ChatKey]; ok && now.Before(retry.at) {
+			waiting[e.ChatKey] = true
+			continue
+		}
+		err = d.send(ctx, e)
+		if err != nil && isRetryable(err) {
+			d.app.logger.Warn("nabot: failed to send outbox message; will retry", "error", err, "chat", e.ChatKey)
+			d.backOff(e.ChatKey, now)
+			waiting[e.ChatKey] = true
+			continue
+		}
+		delete(d.retries, e.ChatKey)
+		if err != nil {
+			d.app.logger.Error("nabot: failed to send outbox message; dropping", "error", err, "chat", e.ChatKey)
+		}
+		if err = d.storage.AckOutbox(ctx, e.ID); err != nil {
+			d.app.logger.Error("nabot: failed to ack outbox message", "error", err)
+			return
+		}
+	}
+}
+
+// backOff delays the next attempt of the chat, doubling the delay of its previous attempt.
+func (d *OutboxDispatcher) backOff(chatKey string, now time.Time) {
+	delay := d.interval
+	if retry, ok := d.retries[chatKey]; ok {
+		delay = min(2*retry.delay, maxOutboxBackoff)
+	}
+	d.retries[chatKey] = outboxRetry{at: now.Add(delay), delay: delay}
+}
+
+// errMalformedOutbox marks outbox entries that cannot be decoded. They never succeed, so they are dropped.
+var errMalformedOutbox = errors.New("malformed outbox message")
+
+func (d *OutboxDispatcher) send(ctx context.Context, e OutboxEntry) error {
+	var msg outboxMessage
+	if err := json.Unmarshal(e.Message, &msg); err != nil {
+		return fmt.Errorf("%w: %w", errMalformedOutbox, err)
+	}
+	params := msg.SendMessageParams
+	markup, err := decodeReplyMarkup(msg.ReplyMarkup)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errMalformedOutbox, err)
+	}
+	params.ReplyMarkup = markup
+	_, err = d.app.bot.SendMessage(ctx, &params)
+	return err
+}
+
+// isRetryable reports whether a send error may succeed later, like network errors, rate limiting
+// or server errors. Malformed entries and other API errors are permanent.
+func isRetryable(err error) bool {
+	if errors.Is(err, errMalformedOutbox) {
+		return false
+	}
+	var apiErr *telegoapi.Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return apiErr.ErrorCode == http.StatusTooManyRequests || apiErr.ErrorCode >= 500
+}
+
+func decodeReplyMarkup(raw json.RawMessage) (telego.ReplyMarkup, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reply markup: %w", err)
+	}
+	var markup telego.ReplyMarkup
+	switch {
+	case keys["inline_keyboard"] != nil:
+		markup = &telego.InlineKeyboardMarkup{}
+	case keys["keyboard"] != nil:
+		markup = &telego.ReplyKeyboardMarkup{}
+	case keys["remove_keyboard"] != nil:
+		markup = &telego.ReplyKeyboardRemove{}
+	case keys["force_reply"] != nil:
+		markup = &telego.ForceReply{}
+	default:
+		return nil, errors.New("unknown reply markup")
+	}
+	if err := json.Unmarshal(raw, markup); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reply markup: %w", err)
+	}
+	return markup, nil
+}
+
+// OutboxDispatcherOption configures an OutboxDispatcher.
+type OutboxDispatcherOption func(*OutboxDispatcher)
+
+// WithOutboxInterval sets how often the outbox is checked for pending messages.
+// Default is one second.
+func WithOutboxInterval(interval time.Duration) OutboxDispatcherOption {
+	return func(d *OutboxDispatcher) {
+		d.interval = interval
+	}
+}
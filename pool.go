@@ -0,0 +1,223 @@
+package nabot
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// WorkerPool runs tasks on a fixed number of goroutines with a bounded queue.
+// Its size and queue limit can be changed at runtime with Resize and SetQueueLimit,
+// so operators can react to load spikes without restarting the bot.
+// Use its Execute method as the App's Executor, and Close it once the App is stopped.
+//
+// WorkerPool also implements http.Handler to be mounted on an admin server:
+// GET returns the current configuration and metrics as JSON and POST updates the configuration
+// from the "size" and "queue" form values; see ServeHTTP.
+//
+// Example:
+//
+//	pool := nabot.NewWorkerPool(16, 256)
+//	app := nabot.NewApp(bot, updates, nabot.WithExecutor(pool.Execute))
+//	adminMux.Handle("/executor", pool)
+//	// later
+//	pool.Resize(64)
+//	// on shutdown, after app.Stop()
+//	pool.Close()
+type WorkerPool struct {
+	mu         sync.Mutex
+	hasTask    *sync.Cond
+	hasSpace   *sync.Cond
+	tasks      []func()
+	queueLimit int
+	size       int
+	running    int
+	busy       int
+	executed   uint64
+	blocked    uint64
+	closed     bool
+	// workers counts the running worker goroutines, waited for by Close.
+	workers sync.WaitGroup
+}
+
+// WorkerPoolStats are the metrics of a WorkerPool.
+type WorkerPoolStats struct {
+	Size       int `json:"size"`
+	QueueLimit int `json:"queue"`
+	// Queued is the number of tasks waiting for a worker.
+	Queued int `json:"queued"`
+	// Busy is the number of workers running a task.
+	Busy int `json:"busy"`
+	// Executed is the number of tasks completed.
+	Executed uint64 `json:"executed"`
+	// Blocked is the number of Execute calls that waited for room in the queue, a sign the pool is too small.
+	Blocked uint64 `json:"blocked"`
+}
+
+// NewWorkerPoolExecutor returns an Executor running updates on size workers and queueing up to queue updates.
+// When the queue is full, the App stops reading updates until a worker is free, applying backpressure
+// instead of starting unbounded goroutines. Use NewWorkerPool to resize the pool or read its metrics.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates, nabot.WithExecutor(nabot.NewWorkerPoolExecutor(32, 512)))
+func NewWorkerPoolExecutor(size int, queue int) Executor {
+	return NewWorkerPool(size, queue).Execute
+}
+
+// NewWorkerPool creates a worker pool running size workers and queueing up to queue tasks.
+func NewWorkerPool(size int, queue int) *WorkerPool {
+	p := &WorkerPool{}
+	p.hasTask = sync.NewCond(&p.mu)
+	p.hasSpace = sync.NewCond(&p.mu)
+	p.SetQueueLimit(queue)
+	p.Resize(size)
+	return p
+}
+
+// Execute queues the task, blocking while the queue is full.
+// After Close, the task is run on its own goroutine instead.
+func (p *WorkerPool) Execute(task func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.tasks) >= p.queueLimit && !p.closed {
+		p.blocked++
+	}
+	for len(p.tasks) >= p.queueLimit && !p.closed {
+		p.hasSpace.Wait()
+	}
+	if p.closed {
+		go task()
+		return
+	}
+	p.tasks = append(p.tasks, task)
+	p.hasTask.Signal()
+}
+
+// Close stops the workers once the queued tasks are done, and waits for them to exit.
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.hasTask.Broadcast()
+	p.hasSpace.Broadcast()
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// Resize changes the number of workers. Excess workers exit after finishing their current task.
+func (p *WorkerPool) Resize(size int) {
+	size = max(size, 1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.size = size
+	for p.running < p.size && !p.closed {
+		p.running++
+		p.workers.Add(1)
+		go p.work()
+	}
+	// wake idle workers so excess ones exit
+	p.hasTask.Broadcast()
+}
+
+// SetQueueLimit changes the number of tasks that can wait for a worker.
+// Lowering the limit does not drop tasks already queued.
+func (p *WorkerPool) SetQueueLimit(queue int) {
+	queue = max(queue, 1)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queueLimit = queue
+	p.hasSpace.Broadcast()
+}
+
+// Size returns the number of workers.
+func (p *WorkerPool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.size
+}
+
+// QueueLimit returns the number of tasks that can wait for a worker.
+func (p *WorkerPool) QueueLimit() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queueLimit
+}
+
+// Stats returns the current metrics of the pool.
+func (p *WorkerPool) Stats() WorkerPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return WorkerPoolStats{
+		Size:       p.size,
+		QueueLimit: p.queueLimit,
+		Queued:     len(p.tasks),
+		Busy:       p.busy,
+		Executed:   p.executed,
+		Blocked:    p.blocked,
+	}
+}
+
+func (p *WorkerPool) work() {
+	defer p.workers.Done()
+	p.mu.Lock()
+	for {
+		for len(p.tasks) == 0 && p.running <= p.size && !p.closed {
+			p.hasTask.Wait()
+		}
+		if p.running > p.size || (p.closed && len(p.tasks) == 0) {
+			p.running--
+			p.mu.Unlock()
+			return
+		}
+		task := p.tasks[0]
+		p.tasks[0] = nil
+		p.tasks = p.tasks[1:]
+		p.hasSpace.Signal()
+		p.busy++
+		p.mu.Unlock()
+
+		task()
+
+		p.mu.Lock()
+		p.busy--
+		p.executed++
+	}
+}
+
+// ServeHTTP returns the configuration and metrics of the pool as JSON. A POST first sets the size and
+// queue limit from the "size" and "queue" form values, if given; the values are all validated before
+// any is applied, so an invalid request changes nothing.
+func (p *WorkerPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		size, queue := 0, 0
+		if v := r.FormValue("size"); v != "" {
+			var err error
+			if size, err = strconv.Atoi(v); err != nil || size < 1 {
+				http.Error(w, "invalid size", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := r.FormValue("queue"); v != "" {
+			var err error
+			if queue, err = strconv.Atoi(v); err != nil || queue < 1 {
+				http.Error(w, "invalid queue", http.StatusBadRequest)
+				return
+			}
+		}
+		if size > 0 {
+			p.Resize(size)
+		}
+		if queue > 0 {
+			p.SetQueueLimit(queue)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p.Stats())
+}
@@ -0,0 +1,28 @@
+module github.com/bale-ir/nabot/queues/kafkaqueue
+
+go 1.24.7
+
+require (
+	github.com/bale-ir/nabot v0.0.0
+	github.com/mymmrac/telego v1.3.0
+	github.com/segmentio/kafka-go v0.4.48
+)
+
+require (
+	github.com/andybalholm/brotli v1.2.0 // indirect
+	github.com/bytedance/sonic v1.14.0 // indirect
+	github.com/bytedance/sonic/loader v0.3.0 // indirect
+	github.com/cloudwego/base64x v0.1.5 // indirect
+	github.com/grbit/go-json v0.11.0 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasthttp v1.65.0 // indirect
+	github.com/valyala/fastjson v1.6.4 // indirect
+	golang.org/x/arch v0.0.0-20210923205945-b76863e36670 // indirect
+	golang.org/x/text v0.28.0 // indirect
+)
+
+replace github.com/bale-ir/nabot => ../..
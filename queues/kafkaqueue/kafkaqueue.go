@@ -0,0 +1,72 @@
+// Package kafkaqueue consumes and publishes the updates of a nabot.App with Kafka,
+// so several workers share the updates of a bot.
+//
+// Updates are keyed by chat, so the updates of a chat stay in one partition, in order.
+//
+// Example:
+//
+//	// publisher, a single process receiving updates from the Bale server:
+//	writer := &kafka.Writer{Addr: kafka.TCP("kafka:9092"), Topic: "bot-updates", Balancer: &kafka.Hash{}}
+//	err := nabot.PublishUpdates(ctx, nabot.LongPollingSource(bot, nil), kafkaqueue.Publisher(writer))
+//
+//	// workers, in one consumer group:
+//	reader := kafka.NewReader(kafka.ReaderConfig{
+//	    Brokers: []string{"kafka:9092"},
+//	    GroupID: "bot-workers",
+//	    Topic:   "bot-updates",
+//	})
+//	app := nabot.NewApp(bot, nil, nabot.WithOrderedUpdates(16))
+//	err = app.RunSource(ctx, nabot.QueueSource(kafkaqueue.NewReceiver(reader)))
+package kafkaqueue
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"github.com/segmentio/kafka-go"
+)
+
+// Receiver is a nabot.QueueReceiver fetching updates from a kafka.Reader of a consumer group.
+// Updates are acknowledged by committing their offset once handled.
+//
+// Kafka commits offsets, not single messages: committing an update also commits the earlier updates
+// of its partition, even if they are still being handled, so they are not redelivered if the worker
+// crashes meanwhile. Handle updates in order, such as with nabot.WithOrderedUpdates, to limit this window.
+type Receiver struct {
+	reader *kafka.Reader
+}
+
+var _ nabot.QueueReceiver = (*Receiver)(nil)
+
+// NewReceiver creates a Receiver fetching from reader, which must have a GroupID.
+func NewReceiver(reader *kafka.Reader) *Receiver {
+	return &Receiver{reader: reader}
+}
+
+func (r *Receiver) Receive(ctx context.Context) ([]byte, func() error, error) {
+	msg, err := r.reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	ack := func() error {
+		return r.reader.CommitMessages(context.Background(), msg)
+	}
+	return msg.Value, ack, nil
+}
+
+// Publisher returns a function writing updates with writer, for nabot.PublishUpdates.
+// Messages are keyed by the chat key of nabot.DefaultChatKeyAndID; use a key-hashing balancer
+// such as kafka.Hash to keep the updates of a chat in one partition.
+func Publisher(writer *kafka.Writer) func(ctx context.Context, data []byte) error {
+	return func(ctx context.Context, data []byte) error {
+		msg := kafka.Message{Value: data}
+		var update telego.Update
+		if err := json.Unmarshal(data, &update); err == nil {
+			if chatKey, _, ok := nabot.DefaultChatKeyAndID(update); ok {
+				msg.Key = []byte(chatKey)
+			}
+		}
+		return writer.WriteMessages(ctx, msg)
+	}
+}
@@ -0,0 +1,85 @@
+// Package natsqueue consumes and publishes the updates of a nabot.App with NATS JetStream,
+// so several workers share the updates of a bot.
+//
+// Example:
+//
+//	js, err := jetstream.New(nc)
+//	// ...
+//	// publisher, a single process receiving updates from the Bale server:
+//	err = nabot.PublishUpdates(ctx, nabot.LongPollingSource(bot, nil), natsqueue.Publisher(js, "bot.updates"))
+//
+//	// workers, sharing a durable pull consumer of a stream bound to "bot.updates":
+//	consumer, err := js.CreateOrUpdateConsumer(ctx, "BOT", jetstream.ConsumerConfig{
+//	    Durable:   "workers",
+//	    AckPolicy: jetstream.AckExplicitPolicy,
+//	})
+//	// ...
+//	err = app.RunSource(ctx, nabot.QueueSource(natsqueue.NewReceiver(consumer)))
+package natsqueue
+
+import (
+	"context"
+	"errors"
+	"github.com/bale-ir/nabot"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"time"
+)
+
+// Receiver is a nabot.QueueReceiver fetching updates from a JetStream pull consumer, one at a time.
+// Updates are acknowledged once handled; the consumer should use jetstream.AckExplicitPolicy,
+// so updates not acknowledged within its AckWait are redelivered.
+type Receiver struct {
+	consumer jetstream.Consumer
+	wait     time.Duration
+}
+
+var _ nabot.QueueReceiver = (*Receiver)(nil)
+
+// NewReceiver creates a Receiver fetching from consumer.
+func NewReceiver(consumer jetstream.Consumer, options ...ReceiverOption) *Receiver {
+	r := &Receiver{
+		consumer: consumer,
+		wait:     5 * time.Second,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+func (r *Receiver) Receive(ctx context.Context) ([]byte, func() error, error) {
+	for {
+		// Next does not take a context, so it waits for a bounded time and ctx is checked between waits
+		msg, err := r.consumer.Next(jetstream.FetchMaxWait(r.wait))
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return msg.Data(), msg.Ack, nil
+	}
+}
+
+// Publisher returns a function publishing updates to subject, for nabot.PublishUpdates.
+func Publisher(js jetstream.JetStream, subject string) func(ctx context.Context, data []byte) error {
+	return func(ctx context.Context, data []byte) error {
+		_, err := js.Publish(ctx, subject, data)
+		return err
+	}
+}
+
+// ReceiverOption configures a Receiver.
+type ReceiverOption func(*Receiver)
+
+// WithFetchWait sets how long a fetch waits for an update before checking whether the App stopped.
+// Default is five seconds.
+func WithFetchWait(wait time.Duration) ReceiverOption {
+	return func(r *Receiver) {
+		r.wait = wait
+	}
+}
@@ -0,0 +1,145 @@
+// Package redisqueue consumes and publishes the updates of a nabot.App with Redis Streams,
+// so several workers share the updates of a bot.
+//
+// Example:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "redis:6379"})
+//	// publisher, a single process receiving updates from the Bale server:
+//	err := nabot.PublishUpdates(ctx, nabot.LongPollingSource(bot, nil), redisqueue.Publisher(rdb, "bot:updates", 100000))
+//
+//	// workers, each with its own consumer name in the group:
+//	receiver := redisqueue.NewReceiver(rdb, "bot:updates", "workers", hostname)
+//	err = receiver.CreateGroup(ctx)
+//	// ...
+//	err = app.RunSource(ctx, nabot.QueueSource(receiver))
+package redisqueue
+
+import (
+	"context"
+	"errors"
+	"github.com/bale-ir/nabot"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+// updateField is the field of stream entries holding the update.
+const updateField = "update"
+
+// Receiver is a nabot.QueueReceiver reading updates from a stream with a consumer group.
+// Updates are acknowledged with XACK once handled. Entries left pending by a crashed consumer
+// for longer than the claim timeout are claimed with XAUTOCLAIM and redelivered, which requires Redis 6.2.
+type Receiver struct {
+	client   redis.UniversalClient
+	stream   string
+	group    string
+	consumer string
+	block    time.Duration
+	minIdle  time.Duration
+}
+
+var _ nabot.QueueReceiver = (*Receiver)(nil)
+
+// NewReceiver creates a Receiver reading stream as consumer of group.
+// Consumer names must be unique among the workers of the group.
+func NewReceiver(client redis.UniversalClient, stream, group, consumer string, options ...ReceiverOption) *Receiver {
+	r := &Receiver{
+		client:   client,
+		stream:   stream,
+		group:    group,
+		consumer: consumer,
+		block:    5 * time.Second,
+		minIdle:  5 * time.Minute,
+	}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// CreateGroup creates the consumer group and the stream if they do not exist.
+// New groups start with the updates published after their creation.
+func (r *Receiver) CreateGroup(ctx context.Context) error {
+	err := r.client.XGroupCreateMkStream(ctx, r.stream, r.group, "$").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+func (r *Receiver) Receive(ctx context.Context) ([]byte, func() error, error) {
+	for {
+		claimed, _, err := r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   r.stream,
+			Group:    r.group,
+			Consumer: r.consumer,
+			MinIdle:  r.minIdle,
+			Start:    "0",
+			Count:    1,
+		}).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(claimed) > 0 {
+			return r.entry(claimed[0])
+		}
+		streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    r.group,
+			Consumer: r.consumer,
+			Streams:  []string{r.stream, ">"},
+			Count:    1,
+			Block:    r.block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(streams) > 0 && len(streams[0].Messages) > 0 {
+			return r.entry(streams[0].Messages[0])
+		}
+	}
+}
+
+// entry returns the update of a stream entry and the function acknowledging it.
+// Entries without an update are returned empty, so QueueSource drops and acknowledges them.
+func (r *Receiver) entry(msg redis.XMessage) ([]byte, func() error, error) {
+	ack := func() error {
+		return r.client.XAck(context.Background(), r.stream, r.group, msg.ID).Err()
+	}
+	data, _ := msg.Values[updateField].(string)
+	return []byte(data), ack, nil
+}
+
+// Publisher returns a function adding updates to stream, for nabot.PublishUpdates.
+// The stream is trimmed to about maxLen entries; zero keeps all entries.
+func Publisher(client redis.UniversalClient, stream string, maxLen int64) func(ctx context.Context, data []byte) error {
+	return func(ctx context.Context, data []byte) error {
+		return client.XAdd(ctx, &redis.XAddArgs{
+			Stream: stream,
+			MaxLen: maxLen,
+			Approx: maxLen > 0,
+			Values: map[string]any{updateField: data},
+		}).Err()
+	}
+}
+
+// ReceiverOption configures a Receiver.
+type ReceiverOption func(*Receiver)
+
+// WithBlock sets how long a read waits for an update before checking for entries to claim.
+// Default is five seconds.
+func WithBlock(block time.Duration) ReceiverOption {
+	return func(r *Receiver) {
+		r.block = block
+	}
+}
+
+// WithClaimTimeout sets how long an entry stays pending with another consumer before it is claimed
+// and redelivered. It must be longer than the handling of an update. Default is five minutes.
+func WithClaimTimeout(minIdle time.Duration) ReceiverOption {
+	return func(r *Receiver) {
+		r.minIdle = minIdle
+	}
+}
@@ -0,0 +1,117 @@
+package nabot
+
+import (
+	"errors"
+	"github.com/mymmrac/telego"
+	"time"
+)
+
+// ReachabilityStatus tells whether the bot can send messages to a chat.
+type ReachabilityStatus string
+
+const (
+	// ReachabilityMember means the bot is a member of the chat, or the user has not blocked it.
+	ReachabilityMember ReachabilityStatus = "member"
+	// ReachabilityBlocked means the user blocked the bot in a private chat.
+	ReachabilityBlocked ReachabilityStatus = "blocked"
+	// ReachabilityKicked means the bot was removed from a group or channel.
+	ReachabilityKicked ReachabilityStatus = "kicked"
+	// ReachabilityLeft means the bot left a group or channel.
+	ReachabilityLeft ReachabilityStatus = "left"
+)
+
+// Reachability is the reachability of a chat, stored in its DataStorage by ReachabilityTracker.
+type Reachability struct {
+	Status ReachabilityStatus `json:"status"`
+	Since  time.Time          `json:"since"`
+}
+
+const (
+	reachabilityKey DataKey[Reachability] = "reachability"
+)
+
+// ReachabilityTracker records the reachability of chats from my_chat_member updates,
+// so broadcasts and scheduled messages can skip users who blocked the bot.
+// It records the update and returns ErrPass, so handlers registered after it also receive it.
+//
+// Example:
+//
+//	app.Handle(&nabot.ReachabilityTracker{
+//	    OnUserReturned: func(ctx nabot.Context) error {
+//	        _, err := ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Welcome back!"))
+//	        return err
+//	    },
+//	})
+//	// later
+//	ok, err := nabot.IsReachable(ctx, chatKey)
+type ReachabilityTracker struct {
+	// OnUserReturned is called when a user who blocked the bot unblocks it.
+	OnUserReturned func(ctx Context) error
+}
+
+func (r *ReachabilityTracker) Name() string {
+	return "reachability_tracker"
+}
+
+func (r *ReachabilityTracker) UpdateTypes() []string {
+	return []string{UpdateTypeMyChatMember}
+}
+
+func (r *ReachabilityTracker) Handle(ctx Context) error {
+	member := ctx.Update().MyChatMember
+	if member == nil {
+		return ErrPass
+	}
+	previous, err := GetReachability(ctx, ctx.ChatKey())
+	if err != nil {
+		return err
+	}
+	status := reachabilityOf(member.Chat, member.NewChatMember)
+	if status == previous.Status {
+		return ErrPass
+	}
+	err = Set(ctx, reachabilityKey, Reachability{
+		Status: status,
+		Since:  ClockOf(ctx).Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if previous.Status == ReachabilityBlocked && status == ReachabilityMember && r.OnUserReturned != nil {
+		if err = r.OnUserReturned(ctx); err != nil {
+			return err
+		}
+	}
+	return ErrPass
+}
+
+func reachabilityOf(chat telego.Chat, member telego.ChatMember) ReachabilityStatus {
+	switch member.MemberStatus() {
+	case telego.MemberStatusBanned:
+		if chat.Type == telego.ChatTypePrivate {
+			return ReachabilityBlocked
+		}
+		return ReachabilityKicked
+	case telego.MemberStatusLeft:
+		return ReachabilityLeft
+	default:
+		return ReachabilityMember
+	}
+}
+
+// GetReachability returns the reachability of the chat with the given key.
+// Chats without recorded my_chat_member updates are reported as ReachabilityMember with a zero Since.
+func GetReachability(c StorageContext, chatKey string) (Reachability, error) {
+	r, err := Get(ForChat(c, chatKey), reachabilityKey)
+	if errors.Is(err, ErrDataKeyNotFound) {
+		return Reachability{Status: ReachabilityMember}, nil
+	}
+	return r, err
+}
+
+// IsReachable reports whether the bot can send messages to the chat with the given key,
+// as recorded by ReachabilityTracker.
+func IsReachable(c StorageContext, chatKey string) (bool, error) {
+	r, err := GetReachability(c, chatKey)
+	return r.Status == ReachabilityMember, err
+}
@@ -0,0 +1,104 @@
+package nabot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mymmrac/telego"
+	"log/slog"
+)
+
+var (
+	// ErrReadOnlyStorage is returned by writes to the DataStorage during a render in strict mode.
+	ErrReadOnlyStorage = errors.New("storage is read-only during render")
+)
+
+// RenderContext is a read-only view of a TransitionContext for pure renderers.
+// It can read the chat's DataStorage with Lookup but has no way to write it,
+// so renders can be cached and retried safely. See BaseState.PureRenderer.
+type RenderContext interface {
+	context.Context
+	Bot() *telego.Bot
+	ChatKey() string
+	ChatID() telego.ChatID
+	Logger() *slog.Logger
+	Clock() Clock
+	Reader() DataReader
+}
+
+// DataReader is the read-only part of DataStorage.
+type DataReader interface {
+	GetData(ctx context.Context, chatKey string, dataKey string, pointer any) error
+}
+
+type renderContext struct {
+	TransitionContext
+}
+
+func (r renderContext) Logger() *slog.Logger {
+	return LoggerOf(r)
+}
+
+func (r renderContext) Clock() Clock {
+	return ClockOf(r)
+}
+
+func (r renderContext) Reader() DataReader {
+	return readOnlyStore{r.Store()}
+}
+
+// ReadOnly returns a RenderContext reading from the storage of ctx.
+func ReadOnly(ctx TransitionContext) RenderContext {
+	return renderContext{ctx}
+}
+
+// Lookup retrieves a value from the chat's DataStorage, like Get.
+// Returns ErrDataKeyNotFound if the key does not exist.
+func Lookup[T any](c RenderContext, key DataKey[T]) (T, error) {
+	var result T
+	err := c.Reader().GetData(c, c.ChatKey(), string(key), &result)
+	if err != nil {
+		if errors.Is(err, ErrDataKeyNotFound) {
+			return result, err
+		}
+		return result, fmt.Errorf("failed to get data: %w", err)
+	}
+	return result, nil
+}
+
+// WithStrictRender makes the DataStorage read-only while states render: writes fail with ErrReadOnlyStorage.
+// Use it to find renderers with side effects on storage, which make render caching and retries unsafe.
+func WithStrictRender() StateHandlerOption {
+	return func(s *StateHandler) {
+		s.strictRender = true
+	}
+}
+
+// strictContext is a TransitionContext whose storage is read-only.
+type strictContext struct {
+	TransitionContext
+}
+
+func (s strictContext) Store() DataStorage {
+	return readOnlyStore{s.TransitionContext.Store()}
+}
+
+type readOnlyStore struct {
+	store DataStorage
+}
+
+func (r readOnlyStore) GetData(ctx context.Context, chatKey string, dataKey string, pointer any) error {
+	return r.store.GetData(ctx, chatKey, dataKey, pointer)
+}
+
+func (r readOnlyStore) SetData(context.Context, string, string, any) error {
+	return ErrReadOnlyStorage
+}
+
+func (r readOnlyStore) RemoveData(context.Context, string, string) error {
+	return ErrReadOnlyStorage
+}
+
+func (r readOnlyStore) ClearData(context.Context, string) error {
+	return ErrReadOnlyStorage
+}
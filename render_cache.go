@@ -0,0 +1,134 @@
+package nabot
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mymmrac/telego"
+	"sync"
+)
+
+// CachedRenderer is a state renderer that caches the message it builds for each chat.
+// Inputs returns the values the message depends on, typically read from the chat's DataStorage.
+// When a chat transitions to the state again with unchanged inputs, the cached message is sent
+// without calling Build, avoiding expensive renders such as database queries or image generation.
+//
+// The cache is kept in memory, holding the messages of up to MaxEntries chats; the least recently rendered
+// are evicted first. Register it by pointer and use its Render method as the state's renderer.
+//
+// Example:
+//
+//	profile := &nabot.CachedRenderer{
+//	    Inputs: func(ctx nabot.TransitionContext) (any, error) {
+//	        return nabot.Get(ctx, userIDKey)
+//	    },
+//	    Build: func(ctx nabot.TransitionContext) (*telego.SendMessageParams, error) {
+//	        return buildProfileMessage(ctx) // slow
+//	    },
+//	}
+//	s.BaseState = nabot.BaseState{
+//	    ID:       "profile",
+//	    Renderer: profile.Render,
+//	}
+type CachedRenderer struct {
+	Inputs func(ctx TransitionContext) (any, error)
+	Build  func(ctx TransitionContext) (*telego.SendMessageParams, error)
+	// MaxEntries is the number of chats whose messages are cached. Default is 10000.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// recent orders the entries from the most to the least recently rendered.
+	recent *list.List
+}
+
+type cachedMessage struct {
+	chatKey string
+	hash    string
+	params  telego.SendMessageParams
+}
+
+const defaultRenderCacheEntries = 10000
+
+// Render sends the cached message if the inputs are unchanged, or builds, sends and caches a new one.
+func (c *CachedRenderer) Render(ctx TransitionContext) error {
+	inputs, err := c.Inputs(ctx)
+	if err != nil {
+		return err
+	}
+	hash, err := hashInputs(inputs)
+	if err != nil {
+		return err
+	}
+
+	entry, ok := c.get(ctx.ChatKey())
+	if !ok || entry.hash != hash {
+		params, err := c.Build(ctx)
+		if err != nil {
+			return err
+		}
+		entry = cachedMessage{chatKey: ctx.ChatKey(), hash: hash, params: *params}
+		c.put(entry)
+	}
+
+	params := entry.params
+	params.ChatID = ctx.ChatID()
+	_, err = ctx.Bot().SendMessage(ctx, &params)
+	return err
+}
+
+// Invalidate drops the cached message of the chat, so the next render calls Build.
+func (c *CachedRenderer) Invalidate(chatKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[chatKey]; ok {
+		c.recent.Remove(e)
+		delete(c.entries, chatKey)
+	}
+}
+
+func (c *CachedRenderer) get(chatKey string) (cachedMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[chatKey]
+	if !ok {
+		return cachedMessage{}, false
+	}
+	c.recent.MoveToFront(e)
+	return e.Value.(cachedMessage), true
+}
+
+func (c *CachedRenderer) put(entry cachedMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.recent = list.New()
+	}
+	if e, ok := c.entries[entry.chatKey]; ok {
+		e.Value = entry
+		c.recent.MoveToFront(e)
+		return
+	}
+	c.entries[entry.chatKey] = c.recent.PushFront(entry)
+	maxEntries := c.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultRenderCacheEntries
+	}
+	for c.recent.Len() > maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(cachedMessage).chatKey)
+	}
+}
+
+func hashInputs(inputs any) (string, error) {
+	b, err := json.Marshal(inputs)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash render inputs: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
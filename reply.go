@@ -0,0 +1,119 @@
+package nabot
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoApp is returned by helpers that need the App handling the update, when called with another context.
+	ErrNoApp = errors.New("context does not belong to an App")
+)
+
+// OnReplyTo registers a one-shot handler for the first message of the current chat replying to the message
+// with the given ID, for "reply to this message with your answer" flows in group chats where keyboards are not practical.
+// The handler runs before all other handlers. If it returns ErrPass, it stays registered and the update is
+// passed on. The registration is dropped after ttl, and is kept in memory, so it does not survive restarts.
+//
+// Example:
+//
+//	msg, err := ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "Reply to this message with the new title"))
+//	// ...
+//	err = nabot.OnReplyTo(ctx, msg.MessageID, handlers.Func(func(ctx nabot.Context) error {
+//	    return rename(ctx, ctx.Update().Message.Text)
+//	}), 10*time.Minute)
+func OnReplyTo(ctx TransitionContext, messageID int, handler Handler, ttl time.Duration) error {
+	values := getUpdateValues(ctx)
+	if values == nil {
+		return ErrNoApp
+	}
+	values.replies.add(replyKey{chatKey: ctx.ChatKey(), messageID: messageID}, handler, ClockOf(ctx).Now().Add(ttl))
+	return nil
+}
+
+type replyKey struct {
+	chatKey   string
+	messageID int
+}
+
+type pendingReply struct {
+	handler Handler
+	expires time.Time
+}
+
+// replyRegistry is a Handler running the handlers registered with OnReplyTo.
+type replyRegistry struct {
+	clock   Clock
+	mu      sync.Mutex
+	pending map[replyKey]pendingReply
+}
+
+func (r *replyRegistry) add(key replyKey, handler Handler, expires time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[replyKey]pendingReply)
+	}
+	now := r.clock.Now()
+	for k, p := range r.pending {
+		if now.After(p.expires) {
+			delete(r.pending, k)
+		}
+	}
+	r.pending[key] = pendingReply{handler: handler, expires: expires}
+}
+
+func (r *replyRegistry) Name() string {
+	return "reply_to"
+}
+
+func (r *replyRegistry) Handle(ctx Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.ReplyToMessage == nil {
+		return ErrPass
+	}
+	key := replyKey{chatKey: ctx.ChatKey(), messageID: msg.ReplyToMessage.MessageID}
+	r.mu.Lock()
+	p, ok := r.pending[key]
+	delete(r.pending, key)
+	r.mu.Unlock()
+	if !ok || ClockOf(ctx).Now().After(p.expires) {
+		return ErrPass
+	}
+
+	err := p.handler.Handle(ctx)
+	if errors.Is(err, ErrPass) {
+		r.mu.Lock()
+		if _, replaced := r.pending[key]; !replaced {
+			r.pending[key] = p
+		}
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// replyMirror handles the replies pending in a registry without consuming them, for the candidate handlers
+// of a Shadow, which handle updates before the live ones.
+type replyMirror struct {
+	registry *replyRegistry
+}
+
+func (r replyMirror) Name() string {
+	return r.registry.Name()
+}
+
+func (r replyMirror) Handle(ctx Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || msg.ReplyToMessage == nil {
+		return ErrPass
+	}
+	key := replyKey{chatKey: ctx.ChatKey(), messageID: msg.ReplyToMessage.MessageID}
+	r.registry.mu.Lock()
+	p, ok := r.registry.pending[key]
+	r.registry.mu.Unlock()
+	if !ok || ClockOf(ctx).Now().After(p.expires) {
+		return ErrPass
+	}
+	return p.handler.Handle(ctx)
+}
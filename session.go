@@ -0,0 +1,188 @@
+package nabot
+
+import (
+	"context"
+	"github.com/mymmrac/telego"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ActivityStorage records when each chat was last active.
+// An in-memory implementation is available via NewInMemoryActivityStore.
+type ActivityStorage interface {
+	// Touch records activity of the chat at the given time.
+	Touch(ctx context.Context, chatKey string, chatID telego.ChatID, at time.Time) error
+	// IdleSince returns chats whose last activity is before the given time.
+	IdleSince(ctx context.Context, before time.Time) ([]IdleChat, error)
+	// Forget removes the chat until it becomes active again.
+	Forget(ctx context.Context, chatKey string) error
+}
+
+// IdleChat is a chat returned by ActivityStorage.IdleSince.
+type IdleChat struct {
+	ChatKey    string
+	ChatID     telego.ChatID
+	LastActive time.Time
+}
+
+type memoryActivityStore struct {
+	mu    sync.Mutex
+	chats map[string]IdleChat
+}
+
+// NewInMemoryActivityStore creates an in-memory activity storage.
+func NewInMemoryActivityStore() ActivityStorage {
+	return &memoryActivityStore{
+		chats: make(map[string]IdleChat),
+	}
+}
+
+func (m *memoryActivityStore) Touch(_ context.Context, chatKey string, chatID telego.ChatID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chats[chatKey] = IdleChat{ChatKey: chatKey, ChatID: chatID, LastActive: at}
+	return nil
+}
+
+func (m *memoryActivityStore) IdleSince(_ context.Context, before time.Time) ([]IdleChat, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []IdleChat
+	for _, c := range m.chats {
+		if c.LastActive.Before(before) {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (m *memoryActivityStore) Forget(_ context.Context, chatKey string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.chats, chatKey)
+	return nil
+}
+
+// SessionExpiry ends the sessions of chats idle for longer than a threshold.
+// The state stack of expired chats is cleared and they receive a one-time message removing the reply keyboard,
+// so users returning later do not interact with stale keyboards. The states are popped as by a transition,
+// calling their OnExit hooks and removing their StateData. With a StateHandler, only chats that were in a state
+// have a session to end, so idle chats without a state are forgotten without a message.
+//
+// SessionExpiry is a Handler recording chat activity; register it before other handlers
+// and start the cleanup job with Run.
+//
+// Example:
+//
+//	expiry := nabot.NewSessionExpiry(app, stateHandler, 7*24*time.Hour)
+//	app.Handle(expiry)
+//	app.Handle(stateHandler)
+//	go expiry.Run(ctx)
+type SessionExpiry struct {
+	app          *App
+	stateHandler *StateHandler
+	idle         time.Duration
+	interval     time.Duration
+	message      string
+	store        ActivityStorage
+}
+
+// NewSessionExpiry creates a SessionExpiry ending sessions idle for longer than idle.
+func NewSessionExpiry(app *App, stateHandler *StateHandler, idle time.Duration, options ...SessionExpiryOption) *SessionExpiry {
+	se := &SessionExpiry{
+		app:          app,
+		stateHandler: stateHandler,
+		idle:         idle,
+		interval:     time.Minute,
+		message:      "Session ended.",
+		store:        NewInMemoryActivityStore(),
+	}
+	for _, option := range options {
+		option(se)
+	}
+	return se
+}
+
+func (s *SessionExpiry) Name() string {
+	return "session_expiry"
+}
+
+// Handle records the chat activity and passes the update to the next handler.
+func (s *SessionExpiry) Handle(ctx Context) error {
+	if err := s.store.Touch(ctx, ctx.ChatKey(), ctx.ChatID(), s.app.clock.Now()); err != nil {
+		ctx.Logger().Error("nabot: failed to record chat activity", "error", err)
+	}
+	return ErrPass
+}
+
+// Run checks for idle chats periodically and blocks until ctx is done.
+func (s *SessionExpiry) Run(ctx context.Context) {
+	for {
+		select {
+		case <-s.app.clock.After(s.interval):
+			s.expire(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *SessionExpiry) expire(ctx context.Context) {
+	chats, err := s.store.IdleSince(ctx, s.app.clock.Now().Add(-s.idle))
+	if err != nil {
+		s.app.logger.Error("nabot: failed to list idle chats", "error", err)
+		return
+	}
+	for _, c := range chats {
+		logger := s.app.logger.With(slog.String("chat", c.ChatID.String()))
+		expired := true
+		if s.stateHandler != nil {
+			expired, err = s.stateHandler.clear(s.app.chatContext(ctx, c.ChatKey, c.ChatID))
+			if err != nil {
+				logger.Error("nabot: failed to clear state of idle chat", "error", err)
+				continue
+			}
+		}
+		if expired && s.message != "" {
+			_, err = s.app.bot.SendMessage(ctx, &telego.SendMessageParams{
+				ChatID:      c.ChatID,
+				Text:        s.message,
+				ReplyMarkup: &telego.ReplyKeyboardRemove{RemoveKeyboard: true},
+			})
+			if err != nil {
+				logger.Warn("nabot: failed to send session expiry message", "error", err)
+			}
+		}
+		if err = s.store.Forget(ctx, c.ChatKey); err != nil {
+			logger.Error("nabot: failed to forget idle chat", "error", err)
+		}
+	}
+}
+
+// SessionExpiryOption configures a SessionExpiry.
+type SessionExpiryOption func(*SessionExpiry)
+
+// WithExpiryMessage sets the message sent to expired chats. An empty text sends no message.
+// Default is "Session ended.".
+func WithExpiryMessage(text string) SessionExpiryOption {
+	return func(s *SessionExpiry) {
+		s.message = text
+	}
+}
+
+// WithExpiryCheckInterval sets how often idle chats are checked.
+// Default is one minute.
+func WithExpiryCheckInterval(interval time.Duration) SessionExpiryOption {
+	return func(s *SessionExpiry) {
+		s.interval = interval
+	}
+}
+
+// WithActivityStore sets a custom activity storage implementation.
+// Default is NewInMemoryActivityStore().
+func WithActivityStore(store ActivityStorage) SessionExpiryOption {
+	return func(s *SessionExpiry) {
+		s.store = store
+	}
+}
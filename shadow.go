@@ -0,0 +1,519 @@
+package nabot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mymmrac/telego"
+	"github.com/mymmrac/telego/telegoapi"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Shadow mirrors updates to a candidate set of handlers in dry-run, to validate a routing refactor
+// on production traffic before switching to it.
+// Each mirrored update is handled by the candidate handlers before the live ones, wrapped in the middlewares
+// of the App and followed by its fallback handler, and pending OnReplyTo replies are routed to the candidate
+// too without being consumed. The outgoing API calls
+// of the candidate are captured instead of sent, except read-only "get" methods, which are made for real
+// but still recorded on both sides. Its DataStorage and StateHandler stack writes are kept in a per-update
+// overlay that is discarded, and so are the replies it registers with OnReplyTo. The calls of both are then
+// compared, and the results are collected in a ShadowReport.
+//
+// Shadow wraps the telegoapi.Caller of the bot to capture the calls of the live handlers,
+// so it must be installed with telego.WithAPICaller as well as WithShadow.
+// It also implements http.Handler to be mounted on an admin server: GET returns the ShadowReport as JSON.
+//
+// Since the candidate runs first, mirroring adds its handling time to the latency of the live handlers;
+// see WithShadowSampleRate to mirror a fraction of the updates.
+//
+// Example:
+//
+//	shadow := nabot.NewShadow(telegoapi.DefaultFastHTTPCaller, nabot.WithShadowSampleRate(0.1))
+//	shadow.Handle(newMenuRouter)
+//	bot, err := telego.NewBot(token, telego.WithAPICaller(shadow))
+//	// ...
+//	app := nabot.NewApp(bot, updates, nabot.WithShadow(shadow))
+//	app.Handle(menuRouter)
+//	adminMux.Handle("/shadow", shadow)
+type Shadow struct {
+	caller     telegoapi.Caller
+	handlers   []Handler
+	routes     map[string][]Handler
+	fallback   Handler
+	bot        *telego.Bot
+	sampleRate float64
+	maxRecent  int
+	onMismatch func(ShadowResult)
+
+	mu     sync.Mutex
+	report ShadowReport
+}
+
+// ShadowCall is an outgoing API call.
+type ShadowCall struct {
+	Method string `json:"method"`
+	// Params are the parameters of the call as a JSON object. Files are replaced by their names.
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// ShadowOutcome is how the live or candidate handlers handled an update.
+type ShadowOutcome struct {
+	// Handler is the name of the handler that handled the update, or empty if all passed.
+	Handler string       `json:"handler,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Calls   []ShadowCall `json:"calls"`
+}
+
+// ShadowResult is the comparison of the live and candidate handling of an update.
+type ShadowResult struct {
+	UpdateID   int           `json:"update_id"`
+	UpdateType string        `json:"update_type"`
+	ChatKey    string        `json:"chat_key"`
+	Live       ShadowOutcome `json:"live"`
+	Candidate  ShadowOutcome `json:"candidate"`
+	Match      bool          `json:"match"`
+	// Diff describes the first difference found, if any.
+	Diff string `json:"diff,omitempty"`
+}
+
+// ShadowReport summarizes the mirrored updates.
+type ShadowReport struct {
+	Updates    int `json:"updates"`
+	Matched    int `json:"matched"`
+	Mismatched int `json:"mismatched"`
+	// Mismatches are the most recent mismatches, oldest first.
+	Mismatches []ShadowResult `json:"mismatches"`
+}
+
+// NewShadow creates a Shadow making the calls of the live handlers with caller.
+func NewShadow(caller telegoapi.Caller, options ...ShadowOption) *Shadow {
+	s := &Shadow{
+		caller:     caller,
+		sampleRate: 1,
+		maxRecent:  100,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// Handle adds a handler to the candidate handlers. Handlers are routed as in App.Handle.
+// Handle panics if the App using the Shadow is frozen.
+func (s *Shadow) Handle(handler Handler) {
+	if s.routes != nil {
+		panic("nabot: cannot register shadow handler after the app is frozen")
+	}
+	s.handlers = append(s.handlers, handler)
+}
+
+// Report returns the results of the mirrored updates so far.
+func (s *Shadow) Report() ShadowReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := s.report
+	report.Mismatches = append([]ShadowResult(nil), s.report.Mismatches...)
+	return report
+}
+
+// Reset clears the report, such as after fixing the mismatches found.
+func (s *Shadow) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report = ShadowReport{}
+}
+
+func (s *Shadow) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Report())
+}
+
+// Call makes a call of the live bot, recording it if it is made while handling a mirrored update.
+func (s *Shadow) Call(ctx context.Context, url string, data *telegoapi.RequestData) (*telegoapi.Response, error) {
+	if v := getUpdateValues(ctx); v != nil && v.shadow != nil {
+		v.shadow.record(url, data)
+	}
+	return s.caller.Call(ctx, url, data)
+}
+
+// attach creates the bot of the candidate handlers, sharing the token of the live bot.
+func (s *Shadow) attach(a *App) {
+	if a.bot == nil {
+		return
+	}
+	bot, err := telego.NewBot(a.bot.Token(), telego.WithAPICaller(candidateCaller{s}), telego.WithDiscardLogger())
+	if err != nil {
+		a.logger.Error("nabot: failed to create shadow bot; mirroring is disabled", "error", err)
+		return
+	}
+	s.bot = bot
+}
+
+// freeze compiles the routes of the candidate handlers like those of the live ones, with the middlewares,
+// replies and fallback handler of a, so only the differences of the handlers show. Called by App.Freeze.
+// Handlers are not instrumented, so the metrics and traces of the App are those of the live handlers.
+func (s *Shadow) freeze(a *App, fallback Handler) {
+	routes := map[string][]Handler{
+		UpdateTypeMessage: {a.wrapMiddleware(a.replies, replyMirror{a.replies})},
+	}
+	for _, handler := range s.handlers {
+		types := updateTypes
+		if th, ok := handler.(TypedHandler); ok {
+			types = th.UpdateTypes()
+		}
+		wrapped := a.wrapMiddleware(handler, handler)
+		for _, t := range types {
+			routes[t] = append(routes[t], wrapped)
+		}
+	}
+	s.routes = routes
+	if fallback != nil {
+		s.fallback = a.wrapMiddleware(fallback, fallback)
+	}
+}
+
+// mirror handles the update of ctx with the candidate handlers and returns their outcome,
+// or nil if the update is not sampled.
+func (s *Shadow) mirror(a *App, ctx *nativeContext) *ShadowOutcome {
+	if s.bot == nil || (s.sampleRate < 1 && rand.Float64() >= s.sampleRate) {
+		return nil
+	}
+	calls := &callRecording{}
+	candidate := &nativeContext{
+		Context:   ctx.Context,
+		bot:       s.bot,
+		update:    ctx.update,
+		dataStore: &overlayStore{live: ctx.dataStore, writes: NewInMemoryDataStore()},
+		chatKey:   ctx.chatKey,
+		chatID:    ctx.chatID,
+		logger:    a.logger.With("shadow", "candidate"),
+		clock:     ctx.clock,
+		values: updateValues{
+			shadow:       calls,
+			stacks:       &stateOverlay{},
+			replies:      &replyRegistry{clock: ctx.clock},
+			dependencies: ctx.values.dependencies,
+		},
+	}
+	outcome := &ShadowOutcome{}
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				outcome.Error = fmt.Sprintf("panic: %v", r)
+			}
+		}()
+		handler, err := runChain(candidate, s.routes[GetTypeOfUpdate(ctx.update)], func(ctx Context, h Handler) Context {
+			return &labeledContext{Context: ctx, key: "handler", name: h.Name()}
+		})
+		if errors.Is(err, ErrPass) && a.handlesFallback(ctx.update) {
+			handler = s.fallback
+			err = handler.Handle(&labeledContext{Context: candidate, key: "handler", name: handler.Name()})
+		}
+		outcome.Handler, outcome.Error = outcomeOf(handler, err)
+	}()
+	outcome.Calls = calls.calls
+	return outcome
+}
+
+// compare records the comparison of the live and candidate handling of the update of ctx.
+func (s *Shadow) compare(ctx *nativeContext, live, candidate ShadowOutcome) {
+	result := ShadowResult{
+		UpdateID:   ctx.update.UpdateID,
+		UpdateType: GetTypeOfUpdate(ctx.update),
+		ChatKey:    ctx.chatKey,
+		Live:       live,
+		Candidate:  candidate,
+		Diff:       diffOutcomes(live, candidate),
+	}
+	result.Match = result.Diff == ""
+
+	s.mu.Lock()
+	s.report.Updates++
+	if result.Match {
+		s.report.Matched++
+	} else {
+		s.report.Mismatched++
+		s.report.Mismatches = append(s.report.Mismatches, result)
+		if len(s.report.Mismatches) > s.maxRecent {
+			s.report.Mismatches = s.report.Mismatches[1:]
+		}
+	}
+	s.mu.Unlock()
+
+	if !result.Match {
+		ctx.Logger().Warn("nabot: shadow handlers diverged", "diff", result.Diff)
+		if s.onMismatch != nil {
+			s.onMismatch(result)
+		}
+	}
+}
+
+func outcomeOf(handler Handler, err error) (string, string) {
+	if errors.Is(err, ErrPass) {
+		return "", ""
+	}
+	name := ""
+	if handler != nil {
+		name = handler.Name()
+	}
+	if err != nil {
+		return name, err.Error()
+	}
+	return name, ""
+}
+
+// diffOutcomes describes the first difference between the live and candidate outcomes,
+// or returns an empty string if they match.
+func diffOutcomes(live, candidate ShadowOutcome) string {
+	if live.Handler != candidate.Handler {
+		return fmt.Sprintf("handled by %q, candidate %q", live.Handler, candidate.Handler)
+	}
+	if (live.Error == "") != (candidate.Error == "") {
+		return fmt.Sprintf("error %q, candidate %q", live.Error, candidate.Error)
+	}
+	for i := range max(len(live.Calls), len(candidate.Calls)) {
+		switch {
+		case i >= len(live.Calls):
+			return fmt.Sprintf("call %d: candidate made extra call %s", i+1, candidate.Calls[i].Method)
+		case i >= len(candidate.Calls):
+			return fmt.Sprintf("call %d: candidate did not call %s", i+1, live.Calls[i].Method)
+		case live.Calls[i].Method != candidate.Calls[i].Method:
+			return fmt.Sprintf("call %d: %s, candidate %s", i+1, live.Calls[i].Method, candidate.Calls[i].Method)
+		case !bytes.Equal(live.Calls[i].Params, candidate.Calls[i].Params):
+			return fmt.Sprintf("call %d: %s parameters differ", i+1, live.Calls[i].Method)
+		}
+	}
+	return ""
+}
+
+// callRecording collects the API calls made while handling an update.
+type callRecording struct {
+	mu    sync.Mutex
+	calls []ShadowCall
+}
+
+func (c *callRecording) record(url string, data *telegoapi.RequestData) {
+	call := ShadowCall{Method: path.Base(url), Params: requestParams(data)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+}
+
+// requestParams returns the parameters of a JSON or multipart request as a JSON object,
+// with files replaced by their names, so the requests of the live and candidate bots can be compared.
+func requestParams(data *telegoapi.RequestData) json.RawMessage {
+	if data == nil || data.Buffer == nil {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(data.ContentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return json.RawMessage(bytes.Clone(data.Buffer.Bytes()))
+	}
+	fields := make(map[string]string)
+	reader := multipart.NewReader(bytes.NewReader(data.Buffer.Bytes()), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		if part.FileName() != "" {
+			fields[part.FormName()] = part.FileName()
+			continue
+		}
+		b, _ := io.ReadAll(part)
+		fields[part.FormName()] = string(b)
+	}
+	b, _ := json.Marshal(fields)
+	return b
+}
+
+// candidateCaller records the calls of the candidate bot and answers them with fake results,
+// except for "get" methods, which are read-only and made with the live caller after being recorded,
+// as Shadow.Call records them for the live bot.
+type candidateCaller struct {
+	shadow *Shadow
+}
+
+func (c candidateCaller) Call(ctx context.Context, url string, data *telegoapi.RequestData) (*telegoapi.Response, error) {
+	if v := getUpdateValues(ctx); v != nil && v.shadow != nil {
+		v.shadow.record(url, data)
+	}
+	method := path.Base(url)
+	if strings.HasPrefix(method, "get") {
+		return c.shadow.caller.Call(ctx, url, data)
+	}
+	return &telegoapi.Response{Ok: true, Result: fakeResult(ctx, method)}, nil
+}
+
+// fakeResult returns a result the telego bot can decode for method.
+func fakeResult(ctx context.Context, method string) json.RawMessage {
+	switch method {
+	case "sendMediaGroup", "copyMessages", "forwardMessages":
+		return json.RawMessage("[]")
+	case "copyMessage":
+		return json.RawMessage(`{"message_id":0}`)
+	}
+	for _, prefix := range []string{"send", "forward", "edit", "stopMessageLiveLocation"} {
+		if strings.HasPrefix(method, prefix) {
+			var chatID int64
+			if sc, ok := ctx.(interface{ ChatID() telego.ChatID }); ok {
+				chatID = sc.ChatID().ID
+			}
+			return json.RawMessage(`{"message_id":0,"date":0,"chat":{"id":` + strconv.FormatInt(chatID, 10) + `,"type":"private"}}`)
+		}
+	}
+	return json.RawMessage("true")
+}
+
+// overlayStore reads through to the live storage and keeps writes to itself,
+// so the candidate handlers see the data of the chat without changing it.
+type overlayStore struct {
+	live    DataStorage
+	writes  DataStorage
+	mu      sync.Mutex
+	written map[string]bool
+	removed map[string]bool
+	cleared map[string]bool
+}
+
+func overlayKey(chatKey, dataKey string) string {
+	return chatKey + "\x00" + dataKey
+}
+
+func (o *overlayStore) SetData(ctx context.Context, chatKey string, dataKey string, value any) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.written == nil {
+		o.written = make(map[string]bool)
+	}
+	o.written[overlayKey(chatKey, dataKey)] = true
+	return o.writes.SetData(ctx, chatKey, dataKey, value)
+}
+
+func (o *overlayStore) GetData(ctx context.Context, chatKey string, dataKey string, pointer any) error {
+	o.mu.Lock()
+	key := overlayKey(chatKey, dataKey)
+	written, removed := o.written[key], o.removed[key] || o.cleared[chatKey]
+	o.mu.Unlock()
+	if written {
+		return o.writes.GetData(ctx, chatKey, dataKey, pointer)
+	}
+	if removed {
+		return ErrDataKeyNotFound
+	}
+	return o.live.GetData(ctx, chatKey, dataKey, pointer)
+}
+
+func (o *overlayStore) RemoveData(ctx context.Context, chatKey string, dataKey string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.removed == nil {
+		o.removed = make(map[string]bool)
+	}
+	key := overlayKey(chatKey, dataKey)
+	delete(o.written, key)
+	o.removed[key] = true
+	return o.writes.RemoveData(ctx, chatKey, dataKey)
+}
+
+func (o *overlayStore) ClearData(ctx context.Context, chatKey string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.cleared == nil {
+		o.cleared = make(map[string]bool)
+	}
+	for key := range o.written {
+		if strings.HasPrefix(key, chatKey+"\x00") {
+			delete(o.written, key)
+		}
+	}
+	o.cleared[chatKey] = true
+	return o.writes.ClearData(ctx, chatKey)
+}
+
+// stateOverlay keeps the stacks written by the StateHandlers of the candidate handlers,
+// so they read the live stacks without changing them.
+type stateOverlay struct {
+	mu     sync.Mutex
+	stacks map[stateOverlayKey][]byte
+}
+
+type stateOverlayKey struct {
+	handler *StateHandler
+	chatKey string
+}
+
+// storage returns the StateStorage of s seen by the candidate handlers.
+func (o *stateOverlay) storage(s *StateHandler) StateStorage {
+	return overlayStateStore{overlay: o, handler: s}
+}
+
+type overlayStateStore struct {
+	overlay *stateOverlay
+	handler *StateHandler
+}
+
+func (o overlayStateStore) GetStack(ctx context.Context, chatKey string) ([]byte, error) {
+	o.overlay.mu.Lock()
+	stack, ok := o.overlay.stacks[stateOverlayKey{handler: o.handler, chatKey: chatKey}]
+	o.overlay.mu.Unlock()
+	if ok {
+		return stack, nil
+	}
+	return o.handler.storage.GetStack(ctx, chatKey)
+}
+
+func (o overlayStateStore) SetStack(_ context.Context, chatKey string, stack []byte) error {
+	o.overlay.mu.Lock()
+	defer o.overlay.mu.Unlock()
+	if o.overlay.stacks == nil {
+		o.overlay.stacks = make(map[stateOverlayKey][]byte)
+	}
+	o.overlay.stacks[stateOverlayKey{handler: o.handler, chatKey: chatKey}] = stack
+	return nil
+}
+
+// WithShadow mirrors updates to the candidate handlers of shadow. See Shadow.
+func WithShadow(shadow *Shadow) AppOption {
+	return func(a *App) {
+		a.shadow = shadow
+	}
+}
+
+// ShadowOption configures a Shadow.
+type ShadowOption func(*Shadow)
+
+// WithShadowSampleRate sets the fraction of updates mirrored, between 0 and 1. Default is 1.
+func WithShadowSampleRate(rate float64) ShadowOption {
+	return func(s *Shadow) {
+		s.sampleRate = rate
+	}
+}
+
+// WithShadowMaxMismatches sets the number of recent mismatches kept in the report. Default is 100.
+func WithShadowMaxMismatches(n int) ShadowOption {
+	return func(s *Shadow) {
+		s.maxRecent = max(n, 0)
+	}
+}
+
+// WithOnShadowMismatch sets a function called with every mismatch, such as to log it or alert on it.
+func WithOnShadowMismatch(f func(ShadowResult)) ShadowOption {
+	return func(s *Shadow) {
+		s.onMismatch = f
+	}
+}
@@ -0,0 +1,49 @@
+package nabot
+
+import (
+	"context"
+	"github.com/mymmrac/telego"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// RunUntilSignal runs the App until one of signals is received, by default os.Interrupt and SIGTERM,
+// then shuts it down: it stops receiving updates, waits for the handlers to finish and closes the data storage
+// if it implements io.Closer. It returns the error of closing the storage.
+//
+// If the App was created with a nil update channel, RunUntilSignal receives updates by long polling,
+// requesting the types returned by AllowedUpdates, and stops polling on the signal.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, nil)
+//	app.Handle(myHandler)
+//	if err := app.RunUntilSignal(); err != nil {
+//	    log.Fatal(err)
+//	}
+func (a *App) RunUntilSignal(signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), signals...)
+	defer stop()
+
+	if a.updatesChan == nil {
+		a.Freeze()
+		err := a.RunSource(ctx, LongPollingSource(a.bot, &telego.GetUpdatesParams{
+			Timeout:        60,
+			AllowedUpdates: a.AllowedUpdates(),
+		}))
+		if err != nil {
+			return err
+		}
+	} else {
+		a.RunContext(ctx)
+	}
+	if closer, ok := a.dataStore.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package nabot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/mymmrac/telego"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// UpdateSource provides the updates of an App, as an alternative to the update channel given to NewApp.
+// Use LongPollingSource, WebhookSource or ChannelSource to receive updates from the Bale server, or QueueSource
+// to consume them from a message broker, so several workers share the updates of a bot.
+type UpdateSource interface {
+	// Updates starts receiving updates. The returned channel must be closed once ctx is done.
+	Updates(ctx context.Context) (<-chan telego.Update, error)
+}
+
+// UpdateSourceFunc is an UpdateSource calling itself.
+type UpdateSourceFunc func(ctx context.Context) (<-chan telego.Update, error)
+
+func (f UpdateSourceFunc) Updates(ctx context.Context) (<-chan telego.Update, error) {
+	return f(ctx)
+}
+
+// RunSource runs the App with the updates of source, like RunContext, until ctx is done or the updates channel
+// is closed. It then waits for the handlers to finish, like Stop.
+//
+// Example:
+//
+//	err := app.RunSource(ctx, nabot.LongPollingSource(bot, nil))
+func (a *App) RunSource(ctx context.Context, source UpdateSource) error {
+	// sources read the Clock of the App with ClockOf, such as to wait before retrying
+	updates, err := source.Updates(context.WithValue(ctx, clockKey{}, a.clock))
+	if err != nil {
+		return err
+	}
+	a.updatesChan = updates
+	a.RunContext(ctx)
+	return nil
+}
+
+// ChannelSource returns an UpdateSource forwarding the updates of a channel, which the owner closes.
+func ChannelSource(updates <-chan telego.Update) UpdateSource {
+	return UpdateSourceFunc(func(context.Context) (<-chan telego.Update, error) {
+		return updates, nil
+	})
+}
+
+// LongPollingSource returns an UpdateSource receiving updates with bot.UpdatesViaLongPolling.
+func LongPollingSource(bot *telego.Bot, params *telego.GetUpdatesParams, options ...telego.LongPollingOption) UpdateSource {
+	return UpdateSourceFunc(func(ctx context.Context) (<-chan telego.Update, error) {
+		return bot.UpdatesViaLongPolling(ctx, params, options...)
+	})
+}
+
+// WebhookSource returns an UpdateSource receiving updates through a webhook, like App.RunWebhook:
+// it sets the webhook with params and serves it with config. Server errors are logged and close the channel.
+func WebhookSource(bot *telego.Bot, params *telego.SetWebhookParams, config WebhookConfig) UpdateSource {
+	return UpdateSourceFunc(func(ctx context.Context) (<-chan telego.Update, error) {
+		if config.Path == "" {
+			config.Path = "/"
+		}
+		if config.Buffer <= 0 {
+			config.Buffer = 100
+		}
+		if config.ShutdownTimeout <= 0 {
+			config.ShutdownTimeout = 10 * time.Second
+		}
+		if err := bot.SetWebhook(ctx, params); err != nil {
+			return nil, err
+		}
+		updates := make(chan telego.Update, config.Buffer)
+		handler := &webhookHandler{
+			ctx:     context.WithoutCancel(ctx),
+			secret:  params.SecretToken,
+			updates: updates,
+			logger:  slog.Default(),
+		}
+		mux := http.NewServeMux()
+		mux.Handle(config.Path, handler)
+		server := &http.Server{Addr: config.Addr, Handler: mux}
+		go func() {
+			stop := context.AfterFunc(ctx, func() {
+				shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.ShutdownTimeout)
+				defer cancel()
+				_ = server.Shutdown(shutdownCtx)
+			})
+			defer stop()
+			var err error
+			if config.CertFile != "" {
+				err = server.ListenAndServeTLS(config.CertFile, config.KeyFile)
+			} else {
+				err = server.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				slog.Default().Error("nabot: webhook server failed", "error", err)
+			}
+			handler.inflight.Wait()
+			close(updates)
+		}()
+		return updates, nil
+	})
+}
+
+// QueueReceiver receives messages from a message broker. The queues directory has adapters for
+// NATS JetStream (natsqueue), Kafka (kafkaqueue) and Redis Streams (redisqueue), each in its own module;
+// adapt other brokers by implementing it.
+type QueueReceiver interface {
+	// Receive blocks until a message is available or ctx is done. It returns the message and a function
+	// acknowledging it, called once the update is handled; unacknowledged messages are redelivered by the broker.
+	Receive(ctx context.Context) (data []byte, ack func() error, err error)
+}
+
+// QueueSource returns an UpdateSource consuming updates, encoded as JSON by PublishUpdates, from receiver.
+// Each message is acknowledged after its update is handled, or dropped because it is invalid or not allowed.
+// Updates still being handled when the App stops are not acknowledged, so the broker redelivers them.
+// Receive errors other than the end of ctx are logged and retried after a second.
+//
+// Example with Redis Streams:
+//
+//	receiver := redisqueue.NewReceiver(rdb, "bot:updates", "workers", hostname)
+//	err := app.RunSource(ctx, nabot.QueueSource(receiver))
+func QueueSource(receiver QueueReceiver) UpdateSource {
+	return UpdateSourceFunc(func(ctx context.Context) (<-chan telego.Update, error) {
+		updates := make(chan telego.Update)
+		go func() {
+			defer close(updates)
+			for {
+				data, ack, err := receiver.Receive(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					slog.Default().Error("nabot: failed to receive update from queue", "error", err)
+					select {
+					case <-ClockOf(ctx).After(time.Second):
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+				var update telego.Update
+				if err = json.Unmarshal(data, &update); err != nil {
+					slog.Default().Warn("nabot: invalid update in queue; dropping it", "error", err)
+					acknowledge(ack)
+					continue
+				}
+				// handlers are canceled by the App, such as with RunContext, not when the source stops
+				updateCtx := context.WithValue(context.WithoutCancel(ctx), ackKey{}, ack)
+				select {
+				case updates <- update.WithContext(updateCtx):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return updates, nil
+	})
+}
+
+// PublishUpdates publishes the updates of source, encoded as JSON, until ctx is done and the updates channel
+// is closed. Run a single publisher receiving updates from the Bale server, and workers consuming them with
+// QueueSource. It returns the first error of publish, as the update cannot be received again.
+//
+// Example with NATS JetStream:
+//
+//	err := nabot.PublishUpdates(ctx, nabot.LongPollingSource(bot, nil), natsqueue.Publisher(js, "bot.updates"))
+func PublishUpdates(ctx context.Context, source UpdateSource, publish func(ctx context.Context, data []byte) error) error {
+	updates, err := source.Updates(ctx)
+	if err != nil {
+		return err
+	}
+	for update := range updates {
+		data, err := json.Marshal(update)
+		if err != nil {
+			return err
+		}
+		if err = publish(ctx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ackKey is the context key of the function acknowledging an update received from a queue.
+type ackKey struct{}
+
+// ackUpdate acknowledges update if it was received from a queue.
+func ackUpdate(update telego.Update) {
+	if ack, ok := update.Context().Value(ackKey{}).(func() error); ok {
+		acknowledge(ack)
+	}
+}
+
+func acknowledge(ack func() error) {
+	if ack == nil {
+		return
+	}
+	if err := ack(); err != nil {
+		slog.Default().Error("nabot: failed to acknowledge update", "error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package nabot
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// StackEntry is a state on the state stack of a chat.
+type StackEntry struct {
+	// Name is the name of the state.
+	Name string `json:"name"`
+	// EnteredAt is when the state was pushed on the stack. Zero for entries stored before it was recorded.
+	EnteredAt time.Time `json:"entered_at,omitzero"`
+	// Params are the parameters the state was entered with; see WithStateParams.
+	Params map[string]string `json:"params,omitempty"`
+	// Version is the version of the state when it was entered; see VersionedState.
+	Version int `json:"version,omitempty"`
+}
+
+// VersionedState is a State that records its version in the stack entries of chats entering it,
+// so a changed state can recognize chats that entered an older version.
+type VersionedState interface {
+	State
+	StateVersion() int
+}
+
+func stateVersion(state State) int {
+	if v, ok := state.(VersionedState); ok {
+		return v.StateVersion()
+	}
+	return 0
+}
+
+// StackCodec encodes and decodes state stacks stored in a StateStorage.
+type StackCodec interface {
+	EncodeStack(entries []StackEntry) ([]byte, error)
+	DecodeStack(data []byte) ([]StackEntry, error)
+}
+
+// JSONStackCodec encodes state stacks as JSON arrays of entries.
+// It also decodes the earlier format of stacks, a JSON array of state names.
+type JSONStackCodec struct{}
+
+func (JSONStackCodec) EncodeStack(entries []StackEntry) ([]byte, error) {
+	return json.Marshal(entries)
+}
+
+func (JSONStackCodec) DecodeStack(data []byte) ([]StackEntry, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte(`["`)) {
+		var names []string
+		if err := json.Unmarshal(data, &names); err != nil {
+			return nil, err
+		}
+		entries := make([]StackEntry, len(names))
+		for i, name := range names {
+			entries[i] = StackEntry{Name: name}
+		}
+		return entries, nil
+	}
+	var entries []StackEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -2,13 +2,13 @@ package nabot
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/mymmrac/telego"
 	"log/slog"
 	"slices"
 	"sync"
+	"time"
 )
 
 var (
@@ -55,17 +55,30 @@ func (m *memoryStateStore) SetStack(_ context.Context, chatKey string, stack []b
 //	toMainState := stateHandler.RegisterState(myMainState)
 //	app.Handle(stateHandler)
 type StateHandler struct {
-	app     *App
-	states  map[string]State
-	storage StateStorage
+	app          *App
+	states       map[string]State
+	storage      StateStorage
+	codec        StackCodec
+	observers    []TransitionObserver
+	strictRender bool
+
+	timeouts        map[string]StateTimeout
+	activity        ActivityStorage
+	timeoutInterval time.Duration
+	// timingOut holds the chats whose timeout is queued, and whether they were active since it was queued.
+	timingOut   map[string]bool
+	timingOutMu sync.Mutex
 }
 
 // NewStateHandler creates a new state handler.
 func NewStateHandler(app *App, options ...StateHandlerOption) *StateHandler {
 	sh := &StateHandler{
-		app:     app,
-		states:  make(map[string]State),
-		storage: NewInMemoryStateStore(),
+		app:             app,
+		states:          make(map[string]State),
+		storage:         NewInMemoryStateStore(),
+		codec:           JSONStackCodec{},
+		activity:        NewInMemoryActivityStore(),
+		timeoutInterval: time.Minute,
 	}
 	for _, option := range options {
 		option(sh)
@@ -85,9 +98,9 @@ func (s *StateHandler) Handle(ctx Context) error {
 	if stack == nil {
 		return ErrPass
 	}
-	top := stack[len(stack)-1]
-	ctx = ContextWithLogger(ctx, ctx.Logger().With(slog.String("state", top.Name())))
-	return top.Handle(ctx)
+	s.touch(ctx)
+	top := stack[len(stack)-1].state
+	return top.Handle(&labeledContext{Context: ctx, key: "state", name: top.Name()})
 }
 
 // RegisterState registers a state and returns a Transition to it.
@@ -136,24 +149,44 @@ func (s *StateHandler) RegisterAndChainStates(states ...ChainableState) Transiti
 	return t
 }
 
-func (s *StateHandler) getStack(ctx context.Context, key string) ([]State, error) {
-	st, err := s.storage.GetStack(ctx, key)
+// Stack returns the state stack of the current chat, from the bottom to the top state.
+// Entries of states that are no longer registered are omitted.
+func (s *StateHandler) Stack(ctx StorageContext) ([]StackEntry, error) {
+	stack, err := s.getStack(ctx, ctx.ChatKey())
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]StackEntry, len(stack))
+	for i, f := range stack {
+		entries[i] = f.entry
+	}
+	return entries, nil
+}
+
+// frame is a registered state on the stack with its entry.
+type frame struct {
+	state State
+	entry StackEntry
+}
+
+func (s *StateHandler) getStack(ctx context.Context, key string) ([]frame, error) {
+	st, err := s.stateStorage(ctx).GetStack(ctx, key)
 	if errors.Is(err, ErrStateNotFound) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get stack: %w", err)
 	}
-	var states []string
-	if err = json.Unmarshal(st, &states); err != nil {
+	entries, err := s.codec.DecodeStack(st)
+	if err != nil {
 		s.app.logger.Error("failed to unmarshal stored stack. skipping state handler", "error", err)
 		return nil, nil
 	}
 
-	result := make([]State, 0, len(states))
-	for _, name := range states {
-		if state, ok := s.states[name]; ok {
-			result = append(result, state)
+	result := make([]frame, 0, len(entries))
+	for _, entry := range entries {
+		if state, ok := s.states[entry.Name]; ok {
+			result = append(result, frame{state: state, entry: entry})
 		}
 	}
 	if len(result) == 0 {
@@ -162,23 +195,139 @@ func (s *StateHandler) getStack(ctx context.Context, key string) ([]State, error
 	return result, nil
 }
 
-func (s *StateHandler) setStack(ctx context.Context, key string, stack []State) error {
-	var states []string
-	for _, st := range stack {
-		if _, ok := s.states[st.Name()]; ok {
-			states = append(states, st.Name())
+func (s *StateHandler) setStack(ctx context.Context, key string, stack []frame) error {
+	st, err := s.marshalStack(stack)
+	if err != nil {
+		return err
+	}
+	if err := s.stateStorage(ctx).SetStack(ctx, key, st); err != nil {
+		return fmt.Errorf("failed to set stack: %w", err)
+	}
+	return nil
+}
+
+// stateStorage returns the storage of the stacks, or an overlay of it when handling an update
+// mirrored to the candidate handlers of a Shadow.
+func (s *StateHandler) stateStorage(ctx context.Context) StateStorage {
+	if v := getUpdateValues(ctx); v != nil && v.stacks != nil {
+		return v.stacks.storage(s)
+	}
+	return s.storage
+}
+
+func (s *StateHandler) marshalStack(stack []frame) ([]byte, error) {
+	entries := make([]StackEntry, 0, len(stack))
+	for _, f := range stack {
+		if _, ok := s.states[f.state.Name()]; ok {
+			entries = append(entries, f.entry)
+		}
+	}
+	st, err := s.codec.EncodeStack(entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal stack: %w", err)
+	}
+	return st, nil
+}
+
+// transition replaces the stack of the chat and renders the new top state, if any.
+// The OnExit and OnEnter hooks run once the stack is stored, before the render.
+// With an OutboxStateStorage, the hooks and the render run first with the outbox context,
+// and the messages they queue are committed with the stack.
+func (s *StateHandler) transition(ctx TransitionContext, from, to []frame) (err error) {
+	var top State
+	if len(to) > 0 {
+		top = to[len(to)-1].state
+	}
+	spanCtx, span := s.app.startSpan(ctx, "state transition",
+		slog.String("nabot.state_from", topName(from)),
+		slog.String("nabot.state_to", topName(to)),
+	)
+	if span != nil {
+		ctx = derivedTransitionContext{TransitionContext: ctx, ctx: spanCtx}
+		defer func() {
+			endSpan(span, err)
+		}()
+	}
+	s.touch(ctx)
+	renderCtx := ctx
+	if s.strictRender {
+		renderCtx = strictContext{ctx}
+	}
+
+	outbox, ok := s.stateStorage(ctx).(OutboxStateStorage)
+	if !ok {
+		if err := s.setStack(ctx, ctx.ChatKey(), to); err != nil {
+			return err
+		}
+		if err := s.enterAndExit(ctx, from, to); err != nil {
+			return err
+		}
+		if err := clearPoppedStateData(ctx, from, to); err != nil {
+			return err
+		}
+		s.notify(ctx, from, to)
+		if top == nil {
+			return nil
+		}
+		return top.Render(renderCtx)
+	}
+
+	buffer := &outboxBuffer{}
+	if err := s.enterAndExit(outboxContext{TransitionContext: ctx, buffer: buffer}, from, to); err != nil {
+		return err
+	}
+	if top != nil {
+		if err := top.Render(outboxContext{TransitionContext: renderCtx, buffer: buffer}); err != nil {
+			return err
 		}
 	}
-	st, err := json.Marshal(&states)
+	st, err := s.marshalStack(to)
 	if err != nil {
-		return fmt.Errorf("failed to marshal stack: %w", err)
+		return err
 	}
-	if err := s.storage.SetStack(ctx, key, st); err != nil {
+	if err = outbox.SetStackWithOutbox(ctx, ctx.ChatKey(), st, buffer.messages); err != nil {
 		return fmt.Errorf("failed to set stack: %w", err)
 	}
+	if err = clearPoppedStateData(ctx, from, to); err != nil {
+		return err
+	}
+	s.notify(ctx, from, to)
 	return nil
 }
 
+// enterAndExit calls OnExit of the states leaving the stack, from the top, and then OnEnter of the states joining it, from the bottom.
+func (s *StateHandler) enterAndExit(ctx TransitionContext, from, to []frame) error {
+	common := 0
+	for common < len(from) && common < len(to) && from[common].state.Name() == to[common].state.Name() {
+		common++
+	}
+	for i := len(from) - 1; i >= common; i-- {
+		if state, ok := from[i].state.(ExitingState); ok {
+			if err := state.OnExit(ctx); err != nil {
+				return fmt.Errorf("failed to exit state %s: %w", state.Name(), err)
+			}
+		}
+	}
+	for _, f := range to[common:] {
+		if state, ok := f.state.(EnteringState); ok {
+			if err := state.OnEnter(ctx); err != nil {
+				return fmt.Errorf("failed to enter state %s: %w", state.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// clear pops all states of the stack of the chat, as a transition.
+// clear pops all the states of the chat. It returns false if the chat had no state.
+func (s *StateHandler) clear(ctx TransitionContext) (bool, error) {
+	stack, err := s.getStack(ctx, ctx.ChatKey())
+	if err != nil || len(stack) == 0 {
+		return false, err
+	}
+	return true, s.transition(ctx, stack, nil)
+}
+
 // Back returns a Transition that goes back to the previous state on the stack.
 // If the stack becomes empty, no state will be active and StateHandler skips all updates.
 func (s *StateHandler) Back() Transition {
@@ -198,6 +347,57 @@ func WithStateStore(stateStore StateStorage) StateHandlerOption {
 	}
 }
 
+// WithStackCodec sets how state stacks are encoded in the StateStorage.
+// Default is JSONStackCodec.
+func WithStackCodec(codec StackCodec) StateHandlerOption {
+	return func(s *StateHandler) {
+		s.codec = codec
+	}
+}
+
+// WithTransitionObserver adds an observer notified after every state transition.
+// Can be passed multiple times to add several observers.
+func WithTransitionObserver(observer TransitionObserver) StateHandlerOption {
+	return func(s *StateHandler) {
+		s.observers = append(s.observers, observer)
+	}
+}
+
+// TransitionEvent describes a completed state transition of a chat.
+// From is empty when the chat had no active state, To is empty when the stack became empty.
+type TransitionEvent struct {
+	ChatKey string    `json:"chat_key"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Time    time.Time `json:"time"`
+}
+
+// TransitionObserver is notified of state transitions.
+// Observers are called synchronously during the transition and should return quickly.
+type TransitionObserver func(ctx context.Context, event TransitionEvent)
+
+func (s *StateHandler) notify(ctx TransitionContext, from, to []frame) {
+	if len(s.observers) == 0 {
+		return
+	}
+	event := TransitionEvent{
+		ChatKey: ctx.ChatKey(),
+		From:    topName(from),
+		To:      topName(to),
+		Time:    s.app.clock.Now(),
+	}
+	for _, o := range s.observers {
+		o(ctx, event)
+	}
+}
+
+func topName(stack []frame) string {
+	if len(stack) == 0 {
+		return ""
+	}
+	return stack[len(stack)-1].entry.Name
+}
+
 // Transition represents a state transition.
 // Call Go to perform the transition.
 type Transition interface {
@@ -207,6 +407,23 @@ type Transition interface {
 type toState struct {
 	stateHandler *StateHandler
 	state        State
+	params       map[string]string
+}
+
+// WithStateParams returns a Transition to the state of t that records params in its stack entry,
+// for the state to read with StateHandler.Stack. If the state is already on the stack, its params are replaced.
+// Panics if t was not returned by RegisterState or RegisterAndChainStates.
+//
+// Example:
+//
+//	err := nabot.WithStateParams(toProduct, map[string]string{"id": productID}).Go(ctx)
+func WithStateParams(t Transition, params map[string]string) Transition {
+	ts, ok := t.(toState)
+	if !ok {
+		panic("nabot: WithStateParams requires a Transition returned by RegisterState")
+	}
+	ts.params = params
+	return ts
 }
 
 func (t toState) Go(ctx TransitionContext) error {
@@ -215,21 +432,29 @@ func (t toState) Go(ctx TransitionContext) error {
 		return err
 	}
 
-	idx := slices.IndexFunc(stack, func(state State) bool {
-		return state.Name() == t.state.Name()
+	idx := slices.IndexFunc(stack, func(f frame) bool {
+		return f.state.Name() == t.state.Name()
 	})
 
+	from := stack
 	if idx >= 0 {
-		stack = stack[:idx+1]
+		stack = slices.Clone(stack[:idx+1])
+		if t.params != nil {
+			stack[idx].entry.Params = t.params
+		}
 	} else {
-		stack = append(stack, t.state)
+		stack = append(stack[:len(stack):len(stack)], frame{
+			state: t.state,
+			entry: StackEntry{
+				Name:      t.state.Name(),
+				EnteredAt: t.stateHandler.app.clock.Now(),
+				Params:    t.params,
+				Version:   stateVersion(t.state),
+			},
+		})
 	}
 
-	err = t.stateHandler.setStack(ctx, ctx.ChatKey(), stack)
-	if err != nil {
-		return err
-	}
-	return t.state.Render(ctx)
+	return t.stateHandler.transition(ctx, from, stack)
 }
 
 type back struct {
@@ -244,16 +469,7 @@ func (b back) Go(ctx TransitionContext) error {
 	if len(stack) == 0 {
 		return nil
 	}
-	stack = stack[:len(stack)-1]
-	err = b.stateHandler.setStack(ctx, ctx.ChatKey(), stack)
-	if err != nil {
-		return err
-	}
-
-	if len(stack) > 0 {
-		return stack[len(stack)-1].Render(ctx)
-	}
-	return nil
+	return b.stateHandler.transition(ctx, stack, stack[:len(stack)-1])
 }
 
 // TransitionContext provides dependencies for state transitions and rendering.
@@ -270,6 +486,23 @@ type State interface {
 	Render(ctx TransitionContext) error
 }
 
+// EnteringState is a State notified when it is pushed on the stack of a chat, before it is rendered.
+// States pushed over it do not make it enter again when popped.
+// Hooks should send messages with QueueMessage, so that with an OutboxStateStorage they are committed
+// together with the stack.
+type EnteringState interface {
+	State
+	OnEnter(ctx TransitionContext) error
+}
+
+// ExitingState is a State notified when it is popped from the stack of a chat, such as to remove
+// its reply keyboard. States pushed over it do not make it exit.
+// Like for EnteringState, hooks should send messages with QueueMessage.
+type ExitingState interface {
+	State
+	OnExit(ctx TransitionContext) error
+}
+
 // ChainableState is a State that can be linked to another state.
 // Used in StateHandler.RegisterAndChainStates to create state chains.
 type ChainableState interface {
@@ -303,8 +536,14 @@ type ChainableState interface {
 type BaseState struct {
 	ID       string
 	Renderer func(ctx TransitionContext) error
-	Handlers []Handler
-	ToNext   Transition
+	// PureRenderer is used if Renderer is nil, for renderers that only read the chat's DataStorage.
+	PureRenderer func(ctx RenderContext) error
+	// OnEnterFunc is called when the state is pushed on the stack; see EnteringState.
+	OnEnterFunc func(ctx TransitionContext) error
+	// OnExitFunc is called when the state is popped from the stack; see ExitingState.
+	OnExitFunc func(ctx TransitionContext) error
+	Handlers   []Handler
+	ToNext     Transition
 }
 
 func (b *BaseState) Name() string {
@@ -312,21 +551,31 @@ func (b *BaseState) Name() string {
 }
 
 func (b *BaseState) Render(ctx TransitionContext) error {
-	if b.Renderer == nil {
-		return nil
+	if b.Renderer != nil {
+		return b.Renderer(ctx)
+	}
+	if b.PureRenderer != nil {
+		return b.PureRenderer(ReadOnly(ctx))
 	}
-	return b.Renderer(ctx)
+	return nil
 }
 
-func (b *BaseState) Handle(ctx Context) error {
-	var err error
-	for _, h := range b.Handlers {
-		err = h.Handle(ctx)
-		if errors.Is(err, ErrPass) {
-			continue
-		}
-		break
+func (b *BaseState) OnEnter(ctx TransitionContext) error {
+	if b.OnEnterFunc != nil {
+		return b.OnEnterFunc(ctx)
 	}
+	return nil
+}
+
+func (b *BaseState) OnExit(ctx TransitionContext) error {
+	if b.OnExitFunc != nil {
+		return b.OnExitFunc(ctx)
+	}
+	return nil
+}
+
+func (b *BaseState) Handle(ctx Context) error {
+	_, err := runChain(ctx, b.Handlers, nil)
 	return err
 }
 
@@ -0,0 +1,63 @@
+package nabot
+
+import (
+	"fmt"
+	"slices"
+)
+
+// stateDataPrefix is the prefix of the chat keys of the DataStorage namespaces holding the data of each state.
+const stateDataPrefix = "nabot:state:"
+
+// StateData is a type-safe key for data of a chat belonging to a state, such as the current question of a quiz.
+// The data of each state of a chat is kept in its own DataStorage namespace, one entry per key, so setting
+// a key never overwrites the others. It is removed once the new stack is stored when the state is popped
+// from the stack of the chat, after its OnExit hook is called. If the state is still on the stack below
+// the popped one, they share the data and it is kept.
+//
+// Example:
+//
+//	var currentQuestionKey = nabot.StateData[Question]{State: "quiz", Key: "current_question"}
+//
+//	func (s *quizState) Render(ctx nabot.TransitionContext) error {
+//	    // ...
+//	    return currentQuestionKey.Set(ctx, question)
+//	}
+type StateData[T any] struct {
+	State string
+	Key   string
+}
+
+// Get retrieves the value from the chat's DataStorage.
+// Returns ErrDataKeyNotFound if it is not set, or the state was popped since it was set.
+func (k StateData[T]) Get(c StorageContext) (T, error) {
+	return Get(stateData(c, k.State), DataKey[T](k.Key))
+}
+
+// Set stores the value in the chat's DataStorage.
+func (k StateData[T]) Set(c StorageContext, value T) error {
+	return Set(stateData(c, k.State), DataKey[T](k.Key), value)
+}
+
+// Remove deletes the value from the chat's DataStorage.
+func (k StateData[T]) Remove(c StorageContext) error {
+	return Remove(stateData(c, k.State), DataKey[T](k.Key))
+}
+
+// clearPoppedStateData removes the data of the states of from that are no longer on the to stack.
+func clearPoppedStateData(c StorageContext, from, to []frame) error {
+	for _, f := range from {
+		name := f.state.Name()
+		if slices.ContainsFunc(to, func(t frame) bool { return t.state.Name() == name }) {
+			continue
+		}
+		if err := Clear(stateData(c, name)); err != nil {
+			return fmt.Errorf("failed to clear data of state %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// stateData returns the namespace holding the data of the state for the chat of c.
+func stateData(c StorageContext, state string) StorageContext {
+	return ForChat(c, stateDataPrefix+c.ChatKey()+":"+state)
+}
@@ -0,0 +1,130 @@
+package nabot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/mymmrac/telego"
+	"github.com/mymmrac/telego/telegoapi"
+	"path"
+)
+
+const (
+	stickyKeyboardKey DataKey[telego.ReplyKeyboardMarkup] = "sticky_keyboard"
+)
+
+// SetStickyKeyboard remembers a persistent reply keyboard for the chat, such as the main menu.
+// Messages sent to the chat without their own reply markup get this keyboard attached by a bot using
+// NewStickyKeyboardCaller, or when sent with SendWithStickyKeyboard, so the menu comes back after a sub-flow
+// removed it with ReplyKeyboardRemove.
+//
+// Example:
+//
+//	err := nabot.SetStickyKeyboard(ctx, tu.Keyboard(
+//	    tu.KeyboardRow(tu.KeyboardButton("Orders"), tu.KeyboardButton("Help")),
+//	).WithResizeKeyboard())
+func SetStickyKeyboard(c StorageContext, markup *telego.ReplyKeyboardMarkup) error {
+	return Set(c, stickyKeyboardKey, *markup)
+}
+
+// RemoveStickyKeyboard forgets the persistent reply keyboard of the chat.
+func RemoveStickyKeyboard(c StorageContext) error {
+	return Remove(c, stickyKeyboardKey)
+}
+
+// SendWithStickyKeyboard sends a message to the current chat.
+// If params has no reply markup, the chat's sticky keyboard is attached; an explicit reply markup always wins.
+func SendWithStickyKeyboard(ctx TransitionContext, params *telego.SendMessageParams) (*telego.Message, error) {
+	params.ChatID = ctx.ChatID()
+	if params.ReplyMarkup == nil {
+		markup, err := Get(ctx, stickyKeyboardKey)
+		if err == nil {
+			params.ReplyMarkup = &markup
+		} else if !errors.Is(err, ErrDataKeyNotFound) {
+			return nil, err
+		}
+	}
+	return ctx.Bot().SendMessage(ctx, params)
+}
+
+// stickyKeyboardMethods are the methods sending messages that can have a reply keyboard.
+var stickyKeyboardMethods = map[string]bool{
+	"sendMessage":   true,
+	"sendPhoto":     true,
+	"sendVideo":     true,
+	"sendAnimation": true,
+	"sendAudio":     true,
+	"sendDocument":  true,
+	"sendVoice":     true,
+	"sendVideoNote": true,
+	"sendSticker":   true,
+	"sendLocation":  true,
+	"sendVenue":     true,
+	"sendContact":   true,
+	"sendPoll":      true,
+	"sendDice":      true,
+	"copyMessage":   true,
+}
+
+// NewStickyKeyboardCaller returns a telegoapi.Caller making calls with caller that attaches the sticky keyboard
+// of the current chat to the messages sent to it without a reply markup, so handlers do not need
+// SendWithStickyKeyboard. Only calls made with the context of a chat, such as the Context of a handler,
+// and sent as JSON are changed; an explicit reply markup always wins.
+//
+// Make it the outermost caller, so it receives the context passed to the bot methods.
+//
+// Example:
+//
+//	bot, err := telego.NewBot(token, telego.WithAPICaller(nabot.NewStickyKeyboardCaller(telegoapi.DefaultFastHTTPCaller)))
+func NewStickyKeyboardCaller(caller telegoapi.Caller) telegoapi.Caller {
+	return stickyKeyboardCaller{caller: caller}
+}
+
+type stickyKeyboardCaller struct {
+	caller telegoapi.Caller
+}
+
+func (s stickyKeyboardCaller) Call(ctx context.Context, url string, data *telegoapi.RequestData) (*telegoapi.Response, error) {
+	if c, ok := ctx.(TransitionContext); ok && stickyKeyboardMethods[path.Base(url)] {
+		if err := attachStickyKeyboard(c, data); err != nil {
+			return nil, err
+		}
+	}
+	return s.caller.Call(ctx, url, data)
+}
+
+// attachStickyKeyboard adds the sticky keyboard of the chat to a JSON request sending a message to it
+// without a reply markup.
+func attachStickyKeyboard(ctx TransitionContext, data *telegoapi.RequestData) error {
+	if data == nil || data.Buffer == nil || data.ContentType != telegoapi.ContentTypeJSON {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data.Buffer.Bytes(), &fields) != nil {
+		return nil
+	}
+	if _, ok := fields["reply_markup"]; ok {
+		return nil
+	}
+	var chatID telego.ChatID
+	if json.Unmarshal(fields["chat_id"], &chatID) != nil || chatID.String() != ctx.ChatID().String() {
+		return nil
+	}
+	markup, err := Get(ctx, stickyKeyboardKey)
+	if errors.Is(err, ErrDataKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fields["reply_markup"], err = json.Marshal(markup); err != nil {
+		return err
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	data.Buffer = bytes.NewBuffer(body)
+	return nil
+}
@@ -2,6 +2,7 @@ package nabot
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -10,6 +11,9 @@ import (
 
 var (
 	ErrDataKeyNotFound = errors.New("key not found")
+	// ErrTypeMismatch is returned when a stored value cannot be assigned to the requested type,
+	// such as after the type of a DataKey changed between deploys. See TypeMismatchPolicy.
+	ErrTypeMismatch = errors.New("stored value type mismatch")
 )
 
 // DataStorage stores arbitrary data for each chat.
@@ -103,20 +107,66 @@ func Clear(c StorageContext) error {
 	return nil
 }
 
+type chatStorage struct {
+	context.Context
+	chatKey string
+	store   DataStorage
+}
+
+func (c chatStorage) ChatKey() string {
+	return c.chatKey
+}
+
+func (c chatStorage) Store() DataStorage {
+	return c.store
+}
+
+// ForChat returns a StorageContext accessing the data of another chat in the same DataStorage.
+// Useful when handling an update of one chat changes the data of another, like relaying messages.
+//
+// Example:
+//
+//	err := nabot.Set(nabot.ForChat(ctx, userChatKey), ticketKey, ticket)
+func ForChat(c StorageContext, chatKey string) StorageContext {
+	return chatStorage{
+		Context: c,
+		chatKey: chatKey,
+		store:   c.Store(),
+	}
+}
+
 type memoryStore struct {
 	data      sync.Map
 	navStacks sync.Map
+	mismatch  TypeMismatchPolicy
+	watchers  sync.Map
 }
 
 // NewInMemoryDataStore creates an in-memory data storage.
-func NewInMemoryDataStore() DataStorage {
-	return &memoryStore{}
+func NewInMemoryDataStore(options ...MemoryStoreOption) DataStorage {
+	m := &memoryStore{}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// MemoryStoreOption configures the DataStorage created by NewInMemoryDataStore.
+type MemoryStoreOption func(*memoryStore)
+
+// WithTypeMismatchPolicy sets what happens when a stored value does not match the type it is read as.
+// Default is MismatchError.
+func WithTypeMismatchPolicy(policy TypeMismatchPolicy) MemoryStoreOption {
+	return func(m *memoryStore) {
+		m.mismatch = policy
+	}
 }
 
 func (m *memoryStore) SetData(_ context.Context, chatKey string, key string, value any) error {
 	d, _ := m.data.LoadOrStore(chatKey, &sync.Map{})
 	data := d.(*sync.Map)
 	data.Store(key, value)
+	m.notifyWatchers(chatKey, key)
 	return nil
 }
 
@@ -130,23 +180,83 @@ func (m *memoryStore) GetData(_ context.Context, chatKey string, key string, poi
 	if !ok {
 		return ErrDataKeyNotFound
 	}
+	return assignValue(v, pointer, m.mismatch)
+}
+
+// assignValue sets *pointer to v if v is assignable to the pointed type.
+// Otherwise, the value returned by policy is used. A nil policy means MismatchError.
+func assignValue(v any, pointer any, policy TypeMismatchPolicy) error {
 	p := reflect.ValueOf(pointer).Elem()
 	val := reflect.ValueOf(v)
-	if !val.Type().AssignableTo(p.Type()) {
-		return fmt.Errorf("stored value of type %v is not assignable to type %v", val.Type(), p.Type())
+	if !val.IsValid() || !val.Type().AssignableTo(p.Type()) {
+		if policy == nil {
+			policy = MismatchError
+		}
+		converted, err := policy(v, p.Type())
+		if err != nil {
+			return err
+		}
+		val = reflect.ValueOf(converted)
+		if !val.IsValid() || !val.Type().AssignableTo(p.Type()) {
+			return fmt.Errorf("%w: converted value of type %T is not assignable to type %v", ErrTypeMismatch, converted, p.Type())
+		}
 	}
 	p.Set(val)
 	return nil
 }
 
+// TypeMismatchPolicy is called when a stored value cannot be assigned to the type it is read as.
+// It returns the value to use instead, which must be assignable to target, or an error returned by the read.
+// Custom policies can convert values of known old types, and defer to another policy for the rest.
+//
+// Example:
+//
+//	store := nabot.NewInMemoryDataStore(nabot.WithTypeMismatchPolicy(
+//	    func(value any, target reflect.Type) (any, error) {
+//	        if n, ok := value.(int); ok && target == reflect.TypeFor[int64]() {
+//	            return int64(n), nil
+//	        }
+//	        return nabot.MismatchNotFound(value, target)
+//	    },
+//	))
+type TypeMismatchPolicy func(value any, target reflect.Type) (any, error)
+
+// MismatchError fails the read with an error wrapping ErrTypeMismatch.
+func MismatchError(value any, target reflect.Type) (any, error) {
+	return nil, fmt.Errorf("%w: stored value of type %T is not assignable to type %v", ErrTypeMismatch, value, target)
+}
+
+// MismatchNotFound treats the value as missing, so the read returns ErrDataKeyNotFound
+// and handlers continue with their defaults.
+func MismatchNotFound(any, reflect.Type) (any, error) {
+	return nil, ErrDataKeyNotFound
+}
+
+// MismatchJSON encodes the value as JSON and decodes it as the target type,
+// which handles renamed struct types and added or removed fields.
+// If the value cannot be decoded, the read returns ErrDataKeyNotFound.
+func MismatchJSON(value any, target reflect.Type) (any, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, ErrDataKeyNotFound
+	}
+	result := reflect.New(target)
+	if err = json.Unmarshal(b, result.Interface()); err != nil {
+		return nil, ErrDataKeyNotFound
+	}
+	return result.Elem().Interface(), nil
+}
+
 func (m *memoryStore) RemoveData(_ context.Context, chatKey string, key string) error {
 	d, _ := m.data.LoadOrStore(chatKey, &sync.Map{})
 	data := d.(*sync.Map)
 	data.Delete(key)
+	m.notifyWatchers(chatKey, key)
 	return nil
 }
 
 func (m *memoryStore) ClearData(_ context.Context, chatKey string) error {
 	m.data.Delete(chatKey)
+	m.notifyWatchers(chatKey, "")
 	return nil
 }
@@ -0,0 +1,345 @@
+// Package support implements a support ticket flow for nabot.
+//
+// Users open a ticket with a command and their messages are relayed to a staff group.
+// Staff members answer by replying to the relayed messages, and the replies are sent back to the user.
+// Replying with /close closes the ticket and replying with /assign <name> reassigns it.
+// Closing a ticket removes the links of its staff chat messages, so later replies to them are passed on.
+//
+// Example:
+//
+//	desk := support.New(telego.ChatID{ID: staffGroupID})
+//	app.Handle(desk)
+package support
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the state of a ticket.
+type Status string
+
+const (
+	StatusOpen   Status = "open"
+	StatusClosed Status = "closed"
+)
+
+// Ticket is a support ticket of a user chat, stored in the chat's DataStorage.
+type Ticket struct {
+	// ID is the message ID of the ticket header in the staff chat.
+	ID       int       `json:"id"`
+	Status   Status    `json:"status"`
+	Assignee string    `json:"assignee,omitempty"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+// ticketRef links a message in the staff chat to the user chat of its ticket.
+type ticketRef struct {
+	TicketID int           `json:"ticket_id"`
+	ChatKey  string        `json:"chat_key"`
+	ChatID   telego.ChatID `json:"chat_id"`
+}
+
+const (
+	ticketKey nabot.DataKey[Ticket] = "support_ticket"
+	// ticketMessagesKey holds the staff chat messages linked to the open ticket of a chat, removed on close.
+	ticketMessagesKey nabot.DataKey[[]int] = "support_ticket_messages"
+)
+
+func refKey(messageID int) nabot.DataKey[ticketRef] {
+	return nabot.DataKey[ticketRef]("support_message:" + strconv.Itoa(messageID))
+}
+
+// GetTicket returns the ticket of the current chat.
+// Returns nabot.ErrDataKeyNotFound if the chat never opened a ticket.
+func GetTicket(ctx nabot.StorageContext) (Ticket, error) {
+	return nabot.Get(ctx, ticketKey)
+}
+
+// Texts are the messages sent by Support.
+type Texts struct {
+	// Opened is sent to the user when a ticket is opened.
+	Opened string
+	// AlreadyOpen is sent to the user who opens a ticket while one is open.
+	AlreadyOpen string
+	// Closed is sent to the user when staff closes the ticket.
+	Closed string
+	// Header is posted to the staff chat for a new ticket. It is formatted with the ticket ID and the user name.
+	Header string
+	// TicketClosed is sent to staff replying to a closed ticket.
+	TicketClosed string
+	// Assigned is sent to staff when a ticket is reassigned. It is formatted with the ticket ID and the assignee.
+	Assigned string
+}
+
+// DefaultTexts are the texts used unless WithTexts is given.
+var DefaultTexts = Texts{
+	Opened:       "Your ticket is open. Send your messages and our team will answer here.",
+	AlreadyOpen:  "You already have an open ticket. Send your messages and our team will answer here.",
+	Closed:       "Your ticket was closed.",
+	Header:       "Ticket #%d from %s",
+	TicketClosed: "This ticket is closed.",
+	Assigned:     "Ticket #%d assigned to %s",
+}
+
+// Support relays the messages of users with open tickets to a staff chat and routes staff replies back.
+// It is a nabot.Handler; register it before handlers that would otherwise consume the users' messages.
+type Support struct {
+	staffChat   telego.ChatID
+	staffThread int
+	command     string
+	botUsername string
+	texts       Texts
+}
+
+// New creates a Support relaying tickets to staffChat.
+func New(staffChat telego.ChatID, options ...Option) *Support {
+	s := &Support{
+		staffChat: staffChat,
+		command:   "/support",
+		texts:     DefaultTexts,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+func (s *Support) Name() string {
+	return "support"
+}
+
+func (s *Support) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeMessage}
+}
+
+func (s *Support) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil {
+		return nabot.ErrPass
+	}
+	if ctx.ChatID().ID == s.staffChat.ID {
+		return s.handleStaff(ctx, msg)
+	}
+	return s.handleUser(ctx, msg)
+}
+
+func (s *Support) handleUser(ctx nabot.Context, msg *telego.Message) error {
+	ticket, err := GetTicket(ctx)
+	if err != nil && !errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return err
+	}
+	isOpen := err == nil && ticket.Status == StatusOpen
+
+	if command, _, _ := s.parseCommand(msg.Text); command == s.command {
+		if isOpen {
+			return s.send(ctx, ctx.ChatID(), s.texts.AlreadyOpen)
+		}
+		return s.open(ctx, msg)
+	}
+	if !isOpen {
+		return nabot.ErrPass
+	}
+	copied, err := ctx.Bot().CopyMessage(ctx, &telego.CopyMessageParams{
+		ChatID:          s.staffChat,
+		MessageThreadID: s.staffThread,
+		FromChatID:      ctx.ChatID(),
+		MessageID:       msg.MessageID,
+		ReplyParameters: &telego.ReplyParameters{MessageID: ticket.ID, AllowSendingWithoutReply: true},
+	})
+	if err != nil {
+		return err
+	}
+	return s.link(ctx, ticket.ID, copied.MessageID)
+}
+
+func (s *Support) open(ctx nabot.Context, msg *telego.Message) error {
+	name := "unknown"
+	if msg.From != nil {
+		name = strings.TrimSpace(msg.From.FirstName + " " + msg.From.LastName)
+		if msg.From.Username != "" {
+			name += " (@" + msg.From.Username + ")"
+		}
+	}
+	header, err := ctx.Bot().SendMessage(ctx, &telego.SendMessageParams{
+		ChatID:          s.staffChat,
+		MessageThreadID: s.staffThread,
+		Text:            fmt.Sprintf(s.texts.Header, 0, name),
+	})
+	if err != nil {
+		return err
+	}
+	// the header is sent before its ID is known, so fix up the ticket number
+	_, err = ctx.Bot().EditMessageText(ctx, &telego.EditMessageTextParams{
+		ChatID:    s.staffChat,
+		MessageID: header.MessageID,
+		Text:      fmt.Sprintf(s.texts.Header, header.MessageID, name),
+	})
+	if err != nil {
+		ctx.Logger().Warn("nabot: failed to number support ticket", "error", err)
+	}
+	ticket := Ticket{
+		ID:       header.MessageID,
+		Status:   StatusOpen,
+		OpenedAt: nabot.ClockOf(ctx).Now(),
+	}
+	if err = nabot.Set(ctx, ticketKey, ticket); err != nil {
+		return err
+	}
+	if err = s.link(ctx, ticket.ID, header.MessageID); err != nil {
+		return err
+	}
+	return s.send(ctx, ctx.ChatID(), s.texts.Opened)
+}
+
+// link records that a staff chat message belongs to the ticket of the current chat.
+func (s *Support) link(ctx nabot.Context, ticketID int, staffMessageID int) error {
+	messages, err := nabot.Get(ctx, ticketMessagesKey)
+	if err != nil && !errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return err
+	}
+	if err = nabot.Set(ctx, ticketMessagesKey, append(messages, staffMessageID)); err != nil {
+		return err
+	}
+	return nabot.Set(s.staffStorage(ctx), refKey(staffMessageID), ticketRef{
+		TicketID: ticketID,
+		ChatKey:  ctx.ChatKey(),
+		ChatID:   ctx.ChatID(),
+	})
+}
+
+// close closes the ticket of the user chat and removes the links of its staff chat messages.
+func (s *Support) close(ctx nabot.Context, user nabot.StorageContext, ticket Ticket) error {
+	ticket.Status = StatusClosed
+	if err := nabot.Set(user, ticketKey, ticket); err != nil {
+		return err
+	}
+	messages, err := nabot.Get(user, ticketMessagesKey)
+	if err != nil && !errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return err
+	}
+	staff := s.staffStorage(ctx)
+	for _, messageID := range messages {
+		if err = nabot.Remove(staff, refKey(messageID)); err != nil {
+			return err
+		}
+	}
+	return nabot.Remove(user, ticketMessagesKey)
+}
+
+// parseCommand returns the command at the start of text without its @username suffix, and the text following it.
+// Commands addressed to a bot other than the one set with WithBotUsername are not returned.
+func (s *Support) parseCommand(text string) (string, string, bool) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(text), " ")
+	if !strings.HasPrefix(first, "/") {
+		return "", "", false
+	}
+	command, username, _ := strings.Cut(first, "@")
+	if username != "" && s.botUsername != "" && !strings.EqualFold(username, s.botUsername) {
+		return "", "", false
+	}
+	return command, strings.TrimSpace(rest), true
+}
+
+// staffStorage returns the storage of the staff chat, where staff messages are linked to tickets.
+func (s *Support) staffStorage(ctx nabot.StorageContext) nabot.StorageContext {
+	return nabot.ForChat(ctx, s.staffChat.String())
+}
+
+func (s *Support) handleStaff(ctx nabot.Context, msg *telego.Message) error {
+	if msg.ReplyToMessage == nil {
+		return nabot.ErrPass
+	}
+	ref, err := nabot.Get(s.staffStorage(ctx), refKey(msg.ReplyToMessage.MessageID))
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return nabot.ErrPass
+	}
+	if err != nil {
+		return err
+	}
+	user := nabot.ForChat(ctx, ref.ChatKey)
+	ticket, err := GetTicket(user)
+	if err != nil {
+		return err
+	}
+	// the user may have opened a new ticket since this message was relayed
+	if ticket.Status != StatusOpen || ticket.ID != ref.TicketID {
+		return s.send(ctx, s.staffChat, s.texts.TicketClosed)
+	}
+
+	command, arg, _ := s.parseCommand(msg.Text)
+	switch command {
+	case "/close":
+		if err = s.close(ctx, user, ticket); err != nil {
+			return err
+		}
+		return s.send(ctx, ref.ChatID, s.texts.Closed)
+	case "/assign":
+		ticket.Assignee = arg
+		if err = nabot.Set(user, ticketKey, ticket); err != nil {
+			return err
+		}
+		return s.send(ctx, s.staffChat, fmt.Sprintf(s.texts.Assigned, ticket.ID, ticket.Assignee))
+	}
+
+	_, err = ctx.Bot().CopyMessage(ctx, &telego.CopyMessageParams{
+		ChatID:     ref.ChatID,
+		FromChatID: s.staffChat,
+		MessageID:  msg.MessageID,
+	})
+	return err
+}
+
+func (s *Support) send(ctx nabot.Context, chatID telego.ChatID, text string) error {
+	params := &telego.SendMessageParams{
+		ChatID: chatID,
+		Text:   text,
+	}
+	if chatID == s.staffChat {
+		params.MessageThreadID = s.staffThread
+	}
+	_, err := ctx.Bot().SendMessage(ctx, params)
+	return err
+}
+
+// Option configures a Support.
+type Option func(*Support)
+
+// WithStaffThread relays tickets to a topic of the staff chat.
+func WithStaffThread(threadID int) Option {
+	return func(s *Support) {
+		s.staffThread = threadID
+	}
+}
+
+// WithOpenCommand sets the command users send to open a ticket.
+// Default is "/support".
+func WithOpenCommand(command string) Option {
+	return func(s *Support) {
+		if !strings.HasPrefix(command, "/") {
+			command = "/" + command
+		}
+		s.command = command
+	}
+}
+
+// WithBotUsername sets the username of the bot, without @, so commands addressed to other bots,
+// such as /close@otherbot, are ignored.
+func WithBotUsername(username string) Option {
+	return func(s *Support) {
+		s.botUsername = username
+	}
+}
+
+// WithTexts sets the messages sent by Support.
+// Default is DefaultTexts.
+func WithTexts(texts Texts) Option {
+	return func(s *Support) {
+		s.texts = texts
+	}
+}
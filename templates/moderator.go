@@ -0,0 +1,170 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ModeratorConfig configures the Moderator template.
+type ModeratorConfig struct {
+	// Welcome is sent when members join, formatted with their first name. No welcome is sent if empty.
+	Welcome string
+	// BannedWords are the words messages are deleted for, matched case-insensitively after normalization.
+	BannedWords []string
+	// DeleteLinks also deletes messages containing links, except those of admins.
+	DeleteLinks bool
+	// MaxWarnings is the number of deleted messages after which the member is banned. Default is 3.
+	// Negative means members are never banned.
+	MaxWarnings int
+	// Warning is sent when a message is deleted, formatted with the first name of the member,
+	// the number of warnings and MaxWarnings. Default is "%s, your message was removed (warning %d of %d).".
+	Warning string
+	// Banned is sent when a member is banned, formatted with their first name. Default is "%s was banned.".
+	Banned string
+}
+
+// Moderator registers a group moderator: it welcomes new members, deletes messages containing banned words
+// or links, warns their senders and bans members reaching MaxWarnings. The bot must be an admin of the groups.
+// Warnings are counted per member in the DataStorage of each group.
+func Moderator(app *nabot.App, config ModeratorConfig) {
+	m := &moderator{config: config}
+	m.config.Warning = orDefault(config.Warning, "%s, your message was removed (warning %d of %d).")
+	m.config.Banned = orDefault(config.Banned, "%s was banned.")
+	if m.config.MaxWarnings == 0 {
+		m.config.MaxWarnings = 3
+	}
+	for _, w := range config.BannedWords {
+		if w = strings.ToLower(nabot.NormalizeText(w)); w != "" {
+			m.bannedWords = append(m.bannedWords, w)
+		}
+	}
+	app.Handle(m)
+}
+
+type moderator struct {
+	config      ModeratorConfig
+	bannedWords []string
+}
+
+func (m *moderator) Name() string {
+	return "moderator"
+}
+
+func (m *moderator) UpdateTypes() []string {
+	return []string{nabot.UpdateTypeMessage}
+}
+
+func (m *moderator) Handle(ctx nabot.Context) error {
+	msg := ctx.Update().Message
+	if msg == nil || (msg.Chat.Type != telego.ChatTypeGroup && msg.Chat.Type != telego.ChatTypeSupergroup) {
+		return nabot.ErrPass
+	}
+	if len(msg.NewChatMembers) > 0 {
+		return m.welcome(ctx, msg.NewChatMembers)
+	}
+	if msg.From == nil || !m.violates(msg) {
+		return nabot.ErrPass
+	}
+	member, err := ctx.Bot().GetChatMember(ctx, &telego.GetChatMemberParams{ChatID: ctx.ChatID(), UserID: msg.From.ID})
+	if err != nil {
+		return err
+	}
+	if status := member.MemberStatus(); status == telego.MemberStatusCreator || status == telego.MemberStatusAdministrator {
+		return nil
+	}
+	err = ctx.Bot().DeleteMessage(ctx, &telego.DeleteMessageParams{ChatID: ctx.ChatID(), MessageID: msg.MessageID})
+	if err != nil {
+		return err
+	}
+	return m.warn(ctx, *msg.From)
+}
+
+func (m *moderator) welcome(ctx nabot.Context, members []telego.User) error {
+	if m.config.Welcome == "" {
+		return nil
+	}
+	for _, member := range members {
+		if member.IsBot {
+			continue
+		}
+		if err := send(ctx, fmt.Sprintf(m.config.Welcome, member.FirstName), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// violates reports whether the message contains a banned word or, if enabled, a link.
+func (m *moderator) violates(msg *telego.Message) bool {
+	text := msg.Text
+	entities := msg.Entities
+	if text == "" {
+		text, entities = msg.Caption, msg.CaptionEntities
+	}
+	if m.config.DeleteLinks {
+		for _, e := range entities {
+			if e.Type == telego.EntityTypeURL || e.Type == telego.EntityTypeTextLink {
+				return true
+			}
+		}
+	}
+	normalized := strings.ToLower(nabot.NormalizeText(text))
+	for _, w := range m.bannedWords {
+		if containsWord(normalized, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsWord reports whether word occurs in text as a whole word, so banning "ass" does not flag "class".
+func containsWord(text, word string) bool {
+	for i := 0; i <= len(text)-len(word); {
+		j := strings.Index(text[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		i = start + size
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+func (m *moderator) warn(ctx nabot.Context, user telego.User) error {
+	key := nabot.DataKey[int]("moderator_warnings:" + strconv.FormatInt(user.ID, 10))
+	warnings, err := nabot.Get(ctx, key)
+	if err != nil && !errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return err
+	}
+	warnings++
+	if m.config.MaxWarnings < 0 || warnings < m.config.MaxWarnings {
+		if err = nabot.Set(ctx, key, warnings); err != nil {
+			return err
+		}
+		return send(ctx, fmt.Sprintf(m.config.Warning, user.FirstName, warnings, m.config.MaxWarnings), nil)
+	}
+	err = ctx.Bot().BanChatMember(ctx, &telego.BanChatMemberParams{ChatID: ctx.ChatID(), UserID: user.ID})
+	if err != nil {
+		return err
+	}
+	if err = nabot.Remove(ctx, key); err != nil {
+		return err
+	}
+	return send(ctx, fmt.Sprintf(m.config.Banned, user.FirstName), nil)
+}
@@ -0,0 +1,239 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bale-ir/nabot"
+	"github.com/bale-ir/nabot/handlers"
+	"github.com/mymmrac/telego"
+	"math/rand/v2"
+)
+
+// QuizQuestion is a multiple choice question of the Quiz template.
+type QuizQuestion struct {
+	Text    string
+	Options []string
+	// Correct is the index of the correct option.
+	Correct int
+}
+
+// QuizCategory is a topic of questions of the Quiz template.
+type QuizCategory struct {
+	ID        string
+	Name      string
+	Questions []QuizQuestion
+}
+
+// QuizScore counts the answers of a chat in the Quiz template.
+type QuizScore struct {
+	Answered int `json:"answered"`
+	Correct  int `json:"correct"`
+}
+
+// QuizConfig configures the Quiz template.
+type QuizConfig struct {
+	// Welcome is sent with the categories on /start. Default is "Choose a topic:".
+	Welcome    string
+	Categories []QuizCategory
+	// Correct is sent for a correct answer, formatted with the score. Default is "Correct! Score: %d/%d".
+	Correct string
+	// Wrong is sent for a wrong answer, formatted with the correct option and the score.
+	// Default is "Wrong! The answer was %s. Score: %d/%d".
+	Wrong string
+	// AgainText and ChangeText are the texts of the buttons asking another question and changing the topic.
+	// Defaults are "Ask again" and "Change topic".
+	AgainText  string
+	ChangeText string
+	// StateOptions configure the StateHandler of the quiz.
+	StateOptions []nabot.StateHandlerOption
+}
+
+const (
+	quizCategoryKey nabot.DataKey[string]       = "quiz_category"
+	quizQuestionKey nabot.DataKey[QuizQuestion] = "quiz_question"
+	quizScoreKey    nabot.DataKey[QuizScore]    = "quiz_score"
+)
+
+// GetQuizScore returns the score of the current chat in the Quiz template.
+func GetQuizScore(ctx nabot.StorageContext) (QuizScore, error) {
+	score, err := nabot.Get(ctx, quizScoreKey)
+	if errors.Is(err, nabot.ErrDataKeyNotFound) {
+		return QuizScore{}, nil
+	}
+	return score, err
+}
+
+// Quiz registers a quiz bot: /start shows the categories, and the quiz state asks random questions
+// of the chosen category with the options as keyboard buttons, keeping the score of each chat.
+// It is built of two chained states, a menu and a quiz state, like the quizbot example.
+func Quiz(app *nabot.App, config QuizConfig) {
+	if len(config.Categories) == 0 {
+		panic("nabot: the quiz template requires at least one category")
+	}
+	q := &quiz{config: config, categories: make(map[string]QuizCategory)}
+	for _, c := range config.Categories {
+		if len(c.Questions) == 0 {
+			panic(fmt.Sprintf("nabot: quiz category %q has no questions", c.ID))
+		}
+		for _, question := range c.Questions {
+			if question.Correct < 0 || question.Correct >= len(question.Options) {
+				panic(fmt.Sprintf("nabot: quiz question %q has no correct option", question.Text))
+			}
+		}
+		q.categories[c.ID] = c
+	}
+	q.config.Welcome = orDefault(config.Welcome, "Choose a topic:")
+	q.config.Correct = orDefault(config.Correct, "Correct! Score: %d/%d")
+	q.config.Wrong = orDefault(config.Wrong, "Wrong! The answer was %s. Score: %d/%d")
+	q.config.AgainText = orDefault(config.AgainText, "Ask again")
+	q.config.ChangeText = orDefault(config.ChangeText, "Change topic")
+
+	stateHandler := nabot.NewStateHandler(app, config.StateOptions...)
+	toMenu := stateHandler.RegisterAndChainStates(q.newMenuState(), q.newQuestionState(stateHandler.Back()))
+	app.Handle(handlers.Command{
+		Command: "start",
+		HandleFunc: func(ctx nabot.Context, args []string) error {
+			return toMenu.Go(ctx)
+		},
+	})
+	app.Handle(stateHandler)
+	// chats without a state, such as after a restart with in-memory state storage, start over
+	app.Handle(handlers.Func(func(ctx nabot.Context) error {
+		return toMenu.Go(ctx)
+	}))
+}
+
+type quiz struct {
+	config     QuizConfig
+	categories map[string]QuizCategory
+}
+
+type quizMenuState struct {
+	nabot.BaseState
+	quiz           *quiz
+	categoryButton handlers.InlineButton
+}
+
+func (q *quiz) newMenuState() nabot.ChainableState {
+	s := &quizMenuState{quiz: q}
+	s.categoryButton = handlers.InlineButton{ID: "quiz_category", HandleFunc: s.handleCategory}
+	s.BaseState = nabot.BaseState{
+		ID:       "quiz_menu",
+		Renderer: s.Render,
+		Handlers: []nabot.Handler{s.categoryButton},
+	}
+	return s
+}
+
+func (s *quizMenuState) Render(ctx nabot.TransitionContext) error {
+	var rows [][]telego.InlineKeyboardButton
+	for _, c := range s.quiz.config.Categories {
+		rows = append(rows, []telego.InlineKeyboardButton{s.categoryButton.ButtonWithText(c.Name, c.ID)})
+	}
+	return send(ctx, s.quiz.config.Welcome, &telego.InlineKeyboardMarkup{InlineKeyboard: rows})
+}
+
+func (s *quizMenuState) handleCategory(ctx nabot.Context, id string) error {
+	answer(ctx)
+	if len(s.quiz.categories[id].Questions) == 0 {
+		return nil
+	}
+	if err := nabot.Set(ctx, quizCategoryKey, id); err != nil {
+		return err
+	}
+	return s.ToNext.Go(ctx)
+}
+
+type quizQuestionState struct {
+	nabot.BaseState
+	quiz         *quiz
+	againButton  handlers.KeyboardButton
+	changeButton handlers.KeyboardButton
+}
+
+func (q *quiz) newQuestionState(toBack nabot.Transition) nabot.ChainableState {
+	s := &quizQuestionState{quiz: q}
+	s.againButton = handlers.KeyboardButton{Text: q.config.AgainText, HandleFunc: s.handleAgain}
+	s.changeButton = handlers.KeyboardButton{Text: q.config.ChangeText, HandleFunc: s.handleChange}
+	s.BaseState = nabot.BaseState{
+		ID:          "quiz_question",
+		Renderer:    s.Render,
+		OnEnterFunc: s.pick,
+		Handlers: []nabot.Handler{
+			s.againButton,
+			s.changeButton,
+			handlers.Text{HandlerName: "quiz_answer", HandleFunc: s.handleAnswer},
+		},
+		// the last state of the chain goes back to the menu
+		ToNext: toBack,
+	}
+	return s
+}
+
+// pick stores a random question of the chosen category as the current question.
+func (s *quizQuestionState) pick(ctx nabot.TransitionContext) error {
+	id, err := nabot.Get(ctx, quizCategoryKey)
+	if err != nil {
+		return err
+	}
+	questions := s.quiz.categories[id].Questions
+	if len(questions) == 0 {
+		return errors.New("quiz category has no questions")
+	}
+	return nabot.Set(ctx, quizQuestionKey, questions[rand.IntN(len(questions))])
+}
+
+func (s *quizQuestionState) Render(ctx nabot.TransitionContext) error {
+	question, err := nabot.Get(ctx, quizQuestionKey)
+	if err != nil {
+		return err
+	}
+	var rows [][]telego.KeyboardButton
+	for _, option := range question.Options {
+		// two options per row
+		if len(rows) > 0 && len(rows[len(rows)-1]) == 1 {
+			rows[len(rows)-1] = append(rows[len(rows)-1], telego.KeyboardButton{Text: option})
+		} else {
+			rows = append(rows, []telego.KeyboardButton{{Text: option}})
+		}
+	}
+	return send(ctx, question.Text, &telego.ReplyKeyboardMarkup{Keyboard: rows, ResizeKeyboard: true})
+}
+
+func (s *quizQuestionState) handleAgain(ctx nabot.Context) error {
+	if err := s.pick(ctx); err != nil {
+		return err
+	}
+	return s.Render(ctx)
+}
+
+func (s *quizQuestionState) handleChange(ctx nabot.Context) error {
+	return s.ToNext.Go(ctx)
+}
+
+func (s *quizQuestionState) handleAnswer(ctx nabot.Context, text string) error {
+	question, err := nabot.Get(ctx, quizQuestionKey)
+	if err != nil {
+		return err
+	}
+	score, err := GetQuizScore(ctx)
+	if err != nil {
+		return err
+	}
+	score.Answered++
+	correct := question.Options[question.Correct]
+	var reply string
+	if nabot.NormalizeText(text) == nabot.NormalizeText(correct) {
+		score.Correct++
+		reply = fmt.Sprintf(s.quiz.config.Correct, score.Correct, score.Answered)
+	} else {
+		reply = fmt.Sprintf(s.quiz.config.Wrong, correct, score.Correct, score.Answered)
+	}
+	if err = nabot.Set(ctx, quizScoreKey, score); err != nil {
+		return err
+	}
+	return send(ctx, reply, &telego.ReplyKeyboardMarkup{
+		Keyboard:       [][]telego.KeyboardButton{{s.changeButton.Button(), s.againButton.Button()}},
+		ResizeKeyboard: true,
+	})
+}
@@ -0,0 +1,151 @@
+package templates
+
+import (
+	"errors"
+	"github.com/bale-ir/nabot"
+	"github.com/bale-ir/nabot/format"
+	"github.com/bale-ir/nabot/handlers"
+	"github.com/mymmrac/telego"
+)
+
+// Product is an item sold by the Shop template.
+type Product struct {
+	ID          string
+	Title       string
+	Description string
+	// Price is in rials.
+	Price int64
+	// PhotoFileID is the file ID of a photo shown with the product, if not empty.
+	PhotoFileID string
+}
+
+// ShopConfig configures the Shop template.
+type ShopConfig struct {
+	// Welcome is sent with the catalog on /start. Default is "Welcome! Choose a product:".
+	Welcome  string
+	Products []Product
+	// ProviderToken is the token of the payment provider of the bot.
+	ProviderToken string
+	// Currency is the currency of the invoices. Default is "IRR".
+	Currency string
+	// PriceCurrency is the currency prices are shown in. Default is format.Rial.
+	PriceCurrency format.Currency
+	// BuyText is the text of the buy button. Default is "Buy".
+	BuyText string
+	// OnOrder is called once for each paid order.
+	OnOrder func(ctx nabot.Context, product Product, payment telego.SuccessfulPayment) error
+	// Receipt is sent after OnOrder succeeds. Default is "Thanks for your purchase!".
+	Receipt string
+}
+
+// Shop registers a shop bot: /start shows the catalog, each product opens a card with a buy button,
+// which sends an invoice paid with Bale payments. Paid orders are passed to OnOrder exactly once,
+// and a receipt is sent.
+func Shop(app *nabot.App, config ShopConfig) {
+	if len(config.Products) == 0 {
+		panic("nabot: the shop template requires at least one product")
+	}
+	s := &shop{config: config, products: make(map[string]Product)}
+	for _, p := range config.Products {
+		s.products[p.ID] = p
+	}
+	s.config.Welcome = orDefault(config.Welcome, "Welcome! Choose a product:")
+	s.config.Currency = orDefault(config.Currency, "IRR")
+	s.config.BuyText = orDefault(config.BuyText, "Buy")
+	s.config.Receipt = orDefault(config.Receipt, "Thanks for your purchase!")
+
+	s.productButton = handlers.InlineButton{ID: "shop_product", HandleFunc: s.showProduct}
+	s.buyButton = handlers.InlineButton{ID: "shop_buy", HandleFunc: s.buy}
+	s.checkout = &handlers.Checkout{
+		HandlerName: "shop_checkout",
+		Validate:    s.validate,
+		Fulfill:     s.fulfill,
+		Receipt: func(nabot.Context, telego.SuccessfulPayment) string {
+			return s.config.Receipt
+		},
+	}
+
+	app.Handle(handlers.Command{
+		Command: "start",
+		HandleFunc: func(ctx nabot.Context, args []string) error {
+			return s.showCatalog(ctx)
+		},
+	})
+	app.Handle(s.productButton)
+	app.Handle(s.buyButton)
+	app.Handle(s.checkout)
+}
+
+type shop struct {
+	config        ShopConfig
+	products      map[string]Product
+	productButton handlers.InlineButton
+	buyButton     handlers.InlineButton
+	checkout      *handlers.Checkout
+}
+
+func (s *shop) showCatalog(ctx nabot.Context) error {
+	var rows [][]telego.InlineKeyboardButton
+	for _, p := range s.config.Products {
+		text := p.Title + " - " + format.Price(p.Price, s.config.PriceCurrency)
+		rows = append(rows, []telego.InlineKeyboardButton{s.productButton.ButtonWithText(text, p.ID)})
+	}
+	return send(ctx, s.config.Welcome, &telego.InlineKeyboardMarkup{InlineKeyboard: rows})
+}
+
+func (s *shop) showProduct(ctx nabot.Context, id string) error {
+	answer(ctx)
+	p, ok := s.products[id]
+	if !ok {
+		return nil
+	}
+	text := p.Title + "\n\n" + p.Description + "\n\n" + format.Price(p.Price, s.config.PriceCurrency)
+	markup := &telego.InlineKeyboardMarkup{InlineKeyboard: [][]telego.InlineKeyboardButton{
+		{s.buyButton.ButtonWithText(s.config.BuyText, p.ID)},
+	}}
+	if p.PhotoFileID == "" {
+		return send(ctx, text, markup)
+	}
+	_, err := ctx.Bot().SendPhoto(ctx, &telego.SendPhotoParams{
+		ChatID:      ctx.ChatID(),
+		Photo:       telego.InputFile{FileID: p.PhotoFileID},
+		Caption:     text,
+		ReplyMarkup: markup,
+	})
+	return err
+}
+
+func (s *shop) buy(ctx nabot.Context, id string) error {
+	answer(ctx)
+	p, ok := s.products[id]
+	if !ok {
+		return nil
+	}
+	_, err := s.checkout.SendInvoice(ctx, &telego.SendInvoiceParams{
+		Title:         p.Title,
+		Description:   orDefault(p.Description, p.Title),
+		Payload:       p.ID,
+		ProviderToken: s.config.ProviderToken,
+		Currency:      s.config.Currency,
+		Prices:        []telego.LabeledPrice{{Label: p.Title, Amount: int(p.Price)}},
+	})
+	return err
+}
+
+func (s *shop) validate(_ nabot.Context, query telego.PreCheckoutQuery) error {
+	product, ok := s.products[query.InvoicePayload]
+	if !ok {
+		return errors.New("this product is no longer available")
+	}
+	if query.Currency != s.config.Currency || query.TotalAmount != int(product.Price) {
+		return errors.New("the price of this product has changed")
+	}
+	return nil
+}
+
+func (s *shop) fulfill(ctx nabot.Context, payment telego.SuccessfulPayment) error {
+	if s.config.OnOrder == nil {
+		return nil
+	}
+	return s.config.OnOrder(ctx, s.products[payment.InvoicePayload], payment)
+}
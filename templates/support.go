@@ -0,0 +1,92 @@
+package templates
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/bale-ir/nabot/handlers"
+	"github.com/bale-ir/nabot/support"
+	"github.com/mymmrac/telego"
+	"strconv"
+)
+
+// FAQ is a question answered by the SupportDesk template without involving staff.
+type FAQ struct {
+	Question string
+	Answer   string
+}
+
+// SupportConfig configures the SupportDesk template.
+type SupportConfig struct {
+	// StaffChat is the group staff members answer tickets in.
+	StaffChat telego.ChatID
+	// StaffThread is the topic of StaffChat tickets are relayed to, if not zero.
+	StaffThread int
+	// Welcome is sent with the FAQ on /start. Default is "Hi! How can we help?".
+	Welcome string
+	FAQ     []FAQ
+	// Contact is sent after an answer of the FAQ and when a user sends something the bot does not understand.
+	// Default is "Still need help? Send /support to talk to our team.".
+	Contact string
+	// Texts are the messages of the ticket flow. Default is support.DefaultTexts.
+	Texts *support.Texts
+}
+
+// SupportDesk registers a support bot: /start shows the FAQ as buttons answered by the bot,
+// and users who need more help open a ticket with /support, relayed to the staff chat by support.Support.
+// Staff members answer by replying to the relayed messages.
+func SupportDesk(app *nabot.App, config SupportConfig) {
+	if config.StaffChat.ID == 0 && config.StaffChat.Username == "" {
+		panic("nabot: the support template requires a staff chat")
+	}
+	s := &supportDesk{config: config}
+	s.config.Welcome = orDefault(config.Welcome, "Hi! How can we help?")
+	s.config.Contact = orDefault(config.Contact, "Still need help? Send /support to talk to our team.")
+	s.faqButton = handlers.InlineButton{ID: "support_faq", HandleFunc: s.answerFAQ}
+
+	options := []support.Option{support.WithStaffThread(config.StaffThread)}
+	if config.Texts != nil {
+		options = append(options, support.WithTexts(*config.Texts))
+	}
+	// the desk comes first, so the messages of open tickets are relayed instead of answered by the bot
+	app.Handle(support.New(config.StaffChat, options...))
+	app.Handle(handlers.Command{
+		Command: "start",
+		HandleFunc: func(ctx nabot.Context, args []string) error {
+			return s.showFAQ(ctx)
+		},
+	})
+	app.Handle(s.faqButton)
+	app.Handle(handlers.Text{
+		HandlerName: "support_contact",
+		HandleFunc: func(ctx nabot.Context, text string) error {
+			if ctx.ChatID().ID == config.StaffChat.ID {
+				return nabot.ErrPass
+			}
+			return send(ctx, s.config.Contact, nil)
+		},
+	})
+}
+
+type supportDesk struct {
+	config    SupportConfig
+	faqButton handlers.InlineButton
+}
+
+func (s *supportDesk) showFAQ(ctx nabot.Context) error {
+	if len(s.config.FAQ) == 0 {
+		return send(ctx, s.config.Welcome+"\n\n"+s.config.Contact, nil)
+	}
+	var rows [][]telego.InlineKeyboardButton
+	for i, faq := range s.config.FAQ {
+		rows = append(rows, []telego.InlineKeyboardButton{s.faqButton.ButtonWithText(faq.Question, strconv.Itoa(i))})
+	}
+	return send(ctx, s.config.Welcome, &telego.InlineKeyboardMarkup{InlineKeyboard: rows})
+}
+
+func (s *supportDesk) answerFAQ(ctx nabot.Context, data string) error {
+	answer(ctx)
+	i, err := strconv.Atoi(data)
+	if err != nil || i < 0 || i >= len(s.config.FAQ) {
+		return nil
+	}
+	return send(ctx, s.config.FAQ[i].Answer+"\n\n"+s.config.Contact, nil)
+}
@@ -0,0 +1,57 @@
+// Package templates provides complete bot skeletons built from the nabot packages:
+// a shop selling products with Bale payments, a support desk with FAQs, a group moderator and a quiz bot.
+//
+// Each template registers its handlers on an App from a config struct, so a working bot is a few lines away,
+// and its source doubles as documentation of how the building blocks fit together.
+// Templates for private chats register a /start command and expect to be the main feature of the bot;
+// register other handlers before them to take precedence.
+//
+// Example:
+//
+//	app := nabot.NewApp(bot, updates)
+//	templates.Shop(app, templates.ShopConfig{
+//	    Welcome:       "Welcome to our shop!",
+//	    ProviderToken: providerToken,
+//	    Products: []templates.Product{
+//	        {ID: "mug", Title: "Mug", Description: "A large mug", Price: 1_500_000},
+//	    },
+//	    OnOrder: func(ctx nabot.Context, p templates.Product, payment telego.SuccessfulPayment) error {
+//	        return orders.Create(ctx, p.ID, payment)
+//	    },
+//	})
+//	app.Run()
+package templates
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/mymmrac/telego"
+)
+
+// orDefault returns text, or def if text is empty.
+func orDefault(text, def string) string {
+	if text == "" {
+		return def
+	}
+	return text
+}
+
+// send sends a message with QueueMessage, so messages of Renders go through the outbox of an OutboxStateStorage.
+func send(ctx nabot.TransitionContext, text string, markup telego.ReplyMarkup) error {
+	return nabot.QueueMessage(ctx, &telego.SendMessageParams{
+		ChatID:      ctx.ChatID(),
+		Text:        text,
+		ReplyMarkup: markup,
+	})
+}
+
+// answer acknowledges the callback query of the update, so the client stops its loading indicator.
+func answer(ctx nabot.Context) {
+	query := ctx.Update().CallbackQuery
+	if query == nil {
+		return
+	}
+	err := ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{CallbackQueryID: query.ID})
+	if err != nil {
+		ctx.Logger().Warn("nabot: failed to answer callback query", "error", err)
+	}
+}
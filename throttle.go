@@ -0,0 +1,200 @@
+package nabot
+
+import (
+	"bytes"
+	"context"
+	"github.com/mymmrac/telego/telegoapi"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Throttler paces outgoing messages to stay within the rate limits of the Bale and Telegram servers
+// and retries calls rejected with 429 Too Many Requests after the reported retry-after.
+// It wraps the telegoapi.Caller of the bot, so every message sent through ctx.Bot() is throttled transparently:
+// calls sending messages wait their turn, in order, for both the global and their chat's limit.
+// Other calls are not delayed, but are retried on 429 as well.
+//
+// Default limits are 30 messages per second overall, one per second per private chat
+// and 20 per minute per group; see WithGlobalRate, WithChatRate and WithGroupRate.
+//
+// Example:
+//
+//	throttler := nabot.NewThrottler(telegoapi.DefaultFastHTTPCaller)
+//	bot, err := telego.NewBot(token, telego.WithAPICaller(throttler))
+type Throttler struct {
+	caller     telegoapi.Caller
+	clock      Clock
+	global     time.Duration
+	chat       time.Duration
+	group      time.Duration
+	maxRetries int
+
+	mu         sync.Mutex
+	globalNext time.Time
+	chatNext   map[string]time.Time
+}
+
+// NewThrottler creates a Throttler making calls with caller.
+func NewThrottler(caller telegoapi.Caller, options ...ThrottleOption) *Throttler {
+	t := &Throttler{
+		caller:     caller,
+		clock:      SystemClock,
+		global:     time.Second / 30,
+		chat:       time.Second,
+		group:      time.Minute / 20,
+		maxRetries: 3,
+		chatNext:   make(map[string]time.Time),
+	}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+func (t *Throttler) Call(ctx context.Context, url string, data *telegoapi.RequestData) (*telegoapi.Response, error) {
+	method := path.Base(url)
+	chatID := ""
+	if data != nil && isSendMethod(method) {
+		// JSON requests have the raw, possibly quoted, value
+		chatID = strings.Trim(requestField(data, "chat_id"), `"`)
+	}
+	// keep the body, which the caller consumes, for retries
+	var body []byte
+	if data != nil && data.Buffer != nil {
+		body = bytes.Clone(data.Buffer.Bytes())
+	}
+	for attempt := 0; ; attempt++ {
+		if chatID != "" {
+			if err := t.wait(ctx, t.reserve(chatID)); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := t.caller.Call(ctx, url, data)
+		if err != nil || resp.Ok || resp.Error == nil || resp.Error.ErrorCode != http.StatusTooManyRequests ||
+			attempt >= t.maxRetries {
+			return resp, err
+		}
+		retryAfter := time.Second
+		if resp.Error.Parameters != nil && resp.Error.Parameters.RetryAfter > 0 {
+			retryAfter = time.Duration(resp.Error.Parameters.RetryAfter) * time.Second
+		}
+		t.pause(chatID, retryAfter)
+		if chatID == "" {
+			if err = t.wait(ctx, retryAfter); err != nil {
+				return nil, err
+			}
+		}
+		if body != nil {
+			data.Buffer = bytes.NewBuffer(bytes.Clone(body))
+		}
+	}
+}
+
+// reserve reserves the next slot of the chat within the global and chat limits,
+// and returns how long to wait for it.
+func (t *Throttler) reserve(chatID string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.clock.Now()
+	at := now
+	if t.globalNext.After(at) {
+		at = t.globalNext
+	}
+	if next := t.chatNext[chatID]; next.After(at) {
+		at = next
+	}
+	t.globalNext = at.Add(t.global)
+	interval := t.chat
+	if strings.HasPrefix(chatID, "-") || strings.HasPrefix(chatID, "@") {
+		interval = t.group
+	}
+	t.chatNext[chatID] = at.Add(interval)
+	// forget chats whose slots have passed, so the map does not grow with every chat ever messaged
+	if len(t.chatNext) > 1024 {
+		for id, next := range t.chatNext {
+			if next.Before(now) {
+				delete(t.chatNext, id)
+			}
+		}
+	}
+	return at.Sub(now)
+}
+
+// pause delays the next messages of the chat, or of all chats if chatID is empty, by retryAfter.
+func (t *Throttler) pause(chatID string, retryAfter time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until := t.clock.Now().Add(retryAfter)
+	if chatID == "" {
+		if until.After(t.globalNext) {
+			t.globalNext = until
+		}
+		return
+	}
+	if until.After(t.chatNext[chatID]) {
+		t.chatNext[chatID] = until
+	}
+}
+
+func (t *Throttler) wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-t.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// isSendMethod reports whether the API method sends a message to a chat, and is subject to message limits.
+// sendChatAction only shows a status such as typing, and does not count towards them.
+func isSendMethod(method string) bool {
+	if method == "sendChatAction" {
+		return false
+	}
+	return strings.HasPrefix(method, "send") || strings.HasPrefix(method, "copyMessage") ||
+		strings.HasPrefix(method, "forwardMessage")
+}
+
+// ThrottleOption configures a Throttler.
+type ThrottleOption func(*Throttler)
+
+// WithGlobalRate sets the number of messages sent per second overall. Default is 30.
+func WithGlobalRate(perSecond int) ThrottleOption {
+	return func(t *Throttler) {
+		t.global = time.Second / time.Duration(max(perSecond, 1))
+	}
+}
+
+// WithChatRate sets the number of messages sent per second to a private chat. Default is 1.
+func WithChatRate(perSecond int) ThrottleOption {
+	return func(t *Throttler) {
+		t.chat = time.Second / time.Duration(max(perSecond, 1))
+	}
+}
+
+// WithGroupRate sets the number of messages sent per minute to a group or channel. Default is 20.
+func WithGroupRate(perMinute int) ThrottleOption {
+	return func(t *Throttler) {
+		t.group = time.Minute / time.Duration(max(perMinute, 1))
+	}
+}
+
+// WithMaxRetries sets how many times a call rejected with 429 is retried. Default is 3.
+func WithMaxRetries(retries int) ThrottleOption {
+	return func(t *Throttler) {
+		t.maxRetries = max(retries, 0)
+	}
+}
+
+// WithThrottleClock sets the Clock timing the Throttler. Default is SystemClock.
+func WithThrottleClock(clock Clock) ThrottleOption {
+	return func(t *Throttler) {
+		t.clock = clock
+	}
+}
@@ -0,0 +1,198 @@
+package nabot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// StateTimeout configures the timeout of chats inactive in a state; see StateHandler.SetTimeout.
+type StateTimeout struct {
+	// After is the inactivity after which chats in the state time out.
+	After time.Duration
+	// To is the transition taken on timeout. Defaults to StateHandler.Back.
+	To Transition
+	// OnTimeout is called before the transition, such as to tell the user the form was abandoned.
+	OnTimeout func(ctx TransitionContext) error
+}
+
+// SetTimeout makes chats staying in the state for longer than timeout.After without updates time out,
+// so abandoned conversations do not stay stuck. Start the job checking for timeouts with RunTimeouts.
+// Panics if the state is not registered or timeout.After is not positive.
+//
+// Example:
+//
+//	toForm := stateHandler.RegisterState(formState)
+//	stateHandler.SetTimeout("form", nabot.StateTimeout{
+//	    After: 15 * time.Minute,
+//	    To:    toMain,
+//	    OnTimeout: func(ctx nabot.TransitionContext) error {
+//	        _, err := ctx.Bot().SendMessage(ctx, tu.Message(ctx.ChatID(), "The form was cancelled."))
+//	        return err
+//	    },
+//	})
+//	go stateHandler.RunTimeouts(ctx)
+func (s *StateHandler) SetTimeout(state string, timeout StateTimeout) {
+	if _, ok := s.states[state]; !ok {
+		panic(fmt.Sprintf("nabot: cannot set timeout of unregistered state %q", state))
+	}
+	if timeout.After <= 0 {
+		panic(fmt.Sprintf("nabot: timeout of state %q must be positive", state))
+	}
+	if timeout.To == nil {
+		timeout.To = s.Back()
+	}
+	if s.timeouts == nil {
+		s.timeouts = make(map[string]StateTimeout)
+	}
+	s.timeouts[state] = timeout
+}
+
+// RunTimeouts checks for chats timing out periodically and blocks until ctx is done.
+// Chats failing to time out are retried on the next check.
+//
+// Timeouts run in turn with the updates of the chat when they are handled one at a time, with WithOrderedUpdates
+// or WithFairScheduler, and otherwise on the Executor. A chat that was active or left the state since it was found
+// idle is not timed out, but without per-chat ordering an update handled at the same time as the timeout
+// may still race with it, so keep the After durations well above the time a chat takes to answer.
+func (s *StateHandler) RunTimeouts(ctx context.Context) {
+	for {
+		select {
+		case <-s.app.clock.After(s.timeoutInterval):
+			s.timeOut(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// touch records activity of the chat in its state, if any state has a timeout.
+// Activity of the candidate handlers of a Shadow is not recorded.
+func (s *StateHandler) touch(ctx TransitionContext) {
+	if len(s.timeouts) == 0 {
+		return
+	}
+	if v := getUpdateValues(ctx); v != nil && v.stacks != nil {
+		return
+	}
+	if err := s.activity.Touch(ctx, ctx.ChatKey(), ctx.ChatID(), s.app.clock.Now()); err != nil {
+		LoggerOf(ctx).Error("nabot: failed to record state activity", "error", err)
+	}
+	s.timingOutMu.Lock()
+	if _, ok := s.timingOut[ctx.ChatKey()]; ok {
+		s.timingOut[ctx.ChatKey()] = true
+	}
+	s.timingOutMu.Unlock()
+}
+
+func (s *StateHandler) timeOut(ctx context.Context) {
+	now := s.app.clock.Now()
+	shortest := time.Duration(0)
+	for _, t := range s.timeouts {
+		if shortest == 0 || t.After < shortest {
+			shortest = t.After
+		}
+	}
+	if shortest == 0 {
+		return
+	}
+	chats, err := s.activity.IdleSince(ctx, now.Add(-shortest))
+	if err != nil {
+		s.app.logger.Error("nabot: failed to list idle chats", "error", err)
+		return
+	}
+	for _, c := range chats {
+		logger := s.app.logger.With(slog.String("chat", c.ChatID.String()))
+		stack, err := s.getStack(ctx, c.ChatKey)
+		if err != nil {
+			logger.Error("nabot: failed to get state of idle chat", "error", err)
+			continue
+		}
+		var timeout StateTimeout
+		var ok bool
+		if len(stack) > 0 {
+			timeout, ok = s.timeouts[stack[len(stack)-1].state.Name()]
+		}
+		if !ok {
+			// the chat left the states with a timeout; it is touched again when it enters one
+			if err = s.activity.Forget(ctx, c.ChatKey); err != nil {
+				logger.Error("nabot: failed to forget idle chat", "error", err)
+			}
+			continue
+		}
+		if c.LastActive.After(now.Add(-timeout.After)) {
+			continue
+		}
+		if !s.queueTimeout(c.ChatKey) {
+			// still queued from a previous check
+			continue
+		}
+		chatCtx := s.app.chatContext(ctx, c.ChatKey, c.ChatID)
+		depth, top := len(stack), stack[len(stack)-1].entry
+		s.app.runInChat(c.ChatKey, func() {
+			// on failure the chat is kept idle, so the next check retries it
+			if err := s.timeOutChat(chatCtx, depth, top, timeout); err != nil {
+				logger.Error("nabot: failed to time out state", "error", err)
+			}
+		})
+	}
+}
+
+// queueTimeout records that the timeout of the chat is queued. It returns false if it already is.
+func (s *StateHandler) queueTimeout(chatKey string) bool {
+	s.timingOutMu.Lock()
+	defer s.timingOutMu.Unlock()
+	if _, ok := s.timingOut[chatKey]; ok {
+		return false
+	}
+	if s.timingOut == nil {
+		s.timingOut = make(map[string]bool)
+	}
+	s.timingOut[chatKey] = false
+	return true
+}
+
+// timeOutChat times out the chat found idle with the given stack depth and top entry,
+// unless it was active or changed state since.
+func (s *StateHandler) timeOutChat(ctx TransitionContext, depth int, top StackEntry, timeout StateTimeout) error {
+	s.timingOutMu.Lock()
+	active := s.timingOut[ctx.ChatKey()]
+	delete(s.timingOut, ctx.ChatKey())
+	s.timingOutMu.Unlock()
+	if active {
+		return nil
+	}
+	stack, err := s.getStack(ctx, ctx.ChatKey())
+	if err != nil {
+		return err
+	}
+	if len(stack) != depth {
+		return nil
+	}
+	if current := stack[depth-1].entry; current.Name != top.Name || !current.EnteredAt.Equal(top.EnteredAt) {
+		return nil
+	}
+	if timeout.OnTimeout != nil {
+		if err := timeout.OnTimeout(ctx); err != nil {
+			return err
+		}
+	}
+	return timeout.To.Go(ctx)
+}
+
+// WithStateActivityStore sets the storage of the activity of chats in states with a timeout.
+// Default is NewInMemoryActivityStore().
+func WithStateActivityStore(store ActivityStorage) StateHandlerOption {
+	return func(s *StateHandler) {
+		s.activity = store
+	}
+}
+
+// WithTimeoutCheckInterval sets how often RunTimeouts checks for chats timing out.
+// Default is one minute.
+func WithTimeoutCheckInterval(interval time.Duration) StateHandlerOption {
+	return func(s *StateHandler) {
+		s.timeoutInterval = interval
+	}
+}
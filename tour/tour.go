@@ -0,0 +1,201 @@
+// Package tour generates onboarding tours for nabot.
+//
+// A tour is a sequence of tips, each rendered as a message with Next and Skip buttons.
+// The tips are registered as chained states, and whether each chat completed or skipped the tour is recorded
+// in its DataStorage.
+//
+// Example:
+//
+//	onboarding := tour.New("onboarding", []tour.Tip{
+//	    {Text: "Welcome! Send /new to create a list."},
+//	    {Text: "Share lists with friends from the list menu.", Photo: &telego.InputFile{FileID: shareScreenshotID}},
+//	    {Text: "That's it, have fun!"},
+//	})
+//	toTour := onboarding.Register(stateHandler, toMainState)
+package tour
+
+import (
+	"github.com/bale-ir/nabot"
+	"github.com/bale-ir/nabot/handlers"
+	"github.com/mymmrac/telego"
+	"strconv"
+)
+
+// Tip is one step of a tour.
+type Tip struct {
+	Text string
+	// Photo is sent with Text as its caption if not nil.
+	Photo *telego.InputFile
+}
+
+// Progress records how far a chat got in a tour.
+type Progress struct {
+	Step      int  `json:"step"`
+	Completed bool `json:"completed"`
+	Skipped   bool `json:"skipped"`
+}
+
+// Tour is a sequence of tips rendered as chained states.
+type Tour struct {
+	id       string
+	tips     []Tip
+	nextText string
+	skipText string
+}
+
+// New creates a tour. The id must be unique among tours and states of the StateHandler it is registered to.
+func New(id string, tips []Tip, options ...Option) *Tour {
+	if len(tips) == 0 {
+		panic("nabot: a tour requires at least one tip")
+	}
+	t := &Tour{
+		id:       id,
+		tips:     tips,
+		nextText: "Next",
+		skipText: "Skip",
+	}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+// Register registers the states of the tour and returns a Transition to its first tip.
+// Finishing or skipping the tour goes to done.
+func (t *Tour) Register(stateHandler *nabot.StateHandler, done nabot.Transition) nabot.Transition {
+	states := make([]nabot.ChainableState, len(t.tips))
+	for i := range t.tips {
+		states[i] = t.newTipState(i, done)
+	}
+	return stateHandler.RegisterAndChainStates(states...)
+}
+
+// GetProgress returns the progress of the current chat in the tour.
+// Returns nabot.ErrDataKeyNotFound if the chat never started the tour.
+func (t *Tour) GetProgress(ctx nabot.StorageContext) (Progress, error) {
+	return nabot.Get(ctx, t.progressKey())
+}
+
+func (t *Tour) progressKey() nabot.DataKey[Progress] {
+	return nabot.DataKey[Progress]("tour:" + t.id)
+}
+
+type tipState struct {
+	nabot.BaseState
+	tour       *Tour
+	step       int
+	done       nabot.Transition
+	nextButton handlers.InlineButton
+	skipButton handlers.InlineButton
+}
+
+func (t *Tour) newTipState(step int, done nabot.Transition) nabot.ChainableState {
+	s := &tipState{
+		tour: t,
+		step: step,
+		done: done,
+	}
+	s.nextButton = handlers.InlineButton{
+		ID:          t.id + "_next",
+		DefaultText: t.nextText,
+		HandleFunc:  s.handleNext,
+	}
+	s.skipButton = handlers.InlineButton{
+		ID:          t.id + "_skip",
+		DefaultText: t.skipText,
+		HandleFunc:  s.handleSkip,
+	}
+	s.BaseState = nabot.BaseState{
+		ID:          t.id + "_" + strconv.Itoa(step),
+		Renderer:    s.Render,
+		OnEnterFunc: s.enter,
+		Handlers: []nabot.Handler{
+			s.nextButton,
+			s.skipButton,
+		},
+	}
+	if step == len(t.tips)-1 {
+		s.ToNext = done
+	}
+	return s
+}
+
+// enter records the step as the progress of the chat. It is done on entering rather than rendering,
+// so rendering has no side effects on storage.
+func (s *tipState) enter(ctx nabot.TransitionContext) error {
+	return nabot.Set(ctx, s.tour.progressKey(), Progress{Step: s.step})
+}
+
+func (s *tipState) Render(ctx nabot.TransitionContext) error {
+	data := strconv.Itoa(s.step)
+	row := []telego.InlineKeyboardButton{s.nextButton.Button(data)}
+	if s.step < len(s.tour.tips)-1 {
+		row = append(row, s.skipButton.Button(data))
+	}
+	markup := &telego.InlineKeyboardMarkup{InlineKeyboard: [][]telego.InlineKeyboardButton{row}}
+
+	tip := s.tour.tips[s.step]
+	if tip.Photo != nil {
+		// the outbox only holds text messages
+		_, err := ctx.Bot().SendPhoto(ctx, &telego.SendPhotoParams{
+			ChatID:      ctx.ChatID(),
+			Photo:       *tip.Photo,
+			Caption:     tip.Text,
+			ReplyMarkup: markup,
+		})
+		return err
+	}
+	return nabot.QueueMessage(ctx, &telego.SendMessageParams{
+		ChatID:      ctx.ChatID(),
+		Text:        tip.Text,
+		ReplyMarkup: markup,
+	})
+}
+
+func (s *tipState) handleNext(ctx nabot.Context, data string) error {
+	if !s.current(ctx, data) {
+		return nil
+	}
+	if s.step == len(s.tour.tips)-1 {
+		return s.finish(ctx, Progress{Step: s.step, Completed: true})
+	}
+	return s.ToNext.Go(ctx)
+}
+
+func (s *tipState) handleSkip(ctx nabot.Context, data string) error {
+	if !s.current(ctx, data) {
+		return nil
+	}
+	return s.finish(ctx, Progress{Step: s.step, Skipped: true})
+}
+
+// current answers the callback query and reports whether it came from the message of this step,
+// so buttons of older tips are ignored.
+func (s *tipState) current(ctx nabot.Context, data string) bool {
+	err := ctx.Bot().AnswerCallbackQuery(ctx, &telego.AnswerCallbackQueryParams{
+		CallbackQueryID: ctx.Update().CallbackQuery.ID,
+	})
+	if err != nil {
+		ctx.Logger().Warn("nabot: failed to answer callback query", "error", err)
+	}
+	return data == strconv.Itoa(s.step)
+}
+
+func (s *tipState) finish(ctx nabot.Context, progress Progress) error {
+	if err := nabot.Set(ctx, s.tour.progressKey(), progress); err != nil {
+		return err
+	}
+	return s.done.Go(ctx)
+}
+
+// Option configures a Tour.
+type Option func(*Tour)
+
+// WithButtonTexts sets the texts of the Next and Skip buttons.
+// Default is "Next" and "Skip".
+func WithButtonTexts(next, skip string) Option {
+	return func(t *Tour) {
+		t.nextText = next
+		t.skipText = skip
+	}
+}
@@ -0,0 +1,94 @@
+package nabot
+
+import (
+	"context"
+	"github.com/mymmrac/telego/telegoapi"
+	"log/slog"
+	"path"
+)
+
+// TracerProvider starts the spans of a tracing system, such as OpenTelemetry.
+// Spans are propagated through the context: spans started with a context returned by Start are its children.
+//
+// With WithTracerProvider, the App starts a span per update, with child spans per handler,
+// storage operation and state transition. NewTracingCaller adds spans for the Bale API calls.
+//
+// An OpenTelemetry trace.TracerProvider is adapted with a few lines:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, nabot.Span) {
+//	    kvs := make([]attribute.KeyValue, len(attrs))
+//	    for i, a := range attrs {
+//	        kvs[i] = attribute.String(a.Key, a.Value.String())
+//	    }
+//	    ctx, span := t.Tracer.Start(ctx, name, trace.WithAttributes(kvs...))
+//	    return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) RecordError(err error) {
+//	    s.Span.RecordError(err)
+//	    s.Span.SetStatus(codes.Error, err.Error())
+//	}
+//
+//	func (s otelSpan) End() { s.Span.End() }
+type TracerProvider interface {
+	Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span)
+}
+
+// Span is a traced operation started by a TracerProvider.
+type Span interface {
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	End()
+}
+
+// WithTracerProvider traces the handling of updates with tp: a span per update, named "update <type>",
+// with child spans per handler, storage operation and state transition.
+// Handlers receive a Context carrying the span of their call, so they can start child spans of their own.
+//
+// Example:
+//
+//	tracer := otelTracer{otel.Tracer("mybot")}
+//	bot, err := telego.NewBot(token, telego.WithAPICaller(nabot.NewTracingCaller(telegoapi.DefaultFastHTTPCaller, tracer)))
+//	// ...
+//	app := nabot.NewApp(bot, updates, nabot.WithTracerProvider(tracer))
+func WithTracerProvider(tp TracerProvider) AppOption {
+	return func(a *App) {
+		a.tracer = tp
+	}
+}
+
+// startSpan starts a span if the App is traced and returns the context carrying it. The span is nil otherwise.
+func (a *App) startSpan(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, Span) {
+	if a == nil || a.tracer == nil {
+		return ctx, nil
+	}
+	return a.tracer.Start(ctx, name, attrs...)
+}
+
+// NewTracingCaller returns a telegoapi.Caller making calls with caller in spans of tp, named "api <method>",
+// so the time spent in the Bale API shows in the traces of updates.
+func NewTracingCaller(caller telegoapi.Caller, tp TracerProvider) telegoapi.Caller {
+	return tracingCaller{caller: caller, tracer: tp}
+}
+
+type tracingCaller struct {
+	caller telegoapi.Caller
+	tracer TracerProvider
+}
+
+func (t tracingCaller) Call(ctx context.Context, url string, data *telegoapi.RequestData) (*telegoapi.Response, error) {
+	method := path.Base(url)
+	ctx, span := t.tracer.Start(ctx, "api "+method, slog.String("nabot.api_method", method))
+	resp, err := t.caller.Call(ctx, url, data)
+	if err == nil && resp != nil && !resp.Ok && resp.Error != nil {
+		span.RecordError(resp.Error)
+	} else if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+	return resp, err
+}
@@ -0,0 +1,176 @@
+package nabot
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// WatchableStorage is a DataStorage notifying of changes to its keys natively,
+// such as a Redis storage subscribed to keyspace notifications. Watch polls storages not implementing it.
+// The in-memory storage created by NewInMemoryDataStore implements it.
+type WatchableStorage interface {
+	DataStorage
+	// WatchData calls notify after the key changes, until ctx is done. It returns once the watch is set up.
+	// notify must not block; notifications may be coalesced or spurious.
+	WatchData(ctx context.Context, chatKey string, dataKey string, notify func()) error
+}
+
+// Watch calls callback whenever the value of key in the data of chatKey changes, such as when another service
+// updates the status of an order, until ctx is done. The callback receives the new value, or ErrDataKeyNotFound
+// if the key was removed. Callbacks are called one at a time from a goroutine started by Watch.
+//
+// Changes are detected natively if store implements WatchableStorage, and by polling otherwise;
+// see WithPollInterval. Watch returns once watching has started.
+//
+// Example:
+//
+//	err := nabot.Watch(ctx, store, userChatKey, orderStatusKey, func(status string, err error) {
+//	    if err == nil {
+//	        _, _ = bot.SendMessage(ctx, tu.Message(userChatID, "Your order is "+status))
+//	    }
+//	})
+func Watch[T any](ctx context.Context, store DataStorage, chatKey string, key DataKey[T], callback func(value T, err error), options ...WatchOption) error {
+	config := watchConfig{interval: 5 * time.Second, clock: SystemClock}
+	for _, option := range options {
+		option(&config)
+	}
+	storage := chatStorage{Context: ctx, chatKey: chatKey, store: store}
+
+	var changed <-chan struct{}
+	if ws, ok := store.(WatchableStorage); ok {
+		notifications := make(chan struct{}, 1)
+		err := ws.WatchData(ctx, chatKey, string(key), func() {
+			select {
+			case notifications <- struct{}{}:
+			default:
+			}
+		})
+		if err != nil {
+			return err
+		}
+		changed = notifications
+	}
+	// read after subscribing, so a change made in between is notified
+	last, lastErr := Get(storage, key)
+
+	go func() {
+		for {
+			if changed != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-changed:
+				}
+			} else {
+				select {
+				case <-ctx.Done():
+					return
+				case <-config.clock.After(config.interval):
+				}
+			}
+			value, err := Get(storage, key)
+			if sameRead(last, lastErr, value, err) {
+				continue
+			}
+			last, lastErr = value, err
+			callback(value, err)
+		}
+	}()
+	return nil
+}
+
+// sameRead reports whether two reads of a key returned the same value, or failed the same way.
+func sameRead[T any](a T, aErr error, b T, bErr error) bool {
+	if aErr != nil || bErr != nil {
+		return errors.Is(aErr, ErrDataKeyNotFound) && errors.Is(bErr, ErrDataKeyNotFound)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+type watchConfig struct {
+	interval time.Duration
+	clock    Clock
+}
+
+// WatchOption configures Watch.
+type WatchOption func(*watchConfig)
+
+// WithPollInterval sets how often the key is read when the storage does not implement WatchableStorage.
+// Default is 5 seconds.
+func WithPollInterval(interval time.Duration) WatchOption {
+	return func(c *watchConfig) {
+		c.interval = interval
+	}
+}
+
+// WithWatchClock sets the Clock timing the polls. Default is SystemClock.
+func WithWatchClock(clock Clock) WatchOption {
+	return func(c *watchConfig) {
+		c.clock = clock
+	}
+}
+
+// chatWatchers are the watchers of the keys of a chat in a memoryStore.
+type chatWatchers struct {
+	mu       sync.Mutex
+	watchers map[string][]*func()
+	// removed is set once the last watcher is gone and the entry is removed from the store.
+	removed bool
+}
+
+func (m *memoryStore) WatchData(ctx context.Context, chatKey string, dataKey string, notify func()) error {
+	f := &notify
+	var cw *chatWatchers
+	for {
+		w, _ := m.watchers.LoadOrStore(chatKey, &chatWatchers{watchers: make(map[string][]*func())})
+		cw = w.(*chatWatchers)
+		cw.mu.Lock()
+		if !cw.removed {
+			break
+		}
+		// the entry was removed after it was loaded; load or store a new one
+		cw.mu.Unlock()
+	}
+	cw.watchers[dataKey] = append(cw.watchers[dataKey], f)
+	cw.mu.Unlock()
+	context.AfterFunc(ctx, func() {
+		cw.mu.Lock()
+		defer cw.mu.Unlock()
+		for i, g := range cw.watchers[dataKey] {
+			if g == f {
+				cw.watchers[dataKey] = append(cw.watchers[dataKey][:i], cw.watchers[dataKey][i+1:]...)
+				break
+			}
+		}
+		if len(cw.watchers[dataKey]) == 0 {
+			delete(cw.watchers, dataKey)
+		}
+		if len(cw.watchers) == 0 {
+			cw.removed = true
+			m.watchers.CompareAndDelete(chatKey, cw)
+		}
+	})
+	return nil
+}
+
+// notifyWatchers notifies the watchers of dataKey in the chat, or of all its keys if dataKey is empty.
+func (m *memoryStore) notifyWatchers(chatKey string, dataKey string) {
+	w, ok := m.watchers.Load(chatKey)
+	if !ok {
+		return
+	}
+	cw := w.(*chatWatchers)
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	for key, fs := range cw.watchers {
+		if dataKey != "" && key != dataKey {
+			continue
+		}
+		for _, f := range fs {
+			(*f)()
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package nabot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/mymmrac/telego"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebhookConfig configures the HTTP server of App.RunWebhook.
+type WebhookConfig struct {
+	// Addr is the address the server listens on, such as ":8443".
+	Addr string
+	// Path is the path updates are posted to. Default is "/".
+	Path string
+	// CertFile and KeyFile serve HTTPS if set; otherwise the server serves plain HTTP,
+	// such as behind a TLS-terminating proxy.
+	CertFile string
+	KeyFile  string
+	// Buffer is the number of updates received but not yet dispatched. Default is 100.
+	// When it is full, requests wait, so the Bale server retries later instead of updates being dropped.
+	Buffer int
+	// ShutdownTimeout bounds waiting for in-flight requests when the context is done. Default is 10 seconds.
+	ShutdownTimeout time.Duration
+	// ReadHeaderTimeout bounds reading the headers of a request. Default is 10 seconds.
+	ReadHeaderTimeout time.Duration
+	// MaxBodyBytes is the maximum size of an update; larger requests are rejected. Default is 1 MiB.
+	MaxBodyBytes int64
+}
+
+// RunWebhook receives updates through a webhook instead of the update channel given to NewApp,
+// which should be nil. It sets the webhook with params, serves the HTTP endpoint, verifies the secret token
+// of each request if params.SecretToken is set, and handles the updates like Run.
+// If params.AllowedUpdates is nil, it is set to AllowedUpdates.
+//
+// RunWebhook blocks until ctx is done, then shuts the server down, waits for the handlers to finish and
+// returns nil. It returns an error if the webhook cannot be set or the server fails.
+// The webhook is left set, so updates queue on the Bale server until the bot is back.
+//
+// Example:
+//
+//	err := app.RunWebhook(ctx, &telego.SetWebhookParams{
+//	    URL:         "https://bot.example.com/bale",
+//	    SecretToken: os.Getenv("WEBHOOK_SECRET"),
+//	}, nabot.WebhookConfig{Addr: ":8080", Path: "/bale"})
+func (a *App) RunWebhook(ctx context.Context, params *telego.SetWebhookParams, config WebhookConfig) error {
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = 100
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = 10 * time.Second
+	}
+	if config.ReadHeaderTimeout <= 0 {
+		config.ReadHeaderTimeout = 10 * time.Second
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = 1 << 20
+	}
+	a.Freeze()
+	if params.AllowedUpdates == nil {
+		params.AllowedUpdates = a.AllowedUpdates()
+	}
+	if err := a.bot.SetWebhook(ctx, params); err != nil {
+		return err
+	}
+
+	updates := make(chan telego.Update, config.Buffer)
+	handler := &webhookHandler{
+		// updates already received are handled on shutdown, so they outlive ctx
+		ctx:     context.WithoutCancel(ctx),
+		secret:  params.SecretToken,
+		updates: updates,
+		maxBody: config.MaxBodyBytes,
+		logger:  a.logger,
+	}
+	mux := http.NewServeMux()
+	mux.Handle(config.Path, handler)
+	server := &http.Server{Addr: config.Addr, Handler: mux, ReadHeaderTimeout: config.ReadHeaderTimeout}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		var err error
+		if config.CertFile != "" {
+			err = server.ListenAndServeTLS(config.CertFile, config.KeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		serverErr <- err
+	}()
+
+	a.updatesChan = updates
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Run()
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), config.ShutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+	case err = <-serverErr:
+	}
+	// Run keeps draining updates, so requests still sending after a shutdown timeout complete
+	handler.inflight.Wait()
+	close(updates)
+	<-done
+	a.Stop()
+	return err
+}
+
+type webhookHandler struct {
+	ctx     context.Context
+	secret  string
+	updates chan<- telego.Update
+	maxBody int64
+	logger  *slog.Logger
+	// inflight counts the requests that may still send an update.
+	inflight sync.WaitGroup
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.inflight.Add(1)
+	defer h.inflight.Done()
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.Header.Get(telego.WebhookSecretTokenHeader)
+	if h.secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.secret)) != 1 {
+		http.Error(w, "invalid secret token", http.StatusUnauthorized)
+		return
+	}
+	var update telego.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBody)).Decode(&update); err != nil {
+		h.logger.Warn("nabot: invalid webhook update", "error", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "update too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+	select {
+	case h.updates <- update.WithContext(h.ctx):
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	}
+}
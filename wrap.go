@@ -0,0 +1,101 @@
+package nabot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"time"
+)
+
+// Wrap decorates a single handler with middlewares, unlike App.Use, which wraps every handler.
+// The first middleware is the outermost. The result keeps the name of handler and its type routing
+// if it is a TypedHandler, so it can be registered in place of handler.
+//
+// Example:
+//
+//	app.Handle(nabot.Wrap(adminCommands,
+//	    nabot.Recover(),
+//	    nabot.RequireChatType(telego.ChatTypePrivate),
+//	    nabot.Timeout(5*time.Second),
+//	))
+func Wrap(handler Handler, middleware ...Middleware) Handler {
+	wrapped := handler
+	for i := len(middleware) - 1; i >= 0; i-- {
+		wrapped = middleware[i](wrapped)
+	}
+	named := namedHandler{Handler: wrapped, name: handler.Name()}
+	if th, ok := handler.(TypedHandler); ok {
+		return typedNamedHandler{namedHandler: named, types: th.UpdateTypes()}
+	}
+	return named
+}
+
+type typedNamedHandler struct {
+	namedHandler
+	types []string
+}
+
+func (t typedNamedHandler) UpdateTypes() []string {
+	return t.types
+}
+
+// Recover returns a Middleware recovering panics of the handler, which returns them as an error
+// instead of crashing the bot. The stack of the panic is logged.
+func Recover() Middleware {
+	return MiddlewareFunc(func(ctx Context, next Handler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				ctx.Logger().Error("nabot: handler panicked",
+					"panic", r,
+					"stack", string(debug.Stack()),
+				)
+				err = fmt.Errorf("handler %s panicked: %v", next.Name(), r)
+			}
+		}()
+		return next.Handle(ctx)
+	})
+}
+
+// Timeout returns a Middleware canceling the Context of the handler after d.
+// The handler must respect the cancellation, such as by passing the Context to API and storage calls.
+func Timeout(d time.Duration) Middleware {
+	return MiddlewareFunc(func(ctx Context, next Handler) error {
+		timeoutCtx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return next.Handle(derivedContext{Context: ctx, ctx: timeoutCtx})
+	})
+}
+
+// Log returns a Middleware logging each call of the handler that does not pass with ErrPass,
+// with its duration and error, at level, or at slog.LevelError if it failed.
+func Log(level slog.Level) Middleware {
+	return MiddlewareFunc(func(ctx Context, next Handler) error {
+		start := ClockOf(ctx).Now()
+		err := next.Handle(ctx)
+		if errors.Is(err, ErrPass) {
+			return err
+		}
+		attrs := []any{slog.String("handler", next.Name()), slog.Duration("duration", ClockOf(ctx).Now().Sub(start))}
+		if err != nil {
+			ctx.Logger().Error("nabot: handler failed", append(attrs, "error", err)...)
+		} else {
+			ctx.Logger().Log(ctx, level, "nabot: handler done", attrs...)
+		}
+		return err
+	})
+}
+
+// RequireChatType returns a Middleware passing updates with ErrPass unless they happened in a chat
+// of one of the types, such as telego.ChatTypePrivate. Updates without a chat are passed as well.
+func RequireChatType(types ...string) Middleware {
+	return MiddlewareFunc(func(ctx Context, next Handler) error {
+		chat, ok := UpdateChat(ctx.Update())
+		if !ok || !slices.Contains(types, chat.Type) {
+			return ErrPass
+		}
+		return next.Handle(ctx)
+	})
+}